@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// approvalsResponse is returned for the list of pending requests
+type approvalsResponse struct {
+	Approvals []services.ApprovalRequest `json:"approvals"`
+}
+
+// pendingResponse is returned for a transaction held for approval
+type pendingResponse struct {
+	Approval services.ApprovalRequest `json:"approval"`
+}
+
+func (s *Server) listApprovals(w http.ResponseWriter, r *http.Request) {
+	pending := append([]services.ApprovalRequest{}, s.walletFor(r).PendingApprovals()...)
+	writeJSON(w, http.StatusOK, approvalsResponse{Approvals: pending})
+}
+
+func (s *Server) getApproval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	request, ok := s.walletFor(r).GetApprovalRequest(id)
+	if !ok {
+		writeError(w, fmt.Errorf("%w: no approval request %q", ErrNotFound, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, request)
+}
+
+// decide serves POST /approvals/{id}/approve (approve is true) and
+// POST /approvals/{id}/reject, returning the request after the decision
+// The approver is the user the request is authenticated as
+func (s *Server) decide(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decide := s.walletFor(r).Reject
+		if approve {
+			decide = s.walletFor(r).Approve
+		}
+		request, err := decide(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, request)
+	}
+}
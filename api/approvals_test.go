@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestServer_ApprovalFlow(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 500000000})
+	ac, err := services.NewAccessControl(
+		services.User{Name: "alice", Role: services.RoleWithdrawer},
+		services.User{Name: "bob", Role: services.RoleViewer},
+		services.User{Name: "mallory", Role: services.RoleViewer},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet.EnableAccessControl(ac)
+	wallet.EnableApprovals(services.ApprovalConfig{
+		Approvers:  []string{"alice", "bob"},
+		Required:   1,
+		Thresholds: map[models.Asset]int64{models.BTC: 100000000},
+	}, nil)
+	keyring, err := OpenKeyring(&memoryKeys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(wallet)
+	server.RequireKeys(keyring)
+	keys := make(map[string]string)
+	for _, user := range []string{"alice", "bob", "mallory"} {
+		keys[user] = createKey(t, keyring, KeySpec{User: user, Operations: []Operation{OpView, OpWithdraw, OpApprove}})
+	}
+	owner := createKey(t, keyring, KeySpec{Operations: []Operation{OpView, OpApprove}})
+
+	var held pendingResponse
+	rec := send(server, "POST", "/transactions", `{"type":"WITHDRAW","asset":"BTC","amount":"2"}`, keys["alice"])
+	json.Unmarshal(rec.Body.Bytes(), &held)
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != "/approvals/A1" || held.Approval.Status != services.ApprovalPending {
+		t.Fatalf("Expected the withdrawal to be held at /approvals/A1, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var list approvalsResponse
+	json.Unmarshal(send(server, "GET", "/approvals", "", keys["bob"]).Body.Bytes(), &list)
+	if len(list.Approvals) != 1 || list.Approvals[0].ID != "A1" {
+		t.Errorf("Expected A1 to be listed, got %+v", list.Approvals)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		status int
+		code   string
+	}{
+		{"not an approver", keys["mallory"], "", http.StatusForbidden, "NOT_APPROVER"},
+		{"owner key", owner, "", http.StatusForbidden, "FORBIDDEN"},
+		{"submitter", keys["alice"], "", http.StatusForbidden, "SELF_APPROVAL"},
+		// The body cannot name someone else as the approver
+		{"named in the body", keys["mallory"], `{"approver":"bob"}`, http.StatusForbidden, "NOT_APPROVER"},
+	}
+	for _, tt := range tests {
+		var errBody errorResponse
+		rec := send(server, "POST", "/approvals/A1/approve", tt.body, tt.secret)
+		json.Unmarshal(rec.Body.Bytes(), &errBody)
+		if rec.Code != tt.status || errBody.ErrorCode != tt.code {
+			t.Errorf("%s: expected %d %s, got %d: %s", tt.name, tt.status, tt.code, rec.Code, rec.Body.String())
+		}
+	}
+
+	var decided services.ApprovalRequest
+	rec = send(server, "POST", "/approvals/A1/approve", "", keys["bob"])
+	json.Unmarshal(rec.Body.Bytes(), &decided)
+	if rec.Code != http.StatusOK || decided.Status != services.ApprovalApproved || decided.EntryID != "2" || decided.Decisions[0].Approver != "bob" {
+		t.Fatalf("Expected bob's approval to commit A1 as entry 2, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var errBody errorResponse
+	rec = send(server, "POST", "/approvals/A1/reject", "", keys["alice"])
+	json.Unmarshal(rec.Body.Bytes(), &errBody)
+	if rec.Code != http.StatusConflict || errBody.ErrorCode != "REQUEST_CLOSED" {
+		t.Errorf("Expected 409 REQUEST_CLOSED, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(server, "GET", "/approvals/A9", "", keys["bob"]); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// Errors reported for API keys
+var (
+	ErrUnauthorized = &models.Error{Code: "UNAUTHORIZED", Message: "authentication failed"}
+	ErrInvalidKey   = &models.Error{Code: "INVALID_KEY", Message: "invalid API key"}
+	ErrUnknownKey   = &models.Error{Code: "UNKNOWN_KEY", Message: "unknown API key"}
+)
+
+// Headers of a signed request
+const (
+	HeaderKey       = "X-Hedix-Key"
+	HeaderTimestamp = "X-Hedix-Timestamp" // Unix seconds
+	HeaderNonce     = "X-Hedix-Nonce"
+	HeaderSignature = "X-Hedix-Signature"
+)
+
+// signatureWindow is how far the timestamp of a signed request may be from
+// the server's clock; nonces are remembered for as long
+const signatureWindow = 5 * time.Minute
+
+// Operation is what an API key may be used for
+type Operation string
+
+const (
+	OpView     Operation = "view"     // GET any resource
+	OpDeposit  Operation = "deposit"  // POST a deposit
+	OpWithdraw Operation = "withdraw" // POST a withdrawal
+	OpApprove  Operation = "approve"  // approve or reject a pending request
+)
+
+// operationPermissions is the wallet permission each operation needs
+var operationPermissions = map[Operation]services.Permission{
+	OpView:     services.PermView,
+	OpDeposit:  services.PermDeposit,
+	OpWithdraw: services.PermWithdraw,
+	OpApprove:  services.PermApprove,
+}
+
+// ParseOperation validates an operation name
+func ParseOperation(name string) (Operation, error) {
+	op := Operation(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := operationPermissions[op]; !ok {
+		return "", fmt.Errorf("%w: unknown operation %q. Must be view, deposit, withdraw or approve", ErrInvalidKey, name)
+	}
+	return op, nil
+}
+
+// APIKey is a credential for the HTTP API
+// Only the SHA-256 hash of its secret is kept, to check bearer secrets;
+// signed requests are checked with SigningKey, which the hash does not
+// give away
+type APIKey struct {
+	ID         string         `json:"id"`
+	Hash       string         `json:"hash"`               // hex SHA-256 of the secret
+	SigningKey string         `json:"-"`                  // see signingKey; a KeyStore only keeps it sealed
+	User       string         `json:"user,omitempty"`     // the wallet user the key acts as; empty for the owner
+	Accounts   []models.Asset `json:"accounts,omitempty"` // empty for every account
+	Operations []Operation    `json:"operations"`
+	Created    time.Time      `json:"created"`
+	Expires    time.Time      `json:"expires,omitzero"` // zero when it never expires
+	Revoked    time.Time      `json:"revoked,omitzero"`
+}
+
+// Active reports whether the key may still be used at now
+func (k APIKey) Active(now time.Time) bool {
+	return k.Revoked.IsZero() && (k.Expires.IsZero() || now.Before(k.Expires))
+}
+
+// scope is what the key keeps of its user's permissions
+func (k APIKey) scope() services.Scope {
+	scope := services.Scope{Name: "key " + k.ID, Accounts: k.Accounts}
+	for _, op := range k.Operations {
+		if perm := operationPermissions[op]; !slices.Contains(scope.Permissions, perm) {
+			scope.Permissions = append(scope.Permissions, perm)
+		}
+	}
+	return scope
+}
+
+// KeySpec describes a key to create
+type KeySpec struct {
+	User       string
+	Accounts   []models.Asset
+	Operations []Operation
+	TTL        time.Duration // 0 for a key that never expires
+}
+
+// KeyStore durably records API keys
+type KeyStore interface {
+	// Load returns every key recorded so far
+	Load() ([]APIKey, error)
+	// Save replaces the recorded keys
+	Save(keys []APIKey) error
+}
+
+// Keyring holds the API keys of a server and authenticates requests
+// It is safe for concurrent use
+type Keyring struct {
+	mu     sync.Mutex
+	store  KeyStore
+	keys   []APIKey
+	nonces map[string]time.Time // nonce -> when it may be forgotten
+	now    func() time.Time
+}
+
+// OpenKeyring loads the keys in store
+func OpenKeyring(store KeyStore) (*Keyring, error) {
+	keys, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{store: store, keys: keys, nonces: make(map[string]time.Time), now: time.Now}, nil
+}
+
+// Create records a new key and returns it with its secret, which is not
+// kept and cannot be shown again
+func (k *Keyring) Create(spec KeySpec) (APIKey, string, error) {
+	if len(spec.Operations) == 0 {
+		return APIKey{}, "", fmt.Errorf("%w: a key needs at least one operation", ErrInvalidKey)
+	}
+	if spec.TTL < 0 {
+		return APIKey{}, "", fmt.Errorf("%w: negative expiry", ErrInvalidKey)
+	}
+
+	random := make([]byte, 24)
+	rand.Read(random)
+	id := "k" + hex.EncodeToString(random[:4])
+	secret := id + "." + hex.EncodeToString(random[4:])
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	key := APIKey{
+		ID:         id,
+		Hash:       hashSecret(secret),
+		SigningKey: signingKey(secret),
+		User:       spec.User,
+		Accounts:   spec.Accounts,
+		Operations: spec.Operations,
+		Created:    now,
+	}
+	if spec.TTL > 0 {
+		key.Expires = now.Add(spec.TTL)
+	}
+	if err := k.store.Save(append(slices.Clone(k.keys), key)); err != nil {
+		return APIKey{}, "", err
+	}
+	k.keys = append(k.keys, key)
+	return key, secret, nil
+}
+
+// Revoke disables a key for good
+func (k *Keyring) Revoke(id string) (APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	i := slices.IndexFunc(k.keys, func(key APIKey) bool { return key.ID == id })
+	if i < 0 {
+		return APIKey{}, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	if !k.keys[i].Revoked.IsZero() {
+		return k.keys[i], nil
+	}
+	keys := slices.Clone(k.keys)
+	keys[i].Revoked = k.now()
+	if err := k.store.Save(keys); err != nil {
+		return APIKey{}, err
+	}
+	k.keys = keys
+	return keys[i], nil
+}
+
+// Keys returns every key, revoked and expired ones included, oldest first
+func (k *Keyring) Keys() []APIKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return slices.Clone(k.keys)
+}
+
+// Len returns how many keys were ever created
+func (k *Keyring) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return len(k.keys)
+}
+
+// Authenticate returns the key a request is made with. A request either
+// carries the secret as "Authorization: Bearer <secret>", or is signed:
+// X-Hedix-Key names the key, X-Hedix-Timestamp and X-Hedix-Nonce make it
+// unique, and X-Hedix-Signature is the hex HMAC-SHA256 of StringToSign,
+// keyed with the signing key of the secret. The body of a signed request
+// is read and put back
+func (k *Keyring) Authenticate(r *http.Request) (APIKey, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return k.bearer(strings.TrimSpace(token))
+	}
+	if r.Header.Get(HeaderKey) != "" {
+		return k.signed(r)
+	}
+	return APIKey{}, fmt.Errorf("%w: missing credentials", ErrUnauthorized)
+}
+
+func (k *Keyring) bearer(secret string) (APIKey, error) {
+	id, _, _ := strings.Cut(secret, ".")
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, err := k.active(id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 {
+		return APIKey{}, fmt.Errorf("%w: invalid secret", ErrUnauthorized)
+	}
+	return key, nil
+}
+
+func (k *Keyring) signed(r *http.Request) (APIKey, error) {
+	seconds, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("%w: %s must be a Unix time", ErrUnauthorized, HeaderTimestamp)
+	}
+	nonce := r.Header.Get(HeaderNonce)
+	if nonce == "" {
+		return APIKey{}, fmt.Errorf("%w: missing %s", ErrUnauthorized, HeaderNonce)
+	}
+	signature, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil || len(signature) == 0 {
+		return APIKey{}, fmt.Errorf("%w: %s must be hex", ErrUnauthorized, HeaderSignature)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return APIKey{}, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	timestamp := time.Unix(seconds, 0)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, err := k.active(r.Header.Get(HeaderKey))
+	if err != nil {
+		return APIKey{}, err
+	}
+	if key.SigningKey == "" {
+		return APIKey{}, fmt.Errorf("%w: key %s cannot sign requests", ErrUnauthorized, key.ID)
+	}
+	mac := hmac.New(sha256.New, []byte(key.SigningKey))
+	io.WriteString(mac, StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return APIKey{}, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+
+	now := k.now()
+	if timestamp.Before(now.Add(-signatureWindow)) || timestamp.After(now.Add(signatureWindow)) {
+		return APIKey{}, fmt.Errorf("%w: timestamp outside the allowed window of %s", ErrUnauthorized, signatureWindow)
+	}
+	for seen, forget := range k.nonces {
+		if now.After(forget) {
+			delete(k.nonces, seen)
+		}
+	}
+	nonceKey := key.ID + " " + nonce
+	if _, replayed := k.nonces[nonceKey]; replayed {
+		return APIKey{}, fmt.Errorf("%w: nonce already used", ErrUnauthorized)
+	}
+	k.nonces[nonceKey] = timestamp.Add(signatureWindow)
+	return key, nil
+}
+
+// active returns the key with id if it may be used; the caller holds k.mu
+func (k *Keyring) active(id string) (APIKey, error) {
+	for _, key := range k.keys {
+		if key.ID != id {
+			continue
+		}
+		if !key.Active(k.now()) {
+			return APIKey{}, fmt.Errorf("%w: key %s is expired or revoked", ErrUnauthorized, id)
+		}
+		return key, nil
+	}
+	return APIKey{}, fmt.Errorf("%w: unknown key", ErrUnauthorized)
+}
+
+// StringToSign is what a client signs: the method, the request URI (path
+// and query), the timestamp in Unix seconds, the nonce and the hex SHA-256
+// of the body, one per line
+func StringToSign(method, uri string, timestamp time.Time, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	return strings.Join([]string{method, uri, strconv.FormatInt(timestamp.Unix(), 10), nonce, hex.EncodeToString(digest[:])}, "\n")
+}
+
+// Sign sets the headers of a signed request made with the key whose
+// secret is given; body must be the request's body
+func Sign(r *http.Request, secret string, timestamp time.Time, nonce string, body []byte) {
+	id, _, _ := strings.Cut(secret, ".")
+	mac := hmac.New(sha256.New, []byte(signingKey(secret)))
+	io.WriteString(mac, StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+
+	r.Header.Set(HeaderKey, id)
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func hashSecret(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+// signingKey returns the key requests made with secret are signed with:
+// the hex HMAC-SHA256 of "hedix-wallet signing key" keyed with the secret
+func signingKey(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, "hedix-wallet signing key")
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequireKeys makes every request authenticate with a key from keyring
+// The request then acts as the key's user, if any, and only on the
+// accounts and operations of the key
+func (s *Server) RequireKeys(keyring *Keyring) {
+	s.keyring = keyring
+}
+
+// authenticate returns the wallet handle the request acts with
+func (s *Server) authenticate(r *http.Request) (*services.Wallet, error) {
+	if s.keyring == nil {
+		return s.wallet, nil
+	}
+	key, err := s.keyring.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	op := OpView
+	switch {
+	case r.Method == http.MethodGet:
+	case strings.HasPrefix(r.URL.Path, "/approvals/"):
+		op = OpApprove
+	default:
+		// The wallet checks deposits and withdrawals against the scope
+		op = ""
+	}
+	if op != "" && !slices.Contains(key.Operations, op) {
+		return nil, fmt.Errorf("%w: key %s may not %s", services.ErrForbidden, key.ID, op)
+	}
+
+	wallet := s.wallet
+	if key.User != "" {
+		if wallet, err = wallet.As(key.User); err != nil {
+			return nil, fmt.Errorf("%w: key %s: %w", ErrUnauthorized, key.ID, err)
+		}
+	}
+	return wallet.Restrict(key.scope()), nil
+}
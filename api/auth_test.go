@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// memoryKeys is a KeyStore that keeps the last save in memory
+type memoryKeys struct {
+	saved []APIKey
+}
+
+func (m *memoryKeys) Load() ([]APIKey, error) { return m.saved, nil }
+
+func (m *memoryKeys) Save(keys []APIKey) error {
+	m.saved = keys
+	return nil
+}
+
+func keyServer(t *testing.T) (*Server, *Keyring) {
+	t.Helper()
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 10000})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000000})
+	keyring, err := OpenKeyring(&memoryKeys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(wallet)
+	server.RequireKeys(keyring)
+	return server, keyring
+}
+
+func createKey(t *testing.T, keyring *Keyring, spec KeySpec) string {
+	t.Helper()
+	_, secret, err := keyring.Create(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// send makes a request with the bearer secret, if any, and returns its status
+func send(server http.Handler, method, target, body, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_RequiresKey(t *testing.T) {
+	server, keyring := keyServer(t)
+	secret := createKey(t, keyring, KeySpec{Operations: []Operation{OpView}})
+
+	if rec := send(server, "GET", "/balances", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", rec.Code)
+	}
+	if rec := send(server, "GET", "/balances", "", secret+"0"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong secret, got %d", rec.Code)
+	}
+	if rec := send(server, "GET", "/balances", "", secret); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with the key, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	id, _, _ := strings.Cut(secret, ".")
+	if _, err := keyring.Revoke(id); err != nil {
+		t.Fatal(err)
+	}
+	if rec := send(server, "GET", "/balances", "", secret); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a revoked key, got %d", rec.Code)
+	}
+}
+
+func TestServer_KeyExpires(t *testing.T) {
+	server, keyring := keyServer(t)
+	now := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	keyring.now = func() time.Time { return now }
+	secret := createKey(t, keyring, KeySpec{Operations: []Operation{OpView}, TTL: time.Hour})
+
+	if rec := send(server, "GET", "/balances", "", secret); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 before expiry, got %d", rec.Code)
+	}
+	now = now.Add(time.Hour)
+	if rec := send(server, "GET", "/balances", "", secret); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after expiry, got %d", rec.Code)
+	}
+}
+
+func TestServer_KeyScope(t *testing.T) {
+	server, keyring := keyServer(t)
+	secret := createKey(t, keyring, KeySpec{Accounts: []models.Asset{models.USD}, Operations: []Operation{OpView, OpDeposit}})
+
+	rec := send(server, "GET", "/balances", "", secret)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "BTC") {
+		t.Errorf("Expected only the USD balance, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"type":"DEPOSIT","asset":"USD","amount":"1"}`, http.StatusCreated},
+		{`{"type":"WITHDRAW","asset":"USD","amount":"1"}`, http.StatusForbidden},
+		{`{"type":"DEPOSIT","asset":"BTC","amount":"1"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rec := send(server, "POST", "/transactions", tt.body, secret); rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.body, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	deposit := createKey(t, keyring, KeySpec{Operations: []Operation{OpDeposit}})
+	if rec := send(server, "GET", "/transactions", "", deposit); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a key without view to be refused reads, got %d", rec.Code)
+	}
+	if rec := send(server, "POST", "/approvals/A1/approve", `{"approver":"alice"}`, secret); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a key without approve to be refused decisions, got %d", rec.Code)
+	}
+}
+
+func TestServer_SignedRequests(t *testing.T) {
+	server, keyring := keyServer(t)
+	now := time.Unix(1704708000, 0)
+	keyring.now = func() time.Time { return now }
+	secret := createKey(t, keyring, KeySpec{Operations: []Operation{OpView, OpDeposit}})
+
+	signed := func(body, nonce string, at time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(body))
+		Sign(req, secret, at, nonce, []byte(body))
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"type":"DEPOSIT","asset":"USD","amount":"1"}`
+	if rec := signed(body, "n1", now); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected a signed request to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := signed(body, "n1", now); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "nonce already used") {
+		t.Errorf("Expected a replay to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := signed(body, "n2", now.Add(-10*time.Minute)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a stale timestamp to be refused, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/transactions", strings.NewReader(`{"type":"DEPOSIT","asset":"USD","amount":"1000"}`))
+	Sign(req, secret, now, "n3", []byte(body))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a tampered body to be refused, got %d", rec.Code)
+	}
+	// Whoever reads the stored hash still cannot sign
+	stored := keyring.Keys()[0]
+	req = httptest.NewRequest("POST", "/transactions", strings.NewReader(body))
+	Sign(req, secret, now, "n4", []byte(body))
+	mac := hmac.New(sha256.New, []byte(stored.Hash))
+	io.WriteString(mac, StringToSign("POST", "/transactions", now, "n4", []byte(body)))
+	req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a signature keyed with the hash to be refused, got %d", rec.Code)
+	}
+
+	// A key loaded without its signing key only accepts its secret
+	keyring.keys[0].SigningKey = ""
+	if rec := signed(body, "n5", now); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "cannot sign") {
+		t.Errorf("Expected a key without a signing key to be refused signatures, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(server, "POST", "/transactions", body, secret); rec.Code != http.StatusCreated {
+		t.Errorf("Expected the bearer secret to still work, got %d", rec.Code)
+	}
+}
+
+func TestServer_KeyActsAsUser(t *testing.T) {
+	wallet := services.NewWallet()
+	ac, _ := services.NewAccessControl(services.User{Name: "cashier", Role: services.RoleDepositor})
+	wallet.EnableAccessControl(ac)
+	keyring, _ := OpenKeyring(&memoryKeys{})
+	server := NewServer(wallet)
+	server.RequireKeys(keyring)
+	secret := createKey(t, keyring, KeySpec{User: "cashier", Operations: []Operation{OpDeposit, OpWithdraw}})
+
+	rec := send(server, "POST", "/transactions", `{"type":"DEPOSIT","asset":"USD","amount":"5"}`, secret)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the deposit, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created transactionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Transaction.Principal != "cashier" {
+		t.Errorf("Expected the entry to name cashier, got %q", created.Transaction.Principal)
+	}
+	if rec := send(server, "POST", "/transactions", `{"type":"WITHDRAW","asset":"USD","amount":"1"}`, secret); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected the user's role to still apply, got %d", rec.Code)
+	}
+}
+
+func TestKeyring_StoresOnlyHashes(t *testing.T) {
+	store := &memoryKeys{}
+	keyring, _ := OpenKeyring(store)
+	key, secret, err := keyring.Create(KeySpec{Operations: []Operation{OpView}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.saved) != 1 || store.saved[0].ID != key.ID || strings.Contains(store.saved[0].Hash, secret) {
+		t.Errorf("Expected only the hash to be saved, got %+v", store.saved)
+	}
+	if _, _, err := keyring.Create(KeySpec{}); err == nil {
+		t.Errorf("Expected a key without operations to be refused")
+	}
+	if _, err := ParseOperation("launch"); err == nil {
+		t.Errorf("Expected an unknown operation to be refused")
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// keepAliveInterval is how often an idle event stream sends a comment so
+// proxies do not close it
+const keepAliveInterval = 15 * time.Second
+
+// eventResponse is the data of one server-sent event
+type eventResponse struct {
+	Seq         int                     `json:"seq"`
+	Status      string                  `json:"status"` // "accepted" or "rejected"
+	ErrorCode   string                  `json:"error_code,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	Transaction models.Transaction      `json:"transaction"`
+	Balances    map[models.Asset]string `json:"balances"`
+}
+
+// streamEvents serves GET /events as a stream of server-sent events: an
+// "accepted" event for every committed entry, with the ledger sequence
+// number as its id, and a "rejected" event for every rejected attempt
+//
+// A client resumes after the last id it saw with the Last-Event-ID header
+// (sent automatically by EventSource on reconnect) or the since query
+// parameter; since=0 replays the whole ledger. Without either only new
+// events are sent. Rejections are not in the ledger and are not replayed
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, fmt.Errorf("streaming is not supported by this connection"))
+		return
+	}
+
+	since := -1
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("since")
+	}
+	if value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, fmt.Errorf("%w: since: expected a ledger sequence number", ErrInvalidQuery))
+			return
+		}
+		since = n
+	}
+
+	replay, sub := s.walletFor(r).Subscribe(since)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and
+				// resumes from its last id
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", sub.Err())
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one event in the text/event-stream format
+// Only accepted events carry an id, so Last-Event-ID always names a
+// ledger position. Other kinds of wallet events are not streamed
+func writeEvent(w http.ResponseWriter, event services.Event) {
+	var data eventResponse
+	switch event := event.(type) {
+	case services.TransactionAccepted:
+		data = eventResponse{
+			Seq:         event.Seq,
+			Status:      "accepted",
+			Transaction: event.Transaction,
+			Balances:    formatBalances(event.Balances),
+		}
+		fmt.Fprintf(w, "id: %d\n", event.Seq)
+	case services.TransactionRejected:
+		data = eventResponse{
+			Seq:         event.Seq,
+			Status:      "rejected",
+			ErrorCode:   models.ErrorCode(event.Err),
+			Error:       event.Err.Error(),
+			Transaction: event.Transaction,
+			Balances:    formatBalances(event.Balances),
+		}
+	default:
+		return
+	}
+
+	encoded, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", data.Status, encoded)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// readEvent reads the next server-sent event, skipping comments
+func readEvent(t *testing.T, stream *bufio.Reader) (id, name string, data eventResponse) {
+	t.Helper()
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected an event, got: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return id, name, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+				t.Fatalf("Expected JSON event data, got: %s", line)
+			}
+		}
+	}
+}
+
+func TestServer_EventStream(t *testing.T) {
+	server := httptest.NewServer(NewServer(services.NewWallet()))
+	defer server.Close()
+
+	post := func(body string) {
+		resp, err := http.Post(server.URL+"/transactions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	post(`{"type":"DEPOSIT","asset":"USD","amount":"10"}`)
+	post(`{"type":"DEPOSIT","asset":"USD","amount":"5"}`)
+
+	// Resume after entry 1: entry 2 is replayed, then live events follow
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	id, name, data := readEvent(t, stream)
+	if id != "2" || name != "accepted" || data.Balances["USD"] != "15.00" {
+		t.Errorf("Expected replayed entry 2, got id=%s %s %+v", id, name, data)
+	}
+
+	post(`{"type":"WITHDRAW","asset":"USD","amount":"100"}`)
+	id, name, data = readEvent(t, stream)
+	if id != "" || name != "rejected" || data.ErrorCode != "INSUFFICIENT_FUNDS" {
+		t.Errorf("Expected a rejection without id, got id=%s %s %+v", id, name, data)
+	}
+
+	post(`{"type":"WITHDRAW","asset":"USD","amount":"1"}`)
+	id, name, data = readEvent(t, stream)
+	if id != "3" || name != "accepted" || data.Transaction.ID != "3" || data.Balances["USD"] != "14.00" {
+		t.Errorf("Expected live entry 3, got id=%s %s %+v", id, name, data)
+	}
+}
+
+func TestServer_EventStreamBadSince(t *testing.T) {
+	server := NewServer(services.NewWallet())
+
+	var got errorResponse
+	rec := do(t, server, "GET", "/events?since=abc", "", &got)
+	if rec.Code != http.StatusBadRequest || got.ErrorCode != "INVALID_QUERY" {
+		t.Errorf("Expected 400 INVALID_QUERY, got %d %s", rec.Code, got.ErrorCode)
+	}
+}
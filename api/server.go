@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// maxBodyBytes bounds the size of a request body
+const maxBodyBytes = 1 << 20
+
+// Errors reported by the API itself rather than by the wallet
+var (
+	ErrNotFound        = &models.Error{Code: "NOT_FOUND", Message: "not found"}
+	ErrInvalidQuery    = &models.Error{Code: "INVALID_QUERY", Message: "invalid query parameter"}
+	ErrPayloadTooLarge = &models.Error{Code: "PAYLOAD_TOO_LARGE", Message: "request body too large"}
+)
+
+// Server exposes a wallet as a JSON API over HTTP
+//
+//	POST /transactions        process a transaction
+//	GET  /transactions        list ledger entries, filtered by query parameters
+//	GET  /transactions/{id}   look up one ledger entry
+//	GET  /balances            balances of every asset
+//	GET  /balances/{asset}    balance of one asset
+//	GET  /events              stream of accepted and rejected transactions
+//	GET  /approvals           transactions waiting for approval
+//	GET  /approvals/{id}      look up one approval request
+//	POST /approvals/{id}/approve, POST /approvals/{id}/reject
+//	                          record an approver's decision
+//
+// With RequireKeys, every request must authenticate with an API key
+type Server struct {
+	wallet  *services.Wallet
+	keyring *Keyring // nil when requests need no key
+	mux     *http.ServeMux
+}
+
+// walletKey is the context key of the wallet handle a request acts with
+type walletKey struct{}
+
+// NewServer returns an http.Handler serving the wallet
+func NewServer(wallet *services.Wallet) *Server {
+	s := &Server{wallet: wallet, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /transactions", s.postTransaction)
+	s.mux.HandleFunc("GET /transactions", s.listTransactions)
+	s.mux.HandleFunc("GET /transactions/{id}", s.getTransaction)
+	s.mux.HandleFunc("GET /balances", s.getBalances)
+	s.mux.HandleFunc("GET /balances/{asset}", s.getBalance)
+	s.mux.HandleFunc("GET /events", s.streamEvents)
+	s.mux.HandleFunc("GET /approvals", s.listApprovals)
+	s.mux.HandleFunc("GET /approvals/{id}", s.getApproval)
+	s.mux.HandleFunc("POST /approvals/{id}/approve", s.decide(true))
+	s.mux.HandleFunc("POST /approvals/{id}/reject", s.decide(false))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wallet, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), walletKey{}, wallet)))
+}
+
+// walletFor returns the wallet handle r acts with
+func (s *Server) walletFor(r *http.Request) *services.Wallet {
+	if wallet, ok := r.Context().Value(walletKey{}).(*services.Wallet); ok {
+		return wallet
+	}
+	return s.wallet
+}
+
+// transactionResponse is returned for a committed transaction
+type transactionResponse struct {
+	Transaction models.Transaction      `json:"transaction"`
+	Balances    map[models.Asset]string `json:"balances"`
+}
+
+// balanceResponse is returned for the balance of one asset
+type balanceResponse struct {
+	Asset   models.Asset `json:"asset"`
+	Balance string       `json:"balance"`
+}
+
+// historyResponse is returned for a list of ledger entries
+type historyResponse struct {
+	Transactions []models.Transaction `json:"transactions"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	ErrorCode string `json:"error_code"`
+	Error     string `json:"error"`
+}
+
+// postTransaction commits a transaction and returns the entry Apply
+// recorded, with the coins and fee of a BTC withdrawal, and the balances
+// after it
+func (s *Server) postTransaction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, fmt.Errorf("%w: limit is %d bytes", ErrPayloadTooLarge, tooLarge.Limit))
+			return
+		}
+		writeError(w, err)
+		return
+	}
+
+	tx, err := models.ParseTransactionJSON(body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	committed, err := s.walletFor(r).Apply(tx)
+	var pending *services.PendingApprovalError
+	if errors.As(err, &pending) {
+		w.Header().Set("Location", "/approvals/"+pending.Request.ID)
+		writeJSON(w, http.StatusAccepted, pendingResponse{Approval: pending.Request})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/transactions/"+committed.ID)
+	writeJSON(w, http.StatusCreated, transactionResponse{
+		Transaction: committed,
+		Balances:    formatBalances(s.walletFor(r).GetAllBalances()),
+	})
+}
+
+// listTransactions returns ledger entries oldest first. Query parameters:
+// asset, type, since and until (RFC 3339; since inclusive, until
+// exclusive) filter the entries, and limit keeps only the last n
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	entries := make([]models.Transaction, 0)
+	for _, tx := range s.walletFor(r).GetTransactionHistory() {
+		if filter.matches(tx) {
+			entries = append(entries, tx)
+		}
+	}
+	if filter.limit > 0 && len(entries) > filter.limit {
+		entries = entries[len(entries)-filter.limit:]
+	}
+
+	writeJSON(w, http.StatusOK, historyResponse{Transactions: entries})
+}
+
+func (s *Server) getTransaction(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tx, ok := s.walletFor(r).GetTransaction(id)
+	if !ok {
+		writeError(w, fmt.Errorf("%w: no transaction with id %q", ErrNotFound, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+func (s *Server) getBalances(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, formatBalances(s.walletFor(r).GetAllBalances()))
+}
+
+func (s *Server) getBalance(w http.ResponseWriter, r *http.Request) {
+	asset := models.Asset(strings.ToUpper(r.PathValue("asset")))
+	if asset.GetDecimals() == 0 {
+		writeError(w, fmt.Errorf("%w: no asset %q", ErrNotFound, r.PathValue("asset")))
+		return
+	}
+	writeJSON(w, http.StatusOK, balanceResponse{
+		Asset:   asset,
+		Balance: asset.Format(s.walletFor(r).GetBalance(asset)),
+	})
+}
+
+// historyFilter selects ledger entries for listTransactions
+type historyFilter struct {
+	asset models.Asset // "" for any
+	typ   models.TransactionType
+	since time.Time // zero for no lower bound
+	until time.Time // zero for no upper bound
+	limit int       // 0 for all
+}
+
+func parseFilter(r *http.Request) (historyFilter, error) {
+	query := r.URL.Query()
+	var f historyFilter
+	invalid := func(name, reason string) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidQuery, name, reason)
+	}
+
+	if value := query.Get("asset"); value != "" {
+		f.asset = models.Asset(strings.ToUpper(value))
+		if f.asset.GetDecimals() == 0 {
+			return f, invalid("asset", fmt.Sprintf("unknown asset %q", value))
+		}
+	}
+	if value := query.Get("type"); value != "" {
+		f.typ = models.TransactionType(strings.ToUpper(value))
+		if f.typ != models.Deposit && f.typ != models.Withdraw {
+			return f, invalid("type", fmt.Sprintf("unknown type %q", value))
+		}
+	}
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &f.since}, {"until", &f.until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return f, invalid(bound.name, "expected an RFC 3339 timestamp")
+		}
+		*bound.dest = t
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return f, invalid("limit", "expected a non-negative integer")
+		}
+		f.limit = n
+	}
+	return f, nil
+}
+
+func (f historyFilter) matches(tx models.Transaction) bool {
+	switch {
+	case f.asset != "" && tx.Asset != f.asset:
+		return false
+	case f.typ != "" && tx.Type != f.typ:
+		return false
+	case !f.since.IsZero() && tx.Timestamp.Before(f.since):
+		return false
+	case !f.until.IsZero() && !tx.Timestamp.Before(f.until):
+		return false
+	}
+	return true
+}
+
+// statusFor maps an error to the HTTP status reported for it
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrUnknownRequest),
+		errors.Is(err, services.ErrUnknownAddress):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotApprover),
+		errors.Is(err, services.ErrSelfApproval),
+		errors.Is(err, services.ErrForbidden),
+		errors.Is(err, services.ErrNotAllowlisted):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInsufficientFunds),
+		errors.Is(err, services.ErrRuleRejected),
+		errors.Is(err, services.ErrBatchRejected),
+		errors.Is(err, services.ErrCoolingOff),
+		errors.Is(err, services.ErrDustOutput),
+		errors.Is(err, models.ErrUnknownOutput),
+		errors.Is(err, models.ErrUnbalancedCoins),
+		errors.Is(err, models.ErrDuplicateOutput):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrDuplicateID),
+		errors.Is(err, services.ErrRequestClosed),
+		errors.Is(err, services.ErrAlreadyDecided),
+		errors.Is(err, services.ErrNoAddresses):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidQuery),
+		errors.Is(err, services.ErrUnknownType),
+		errors.Is(err, models.ErrInvalidFormat),
+		errors.Is(err, models.ErrInvalidType),
+		errors.Is(err, models.ErrInvalidAsset),
+		errors.Is(err, models.ErrInvalidAmount),
+		errors.Is(err, models.ErrInvalidTimestamp),
+		errors.Is(err, services.ErrInvalidAddress),
+		errors.Is(err, services.ErrInvalidEntry),
+		errors.Is(err, models.ErrInvalidOutpoint),
+		errors.Is(err, services.ErrInvalidCoinSelection):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError reports err with its status and error code
+// Internal errors are not described to the client
+func writeError(w http.ResponseWriter, err error) {
+	status := statusFor(err)
+	body := errorResponse{ErrorCode: models.ErrorCode(err), Error: err.Error()}
+	if status == http.StatusInternalServerError {
+		body.Error = "internal error"
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// formatBalances renders every balance in its main unit
+func formatBalances(amounts map[models.Asset]int64) map[models.Asset]string {
+	balances := make(map[models.Asset]string, len(amounts))
+	for asset, amount := range amounts {
+		balances[asset] = asset.Format(amount)
+	}
+	return balances
+}
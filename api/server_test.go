@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// do sends a request to the server and decodes the JSON response into v
+func do(t *testing.T, server http.Handler, method, target, body string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: response is not valid JSON: %v: %s", method, target, err, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+func TestServer_PostTransaction(t *testing.T) {
+	server := NewServer(services.NewWallet())
+
+	var created transactionResponse
+	rec := do(t, server, "POST", "/transactions", `{"type":"DEPOSIT","asset":"BTC","amount":"1.5","memo":"salary"}`, &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Location") != "/transactions/1" || created.Transaction.ID != "1" {
+		t.Errorf("Expected the entry to be created at /transactions/1, got %q (id %q)", rec.Header().Get("Location"), created.Transaction.ID)
+	}
+	if created.Balances["BTC"] != "1.50000000" {
+		t.Errorf("Expected BTC balance 1.50000000, got %s", created.Balances["BTC"])
+	}
+}
+
+func TestServer_ErrorStatuses(t *testing.T) {
+	server := NewServer(services.NewWallet())
+	do(t, server, "POST", "/transactions", `{"id":"a","type":"DEPOSIT","asset":"USD","amount":"10"}`, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{"insufficient funds", "POST", "/transactions", `{"type":"WITHDRAW","asset":"USD","amount":"20"}`, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS"},
+		{"duplicate id", "POST", "/transactions", `{"id":"a","type":"DEPOSIT","asset":"USD","amount":"1"}`, http.StatusConflict, "DUPLICATE_ID"},
+		{"invalid amount", "POST", "/transactions", `{"type":"DEPOSIT","asset":"USD","amount":"1.234"}`, http.StatusBadRequest, "INVALID_AMOUNT"},
+		{"invalid asset", "POST", "/transactions", `{"type":"DEPOSIT","asset":"DOGE","amount":"1"}`, http.StatusBadRequest, "INVALID_ASSET"},
+		{"malformed json", "POST", "/transactions", `{"type":`, http.StatusBadRequest, "INVALID_FORMAT"},
+		{"recorded field", "POST", "/transactions", `{"type":"WITHDRAW","asset":"USD","amount":"1","reverses":"a"}`, http.StatusBadRequest, "INVALID_FORMAT"},
+		{"too large", "POST", "/transactions", strings.Repeat(" ", maxBodyBytes+1), http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE"},
+		{"unknown transaction", "GET", "/transactions/42", "", http.StatusNotFound, "NOT_FOUND"},
+		{"unknown asset", "GET", "/balances/DOGE", "", http.StatusNotFound, "NOT_FOUND"},
+		{"bad filter", "GET", "/transactions?limit=-1", "", http.StatusBadRequest, "INVALID_QUERY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got errorResponse
+			rec := do(t, server, tt.method, tt.target, tt.body, &got)
+			if rec.Code != tt.status || got.ErrorCode != tt.code {
+				t.Errorf("Expected %d %s, got %d %s: %s", tt.status, tt.code, rec.Code, got.ErrorCode, got.Error)
+			}
+		})
+	}
+}
+
+func TestServer_DestinationStatuses(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000000})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1000000000000000000})
+	if err := wallet.EnableAllowlist(services.AllowlistConfig{Accounts: []models.Asset{models.ETH}, CoolingOff: time.Hour}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.AllowAddress(models.ETH, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "cold"); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(wallet)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"invalid address", `{"type":"WITHDRAW","asset":"BTC","amount":"1","address":"bc1qnotanaddress"}`, http.StatusBadRequest, "INVALID_ADDRESS"},
+		{"not allowlisted", `{"type":"WITHDRAW","asset":"ETH","amount":"1","address":"0x52908400098527886e0f7030069857d2e4169ee7"}`, http.StatusForbidden, "NOT_ALLOWLISTED"},
+		{"cooling off", `{"type":"WITHDRAW","asset":"ETH","amount":"1","address":"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}`, http.StatusUnprocessableEntity, "COOLING_OFF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got errorResponse
+			rec := do(t, server, "POST", "/transactions", tt.body, &got)
+			if rec.Code != tt.status || got.ErrorCode != tt.code {
+				t.Errorf("Expected %d %s, got %d %s: %s", tt.status, tt.code, rec.Code, got.ErrorCode, got.Error)
+			}
+		})
+	}
+}
+
+func TestServer_CoinSelection(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000})
+	if err := wallet.EnableCoinSelection(services.CoinSelection{Strategy: services.LargestFirst, FeeRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(wallet)
+
+	var created transactionResponse
+	rec := do(t, server, "POST", "/transactions", `{"type":"WITHDRAW","asset":"BTC","amount":"0.0005"}`, &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	coins := created.Transaction.Coins
+	if coins == nil || len(coins.Inputs) != 1 || coins.Fee != 141 || coins.Change != 49859 || coins.Strategy != "largest-first" {
+		t.Errorf("Expected the selected coins in the response, got %+v", coins)
+	}
+
+	var got errorResponse
+	rec = do(t, server, "POST", "/transactions", `{"type":"WITHDRAW","asset":"BTC","amount":"0.00000100"}`, &got)
+	if rec.Code != http.StatusUnprocessableEntity || got.ErrorCode != "DUST_OUTPUT" {
+		t.Errorf("Expected 422 DUST_OUTPUT, got %d %s", rec.Code, got.ErrorCode)
+	}
+	if status := statusFor(services.ErrInvalidCoinSelection); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid coin selection, got %d", status)
+	}
+}
+
+func TestStatusFor_Coins(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{models.ErrInvalidOutpoint, http.StatusBadRequest},
+		{services.ErrInvalidEntry, http.StatusBadRequest},
+		{models.ErrUnknownOutput, http.StatusUnprocessableEntity},
+		{models.ErrUnbalancedCoins, http.StatusUnprocessableEntity},
+		{models.ErrDuplicateOutput, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if status := statusFor(fmt.Errorf("%w: detail", tt.err)); status != tt.status {
+			t.Errorf("%s: expected %d, got %d", models.ErrorCode(tt.err), tt.status, status)
+		}
+	}
+}
+
+func TestServer_AddressStatuses(t *testing.T) {
+	server := NewServer(services.NewWallet())
+
+	var got errorResponse
+	rec := do(t, server, "POST", "/transactions", `{"type":"DEPOSIT","asset":"ETH","amount":"1","address":"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}`, &got)
+	if rec.Code != http.StatusNotFound || got.ErrorCode != "UNKNOWN_ADDRESS" {
+		t.Errorf("Expected 404 UNKNOWN_ADDRESS, got %d %s", rec.Code, got.ErrorCode)
+	}
+	if status := statusFor(services.ErrNoAddresses); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a wallet without addresses, got %d", status)
+	}
+}
+
+func TestServer_Balances(t *testing.T) {
+	server := NewServer(services.NewWallet())
+	do(t, server, "POST", "/transactions", `{"type":"DEPOSIT","asset":"ETH","amount":"2"}`, nil)
+
+	var all map[string]string
+	do(t, server, "GET", "/balances", "", &all)
+	if all["ETH"] != "2.000000000000000000" || all["USD"] != "0.00" {
+		t.Errorf("Expected every asset's balance, got %v", all)
+	}
+
+	var one balanceResponse
+	do(t, server, "GET", "/balances/eth", "", &one)
+	if one.Asset != "ETH" || one.Balance != "2.000000000000000000" {
+		t.Errorf("Expected the ETH balance, got %+v", one)
+	}
+}
+
+func TestServer_HistoryFilters(t *testing.T) {
+	server := NewServer(services.NewWallet())
+	for _, body := range []string{
+		`{"type":"DEPOSIT","asset":"BTC","amount":"1","timestamp":"2024-01-01T00:00:00Z"}`,
+		`{"type":"DEPOSIT","asset":"USD","amount":"5","timestamp":"2024-02-01T00:00:00Z"}`,
+		`{"type":"WITHDRAW","asset":"BTC","amount":"0.5","timestamp":"2024-03-01T00:00:00Z"}`,
+		`{"type":"DEPOSIT","asset":"BTC","amount":"2","timestamp":"2024-04-01T00:00:00Z"}`,
+	} {
+		do(t, server, "POST", "/transactions", body, nil)
+	}
+
+	tests := []struct {
+		query string
+		ids   string
+	}{
+		{"", "1,2,3,4"},
+		{"?asset=btc", "1,3,4"},
+		{"?type=WITHDRAW", "3"},
+		{"?since=2024-02-01T00:00:00Z&until=2024-04-01T00:00:00Z", "2,3"},
+		{"?asset=BTC&limit=2", "3,4"},
+	}
+	for _, tt := range tests {
+		var got historyResponse
+		do(t, server, "GET", "/transactions"+tt.query, "", &got)
+
+		ids := make([]string, len(got.Transactions))
+		for i, tx := range got.Transactions {
+			ids[i] = tx.ID
+		}
+		if strings.Join(ids, ",") != tt.ids {
+			t.Errorf("GET /transactions%s: expected ids %s, got %s", tt.query, tt.ids, strings.Join(ids, ","))
+		}
+	}
+
+	var tx struct {
+		ID     string `json:"id"`
+		Amount string `json:"amount"`
+	}
+	if rec := do(t, server, "GET", "/transactions/3", "", &tx); rec.Code != http.StatusOK || tx.Amount != "0.50000000" {
+		t.Errorf("Expected transaction 3, got %d %+v", rec.Code, tx)
+	}
+}
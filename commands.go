@@ -0,0 +1,957 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/api"
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
+	"github.com/fraidev/hedix-wallet/services"
+	"github.com/fraidev/hedix-wallet/storage"
+)
+
+func setupRun(fs *flag.FlagSet, a *app) func(args []string) error {
+	format := fs.String("format", "text", "input format: text, csv or jsonl")
+	csvMap := fs.String("csv-map", "", "CSV column mapping, e.g. type=Side,asset=Currency,amount=Qty")
+	atomic := fs.Bool("atomic", false, "commit every transaction in the file or none of them")
+	dryRun := fs.Bool("dry-run", false, "simulate the file and report projected balances without changing the wallet")
+	failFast := fs.Bool("fail-fast", false, "stop at the first failing line or assertion")
+	exportPath := fs.String("export", "", "write the ledger to this CSV file when done")
+
+	return func(args []string) error {
+		mapping, err := models.ParseCSVMapping(*csvMap)
+		if err != nil {
+			return &usageError{command: "run", message: err.Error()}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		// "-" streams standard input: every line is processed as soon as it
+		// arrives and its result flushed, so the input may never end
+		var input io.Reader = a.stdin
+		name := "stdin"
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("reading file: %w", err)
+			}
+			defer file.Close()
+			input, name = file, args[0]
+		}
+		out := bufio.NewWriter(a.stdout)
+		defer out.Flush()
+
+		opts := fileOptions{
+			name:     name,
+			format:   *format,
+			output:   "text",
+			mapping:  mapping,
+			atomic:   *atomic,
+			dryRun:   *dryRun,
+			failFast: *failFast,
+		}
+		if a.output == "json" {
+			opts.output = "jsonl"
+		}
+		summary, err := runFile(wallet, input, out, opts)
+		if err != nil {
+			return err
+		}
+
+		// Keep stdout machine-readable in JSON mode
+		if a.output == "json" {
+			summary.write(a.stderr)
+		} else {
+			summary.write(out)
+		}
+
+		if *exportPath != "" {
+			if err := exportCSV(wallet, *exportPath); err != nil {
+				return fmt.Errorf("exporting ledger: %w", err)
+			}
+		}
+
+		// Non-zero when any line failed, so CI pipelines can gate on it
+		if summary.failed > 0 {
+			return &exitError{code: exitFailure}
+		}
+		return nil
+	}
+}
+
+func setupRepl(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		runInteractive(wallet)
+		return nil
+	}
+}
+
+func setupBalance(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("balance"); err != nil {
+			return err
+		}
+
+		assets := supportedAssets
+		if len(args) == 1 {
+			asset, err := parseAsset(args[0])
+			if err != nil {
+				return &usageError{command: "balance", message: err.Error()}
+			}
+			assets = []models.Asset{asset}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		// Leave out the accounts the user may not view, unless one was asked for
+		var visible []models.Asset
+		for _, asset := range assets {
+			err := wallet.Authorize(services.PermView, asset)
+			if err != nil && len(args) == 1 {
+				return err
+			}
+			if err == nil {
+				visible = append(visible, asset)
+			}
+		}
+		assets = visible
+
+		if a.output == "json" {
+			balances := make(map[models.Asset]string, len(assets))
+			for _, asset := range assets {
+				balances[asset] = asset.Format(wallet.GetBalance(asset))
+			}
+			return writeJSON(a.stdout, balances)
+		}
+		for _, asset := range assets {
+			writeBalance(a.stdout, wallet, asset)
+		}
+		return nil
+	}
+}
+
+func setupHistory(fs *flag.FlagSet, a *app) func(args []string) error {
+	limit := fs.Int("limit", 0, "show only the last n entries (0 for all)")
+	assetFlag := fs.String("asset", "", "show only entries of this asset")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("history"); err != nil {
+			return err
+		}
+		if *limit < 0 {
+			return &usageError{command: "history", message: "--limit must not be negative"}
+		}
+
+		var asset models.Asset
+		if *assetFlag != "" {
+			var err error
+			if asset, err = parseAsset(*assetFlag); err != nil {
+				return &usageError{command: "history", message: err.Error()}
+			}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+
+		entries := recentHistory(wallet, asset, *limit)
+		if a.output == "json" {
+			return writeJSON(a.stdout, entries)
+		}
+		writeHistory(a.stdout, entries)
+		return nil
+	}
+}
+
+func setupImport(fs *flag.FlagSet, a *app) func(args []string) error {
+	format := fs.String("format", "csv", "input format: csv, jsonl or text")
+	csvMap := fs.String("csv-map", "", "CSV column mapping, e.g. type=Side,asset=Currency,amount=Qty")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("import"); err != nil {
+			return err
+		}
+		mapping, err := models.ParseCSVMapping(*csvMap)
+		if err != nil {
+			return &usageError{command: "import", message: err.Error()}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("reading file: %w", err)
+		}
+		defer file.Close()
+
+		var records []record
+		failed := false
+		err = readRecords(file, fileOptions{format: *format, mapping: mapping}, func(rec record) bool {
+			if rec.directive != nil {
+				rec.err = &models.ParseError{Kind: models.ErrInvalidFormat, Input: rec.directive.text, Reason: "script directives cannot be imported"}
+			}
+			if rec.err != nil {
+				fmt.Fprintf(a.stderr, "%s:%d: Error: %s\n", args[0], rec.line, rec.err)
+				failed = true
+			}
+			records = append(records, rec)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if failed {
+			fmt.Fprintln(a.stderr, "Nothing was imported")
+			return &exitError{code: exitFailure}
+		}
+
+		txs := make([]models.Transaction, len(records))
+		for i, rec := range records {
+			txs[i] = rec.tx
+		}
+		var batchErr *services.BatchError
+		if err := wallet.ProcessBatch(txs); errors.As(err, &batchErr) {
+			for _, failure := range batchErr.Failures {
+				fmt.Fprintf(a.stderr, "%s:%d: Transaction failed: %s\n", args[0], records[failure.Index].line, failure.Err)
+			}
+			fmt.Fprintln(a.stderr, "Nothing was imported")
+			return &exitError{code: exitFailure}
+		} else if err != nil {
+			return err
+		}
+
+		if a.output == "json" {
+			return writeJSON(a.stdout, map[string]any{
+				"imported": len(txs),
+				"balances": formatBalances(wallet.GetAllBalances()),
+			})
+		}
+		fmt.Fprintf(a.stdout, "Imported %d transactions from %s\n", len(txs), args[0])
+		fmt.Fprintf(a.stdout, "Current State: %s\n", wallet)
+		return nil
+	}
+}
+
+func setupExport(fs *flag.FlagSet, a *app) func(args []string) error {
+	format := fs.String("format", "csv", "output file format: csv or jsonl")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("export"); err != nil {
+			return err
+		}
+
+		var write func(*services.Wallet, string) error
+		switch *format {
+		case "csv":
+			write = exportCSV
+		case "jsonl":
+			write = exportJSONL
+		default:
+			return &usageError{command: "export", message: fmt.Sprintf("unknown format %q. Must be csv or jsonl", *format)}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		if err := write(wallet, args[0]); err != nil {
+			return err
+		}
+
+		count := len(wallet.GetTransactionHistory())
+		if a.output == "json" {
+			return writeJSON(a.stdout, map[string]any{"exported": count, "path": args[0]})
+		}
+		fmt.Fprintf(a.stdout, "Exported %d transactions to %s\n", count, args[0])
+		return nil
+	}
+}
+
+func setupVerify(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("verify"); err != nil {
+			return err
+		}
+
+		// Read the journal directly: opening a wallet would accept whatever
+		// is stored, and the point here is to check it
+		journal, err := a.openJournal()
+		if err != nil {
+			return err
+		}
+		entries, err := journal.Load()
+		if err != nil {
+			return err
+		}
+		problems := services.Verify(entries)
+
+		if a.output == "json" {
+			messages := make([]string, len(problems))
+			for i, problem := range problems {
+				messages[i] = problem.Error()
+			}
+			if err := writeJSON(a.stdout, map[string]any{"entries": len(entries), "problems": messages}); err != nil {
+				return err
+			}
+		} else {
+			for _, problem := range problems {
+				fmt.Fprintf(a.stdout, "%s: %s\n", journal.Path(), problem)
+			}
+			if len(problems) == 0 {
+				fmt.Fprintf(a.stdout, "OK: %d entries verified\n", len(entries))
+			} else {
+				fmt.Fprintf(a.stdout, "%d problem(s) found in %d entries\n", len(problems), len(entries))
+			}
+		}
+
+		if len(problems) > 0 {
+			return &exitError{code: exitFailure}
+		}
+		return nil
+	}
+}
+
+func setupServe(fs *flag.FlagSet, a *app) func(args []string) error {
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	insecure := fs.Bool("insecure", false, "serve without authentication when no API key exists")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("serve"); err != nil {
+			return err
+		}
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		// Once a key has been created, every request needs one
+		handler := api.NewServer(wallet)
+		keys, err := a.openKeyFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := api.OpenKeyring(keys)
+		if err != nil {
+			return err
+		}
+		switch {
+		case keyring.Len() > 0:
+			handler.RequireKeys(keyring)
+		case !*insecure:
+			return fmt.Errorf("serve: no API keys in %s; create one with keys create, or pass --insecure to serve without authentication", a.dataDir)
+		}
+
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		// Stop accepting requests on Ctrl+C and let the ones in flight finish
+		// Event streams never finish on their own, so their request context
+		// is cancelled as well
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		server := &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+			BaseContext:       func(net.Listener) context.Context { return ctx },
+		}
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		}()
+
+		fmt.Fprintf(a.stderr, "Listening on http://%s\n", listener.Addr())
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		<-stopped
+		return nil
+	}
+}
+
+func setupPending(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("pending"); err != nil {
+			return err
+		}
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+
+		pending := wallet.PendingApprovals()
+		if a.output == "json" {
+			return writeJSON(a.stdout, append([]services.ApprovalRequest{}, pending...))
+		}
+		writePending(a.stdout, pending)
+		return nil
+	}
+}
+
+// setupDecision sets up the approve (approve is true) or reject command
+func setupDecision(approve bool) func(fs *flag.FlagSet, a *app) func(args []string) error {
+	name := "reject"
+	if approve {
+		name = "approve"
+	}
+
+	return func(fs *flag.FlagSet, a *app) func(args []string) error {
+		return func(args []string) error {
+			if err := a.requireDataDir(name); err != nil {
+				return err
+			}
+			wallet, err := a.openWallet()
+			if err != nil {
+				return err
+			}
+
+			decide := wallet.Reject
+			if approve {
+				decide = wallet.Approve
+			}
+			request, err := decide(args[0])
+			if err != nil {
+				return err
+			}
+
+			if a.output == "json" {
+				return writeJSON(a.stdout, request)
+			}
+			writeDecision(a.stdout, request)
+			return nil
+		}
+	}
+}
+
+// setupKeys sets up the keys command: create, list or revoke API keys
+func setupKeys(fs *flag.FlagSet, a *app) func(args []string) error {
+	user := fs.String("for", "", "wallet user the key acts as (default the user running serve)")
+	accounts := fs.String("accounts", "", "comma-separated assets the key may use (default all)")
+	operations := fs.String("operations", "view", "comma-separated operations: view, deposit, withdraw, approve")
+	expires := fs.Duration("expires", 0, "how long the key is valid, e.g. 720h (default never expires)")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("keys"); err != nil {
+			return err
+		}
+		action := args[0]
+		if action != "create" && action != "list" && action != "revoke" {
+			return &usageError{command: "keys", message: fmt.Sprintf("keys: unknown action %q. Must be create, list or revoke", action)}
+		}
+		if (action == "revoke") != (len(args) == 2) {
+			return &usageError{command: "keys", message: "keys: only revoke takes a key ID"}
+		}
+
+		// Managing keys is an admin's job once the wallet has users
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		if err := wallet.Authorize(services.PermAdmin, ""); err != nil {
+			return err
+		}
+		keys, err := a.openKeyFile()
+		if err != nil {
+			return err
+		}
+		keyring, err := api.OpenKeyring(keys)
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "list":
+			keys := keyring.Keys()
+			if a.output == "json" {
+				return writeJSON(a.stdout, append([]api.APIKey{}, keys...))
+			}
+			writeKeys(a.stdout, keys, time.Now())
+			return nil
+		case "revoke":
+			key, err := keyring.Revoke(args[1])
+			if err != nil {
+				return err
+			}
+			if a.output == "json" {
+				return writeJSON(a.stdout, key)
+			}
+			fmt.Fprintf(a.stdout, "Revoked key %s\n", key.ID)
+			return nil
+		}
+
+		spec := api.KeySpec{User: *user, TTL: *expires}
+		if spec.User != "" {
+			if _, err := wallet.As(spec.User); err != nil {
+				return err
+			}
+		}
+		for _, symbol := range splitList(*accounts) {
+			asset, err := parseAsset(symbol)
+			if err != nil {
+				return &usageError{command: "keys", message: err.Error()}
+			}
+			spec.Accounts = append(spec.Accounts, asset)
+		}
+		for _, name := range splitList(*operations) {
+			op, err := api.ParseOperation(name)
+			if err != nil {
+				return &usageError{command: "keys", message: err.Error()}
+			}
+			spec.Operations = append(spec.Operations, op)
+		}
+		key, secret, err := keyring.Create(spec)
+		if err != nil {
+			return err
+		}
+		if a.output == "json" {
+			return writeJSON(a.stdout, map[string]any{"key": key, "secret": secret})
+		}
+		fmt.Fprintf(a.stdout, "Created key %s\nSecret: %s\nThe secret is not stored and cannot be shown again.\n", key.ID, secret)
+		return nil
+	}
+}
+
+func setupEncrypt(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("encrypt"); err != nil {
+			return err
+		}
+		path := filepath.Join(a.dataDir, vaultFile)
+		resume := storage.IsVault(path)
+
+		if err := a.requireAdmin(); err != nil {
+			return err
+		}
+		// A wallet whose encryption was interrupted is unlocked and finished
+		if resume {
+			if _, err := a.unlock(); err != nil {
+				return err
+			}
+		} else {
+			passphrase, err := a.readNewPassphrase("HEDIX_NEW_PASSPHRASE")
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(a.dataDir, 0o700); err != nil {
+				return err
+			}
+			if a.cipher, err = storage.CreateVault(path, passphrase); err != nil {
+				return err
+			}
+		}
+		if err := storage.EncryptJournal(filepath.Join(a.dataDir, journalFile), a.cipher); err != nil {
+			return err
+		}
+		if err := storage.EncryptApprovalFile(filepath.Join(a.dataDir, approvalsFile), a.cipher); err != nil {
+			return err
+		}
+		if err := storage.EncryptAllowlistFile(filepath.Join(a.dataDir, allowlistFile), a.cipher); err != nil {
+			return err
+		}
+		if err := storage.EncryptKeyFile(filepath.Join(a.dataDir, keysFile), a.cipher); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.stdout, "Encrypted the wallet in %s\n", a.dataDir)
+		return nil
+	}
+}
+
+// requireAdmin checks that --user is an admin when the configuration
+// defines users, without opening the stored wallet
+func (a *app) requireAdmin() error {
+	if a.access == nil {
+		return nil
+	}
+	wallet := services.NewWallet()
+	if err := wallet.EnableAccessControl(a.access); err != nil {
+		return err
+	}
+	user, err := wallet.As(a.user)
+	if err != nil {
+		return err
+	}
+	return user.Authorize(services.PermAdmin, "")
+}
+
+func setupPassphrase(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("passphrase"); err != nil {
+			return err
+		}
+		path := filepath.Join(a.dataDir, vaultFile)
+		if !storage.IsVault(path) {
+			return fmt.Errorf("the wallet in %s is not encrypted; run encrypt first", a.dataDir)
+		}
+
+		if err := a.requireAdmin(); err != nil {
+			return err
+		}
+		current, err := a.readPassphrase("HEDIX_PASSPHRASE", "Passphrase: ")
+		if err != nil {
+			return err
+		}
+		next, err := a.readNewPassphrase("HEDIX_NEW_PASSPHRASE")
+		if err != nil {
+			return err
+		}
+		if err := storage.ChangePassphrase(path, current, next); err != nil {
+			return err
+		}
+		fmt.Fprintln(a.stdout, "Passphrase changed")
+		return nil
+	}
+}
+
+// setupSeed sets up the seed command: create a new BIP39 mnemonic, or
+// restore one, and keep the seed it derives in the encrypted data
+// directory; or export the watch-only key of an asset's account
+func setupSeed(fs *flag.FlagSet, a *app) func(args []string) error {
+	words := fs.Int("words", 24, "number of words of a new mnemonic: 12, 15, 18, 21 or 24")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("seed"); err != nil {
+			return err
+		}
+		action := args[0]
+		if action != "create" && action != "restore" && action != "xpub" {
+			return &usageError{command: "seed", message: fmt.Sprintf("seed: unknown action %q. Must be create, restore or xpub", action)}
+		}
+		if (action == "xpub") != (len(args) == 2) {
+			return &usageError{command: "seed", message: "seed: xpub takes an asset, and only xpub does"}
+		}
+		if err := a.requireAdmin(); err != nil {
+			return err
+		}
+		// Key material is never stored in plaintext
+		if !storage.IsVault(filepath.Join(a.dataDir, vaultFile)) {
+			return fmt.Errorf("the wallet in %s is not encrypted; run encrypt first", a.dataDir)
+		}
+		cipher, err := a.unlock()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(a.dataDir, seedFile)
+		if action == "xpub" {
+			return a.exportAccountKey(path, cipher, args[1])
+		}
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%w: %s", storage.ErrSeedExists, path)
+		}
+
+		var mnemonic string
+		if action == "create" {
+			if mnemonic, err = seed.NewMnemonic(*words); err != nil {
+				return &usageError{command: "seed", message: err.Error()}
+			}
+		} else if mnemonic, err = a.readMnemonic(); err != nil {
+			return err
+		}
+		passphrase, err := a.readSeedPassphrase()
+		if err != nil {
+			return err
+		}
+		derived, err := seed.Seed(mnemonic, passphrase)
+		if err != nil {
+			return err
+		}
+		if err := storage.SaveSeed(path, cipher, derived); err != nil {
+			return err
+		}
+
+		if action == "restore" {
+			fmt.Fprintln(a.stdout, "Seed restored")
+			return nil
+		}
+		if a.output == "json" {
+			return writeJSON(a.stdout, map[string]string{"mnemonic": mnemonic})
+		}
+		fmt.Fprintf(a.stdout, "%s\n\nWrite these words down and keep them offline: with the seed passphrase, they are the only way to recover the wallet's keys. They are not stored and cannot be shown again.\n", mnemonic)
+		return nil
+	}
+}
+
+// exportAccountKey prints the xpub of an asset's BIP44 account, which
+// derives every address of the account but can spend none
+func (a *app) exportAccountKey(path string, cipher *storage.Cipher, symbol string) error {
+	asset, err := parseAsset(symbol)
+	if err != nil {
+		return err
+	}
+	stored, err := storage.LoadSeed(path, cipher)
+	if err != nil {
+		return err
+	}
+	account, err := seed.AccountKey(stored, asset)
+	if err != nil {
+		return err
+	}
+	accountPath, _ := seed.AccountPath(asset)
+
+	xpub := account.Neuter().String()
+	if a.output == "json" {
+		return writeJSON(a.stdout, map[string]string{"asset": string(asset), "path": seed.FormatPath(accountPath), "xpub": xpub})
+	}
+	fmt.Fprintf(a.stdout, "%s %s\n%s\n", asset, seed.FormatPath(accountPath), xpub)
+	return nil
+}
+
+// setupAddress sets up the address command: generate the next receive
+// address of an account, or list the addresses with their deposits
+func setupAddress(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("address"); err != nil {
+			return err
+		}
+		action := args[0]
+		if action != "new" && action != "list" {
+			return &usageError{command: "address", message: fmt.Sprintf("address: unknown action %q. Must be new or list", action)}
+		}
+		if action == "new" && len(args) != 2 {
+			return &usageError{command: "address", message: "address: new takes an asset"}
+		}
+		var asset models.Asset
+		if len(args) == 2 {
+			var err error
+			if asset, err = parseAsset(args[1]); err != nil {
+				return &usageError{command: "address", message: err.Error()}
+			}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		if action == "new" {
+			address, err := wallet.NewAddress(asset)
+			if errors.Is(err, services.ErrNoAddresses) {
+				return fmt.Errorf("the wallet in %s has no seed; run seed create first", a.dataDir)
+			}
+			if err != nil {
+				return err
+			}
+			if a.output == "json" {
+				return writeJSON(a.stdout, address)
+			}
+			fmt.Fprintln(a.stdout, address.Address)
+			return nil
+		}
+
+		addresses := wallet.Addresses(asset)
+		received := make([][]models.Transaction, len(addresses))
+		for i, address := range addresses {
+			received[i] = wallet.Received(address.Address)
+		}
+		if a.output == "json" {
+			type listed struct {
+				services.ReceiveAddress
+				Deposits []string `json:"deposits"`
+				Received string   `json:"received"`
+			}
+			list := make([]listed, len(addresses))
+			for i, address := range addresses {
+				list[i] = listed{ReceiveAddress: address, Deposits: []string{}}
+				var total int64
+				for _, tx := range received[i] {
+					list[i].Deposits = append(list[i].Deposits, tx.ID)
+					total += tx.Amount
+				}
+				list[i].Received = address.Asset.Format(total)
+			}
+			return writeJSON(a.stdout, list)
+		}
+		writeAddresses(a.stdout, addresses, received)
+		return nil
+	}
+}
+
+// setupAllowlist sets up the allowlist command: add, remove or list the
+// withdrawal destinations of accounts
+func setupAllowlist(fs *flag.FlagSet, a *app) func(args []string) error {
+	label := fs.String("label", "", "note kept with an added address, e.g. cold storage")
+
+	return func(args []string) error {
+		if err := a.requireDataDir("allowlist"); err != nil {
+			return err
+		}
+		action := args[0]
+		if action != "add" && action != "remove" && action != "list" {
+			return &usageError{command: "allowlist", message: fmt.Sprintf("allowlist: unknown action %q. Must be add, remove or list", action)}
+		}
+		if (action == "list") != (len(args) < 3) {
+			return &usageError{command: "allowlist", message: "allowlist: add and remove take an asset and an address"}
+		}
+		var asset models.Asset
+		if len(args) > 1 {
+			var err error
+			if asset, err = parseAsset(args[1]); err != nil {
+				return &usageError{command: "allowlist", message: err.Error()}
+			}
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		var entry services.AllowedAddress
+		switch action {
+		case "list":
+			allowed := wallet.AllowedAddresses(asset)
+			if a.output == "json" {
+				return writeJSON(a.stdout, append([]services.AllowedAddress{}, allowed...))
+			}
+			writeAllowlist(a.stdout, allowed, time.Now())
+			return nil
+		case "add":
+			entry, err = wallet.AllowAddress(asset, args[2], *label)
+		case "remove":
+			entry, err = wallet.RemoveAllowedAddress(asset, args[2])
+		}
+		if err != nil {
+			return err
+		}
+
+		if a.output == "json" {
+			return writeJSON(a.stdout, entry)
+		}
+		if action == "remove" {
+			fmt.Fprintf(a.stdout, "Removed %s from the %s allowlist\n", entry.Address, entry.Asset)
+			return nil
+		}
+		fmt.Fprintf(a.stdout, "Added %s to the %s allowlist, receiving withdrawals from %s\n", entry.Address, entry.Asset,
+			entry.Active.Local().Format("2006-01-02 15:04:05"))
+		if !wallet.AllowlistRequired(asset) {
+			fmt.Fprintf(a.stdout, "The %s account does not require allowlisted destinations yet; see allowlist in the config file\n", asset)
+		}
+		return nil
+	}
+}
+
+// readMnemonic reads the mnemonic to restore from $HEDIX_MNEMONIC, or the
+// first line of standard input
+func (a *app) readMnemonic() (string, error) {
+	if mnemonic := os.Getenv("HEDIX_MNEMONIC"); mnemonic != "" {
+		return mnemonic, nil
+	}
+	if isTerminal(a.stdin) {
+		fmt.Fprint(a.stderr, "Mnemonic: ")
+	}
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("seed restore: expected the mnemonic on standard input or in $HEDIX_MNEMONIC")
+	}
+	return line, nil
+}
+
+// readSeedPassphrase returns the optional BIP39 passphrase: the value of
+// $HEDIX_SEED_PASSPHRASE, asked for on a terminal, or empty
+func (a *app) readSeedPassphrase() (string, error) {
+	if passphrase, ok := os.LookupEnv("HEDIX_SEED_PASSPHRASE"); ok || !isTerminal(a.stdin) {
+		return passphrase, nil
+	}
+	return a.readPassphrase("HEDIX_SEED_PASSPHRASE", "Seed passphrase (optional): ")
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// exportCSV writes the full ledger to path in the default CSV layout
+func exportCSV(wallet *services.Wallet, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := models.WriteCSV(file, wallet.GetTransactionHistory()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// exportJSONL writes the full ledger to path, one transaction per line
+func exportJSONL(wallet *services.Wallet, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, tx := range wallet.GetTransactionHistory() {
+		if err := encoder.Encode(tx); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func setupUTXOs(fs *flag.FlagSet, a *app) func(args []string) error {
+	return func(args []string) error {
+		if err := a.requireDataDir("utxos"); err != nil {
+			return err
+		}
+
+		wallet, err := a.openWallet()
+		if err != nil {
+			return err
+		}
+		utxos := wallet.UTXOs()
+		check := wallet.CheckUTXOs()
+		if a.output == "json" {
+			var total int64
+			for _, utxo := range utxos {
+				total += utxo.Value
+			}
+			if utxos == nil {
+				utxos = []models.UTXO{}
+			}
+			result := map[string]any{"utxos": utxos, "total": models.BTC.Format(total)}
+			if check != nil {
+				result["error"] = check.Error()
+			}
+			if err := writeJSON(a.stdout, result); err != nil {
+				return err
+			}
+		} else {
+			writeUTXOs(a.stdout, utxos)
+		}
+
+		return check
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// config is the optional JSON configuration file
+// Command-line flags take precedence over every value in it
+type config struct {
+	DataDir   string                `json:"data_dir"`
+	Output    string                `json:"output"`
+	Policy    []string              `json:"policy"` // policy rules, see services.PolicyRule
+	Approval  *approvalConfig       `json:"approval"`
+	Users     map[string]userConfig `json:"users"` // name -> role; when set, every command acts as --user
+	Allowlist *allowlistConfig      `json:"allowlist"`
+	Coins     *coinsConfig          `json:"coin_selection"`
+}
+
+// userConfig is one user of the users section
+type userConfig struct {
+	Role     string   `json:"role"`     // viewer, depositor, withdrawer or admin
+	Accounts []string `json:"accounts"` // assets the role applies to; empty for all
+}
+
+// accessControl converts the users section into the wallet's access control
+func accessControl(users map[string]userConfig) (*services.AccessControl, error) {
+	var list []services.User
+	for name, u := range users {
+		role, err := services.ParseRole(u.Role)
+		if err != nil {
+			return nil, fmt.Errorf("users: %s: %w", name, err)
+		}
+		user := services.User{Name: name, Role: role}
+		for _, symbol := range u.Accounts {
+			asset, err := parseAsset(symbol)
+			if err != nil {
+				return nil, fmt.Errorf("users: %s: %w", name, err)
+			}
+			user.Accounts = append(user.Accounts, asset)
+		}
+		list = append(list, user)
+	}
+	return services.NewAccessControl(list...)
+}
+
+// approvalConfig is the approval workflow section of the configuration
+type approvalConfig struct {
+	Approvers  []string          `json:"approvers"`
+	Required   int               `json:"required"`
+	Thresholds map[string]string `json:"thresholds"` // asset -> amount in its main unit
+	Timeout    string            `json:"timeout"`    // e.g. "24h"; empty for no expiry
+}
+
+// walletConfig converts the section into the wallet's configuration
+func (c approvalConfig) walletConfig() (services.ApprovalConfig, error) {
+	cfg := services.ApprovalConfig{
+		Approvers:  c.Approvers,
+		Required:   c.Required,
+		Thresholds: make(map[models.Asset]int64, len(c.Thresholds)),
+	}
+	for symbol, value := range c.Thresholds {
+		asset, err := parseAsset(symbol)
+		if err != nil {
+			return cfg, fmt.Errorf("approval thresholds: %w", err)
+		}
+		amount, err := asset.ParseAmount(strings.TrimSpace(value))
+		if err != nil {
+			return cfg, fmt.Errorf("approval thresholds: %s: %w", asset, err)
+		}
+		cfg.Thresholds[asset] = amount
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil || timeout < 0 {
+			return cfg, fmt.Errorf("approval timeout: invalid duration %q", c.Timeout)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// allowlistConfig is the withdrawal allowlist section of the configuration
+type allowlistConfig struct {
+	Accounts   []string `json:"accounts"`    // assets whose withdrawals need an allowlisted destination
+	CoolingOff string   `json:"cooling_off"` // e.g. "24h"; empty for none
+}
+
+// walletConfig converts the section into the wallet's configuration
+func (c allowlistConfig) walletConfig() (services.AllowlistConfig, error) {
+	var cfg services.AllowlistConfig
+	for _, symbol := range c.Accounts {
+		asset, err := parseAsset(symbol)
+		if err != nil {
+			return cfg, fmt.Errorf("allowlist accounts: %w", err)
+		}
+		cfg.Accounts = append(cfg.Accounts, asset)
+	}
+	if c.CoolingOff != "" {
+		coolingOff, err := time.ParseDuration(c.CoolingOff)
+		if err != nil || coolingOff < 0 {
+			return cfg, fmt.Errorf("allowlist cooling_off: invalid duration %q", c.CoolingOff)
+		}
+		cfg.CoolingOff = coolingOff
+	}
+	return cfg, nil
+}
+
+// coinsConfig is the coin selection section of the configuration
+type coinsConfig struct {
+	Strategy string `json:"strategy"` // largest-first, branch-and-bound or knapsack; empty for branch-and-bound
+	FeeRate  int64  `json:"fee_rate"` // satoshis per virtual byte
+}
+
+// walletConfig converts the section into the wallet's configuration
+func (c coinsConfig) walletConfig() (services.CoinSelection, error) {
+	cfg := services.CoinSelection{FeeRate: c.FeeRate}
+	if c.Strategy != "" {
+		strategy, err := services.ParseSelectionStrategy(strings.ToLower(c.Strategy))
+		if err != nil {
+			return cfg, fmt.Errorf("coin_selection: %w", err)
+		}
+		cfg.Strategy = strategy
+	}
+	if c.FeeRate < 0 {
+		return cfg, fmt.Errorf("coin_selection fee_rate: must not be negative, got %d", c.FeeRate)
+	}
+	return cfg, nil
+}
+
+// loadConfig reads the configuration file at path
+// An empty path yields the zero configuration
+func loadConfig(path string) (config, error) {
+	var cfg config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
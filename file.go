@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// fileOptions controls how a transaction file is read and reported
+type fileOptions struct {
+	name     string // file name used to prefix diagnostics
+	format   string // input format: text, csv or jsonl
+	output   string // output format: text or jsonl
+	mapping  models.CSVMapping
+	atomic   bool // commit the whole file or nothing
+	dryRun   bool // simulate against a fork of the wallet
+	failFast bool // stop at the first failing line or assertion
+}
+
+// record is one transaction or script directive read from an input file
+type record struct {
+	line      int
+	tx        models.Transaction
+	directive *directive // set for script directives; EXPECT FAIL also sets tx
+	err       error      // set when the line could not be parsed
+}
+
+// fileSummary counts the outcome of every record in a file
+type fileSummary struct {
+	processed int
+	succeeded int
+	failed    int
+	byCode    map[string]int // failures per error code
+}
+
+// write prints the summary with failure reasons in a stable order
+func (s fileSummary) write(out io.Writer) {
+	fmt.Fprintf(out, "Summary: %d processed, %d succeeded, %d failed\n", s.processed, s.succeeded, s.failed)
+
+	codes := make([]string, 0, len(s.byCode))
+	for code := range s.byCode {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(out, "  %s: %d\n", code, s.byCode[code])
+	}
+}
+
+// runFile processes every transaction in file and reports each result
+// The returned summary tells whether any line failed
+func runFile(wallet *services.Wallet, file io.Reader, out io.Writer, opts fileOptions) (fileSummary, error) {
+	// A dry run processes everything as usual, only against a throwaway copy
+	if opts.dryRun {
+		wallet = wallet.Fork()
+	}
+
+	var report reporter
+	switch opts.output {
+	case "text":
+		report = &textReporter{out: out, wallet: wallet, name: opts.name, dryRun: opts.dryRun}
+	case "jsonl":
+		report = &jsonlReporter{encoder: json.NewEncoder(out), wallet: wallet}
+	default:
+		return fileSummary{}, fmt.Errorf("unknown output format %q. Must be text or jsonl", opts.output)
+	}
+	if buffered, ok := out.(flusher); ok {
+		report = &flushing{reporter: report, out: buffered}
+	}
+	counted := &tally{reporter: report, summary: fileSummary{byCode: make(map[string]int)}}
+
+	var err error
+	if opts.atomic {
+		err = runAtomic(wallet, file, opts, counted)
+	} else {
+		err = runEach(wallet, file, opts, counted)
+	}
+	return counted.summary, err
+}
+
+// runEach applies every record on its own as soon as it is read
+func runEach(wallet *services.Wallet, file io.Reader, opts fileOptions, report reporter) error {
+	err := readRecords(file, opts, func(rec record) bool {
+		var err error
+		switch {
+		case rec.err != nil:
+			err = rec.err
+			report.invalid(rec)
+		case rec.directive != nil:
+			var outcome string
+			outcome, err = runDirective(wallet, rec)
+			report.checked(rec, outcome, err)
+		default:
+			var committed models.Transaction
+			committed, err = wallet.Apply(rec.tx)
+			if err != nil {
+				report.processed(rec, nil, err)
+			} else {
+				report.processed(rec, &committed, nil)
+			}
+		}
+		return err == nil || !opts.failFast
+	})
+	if err != nil {
+		return err
+	}
+
+	report.finish()
+	return nil
+}
+
+// runAtomic reads the whole file and commits it as a single batch
+// When any line fails to parse or validate nothing is committed and every
+// failing line is reported; the remaining lines report ErrBatchRejected
+func runAtomic(wallet *services.Wallet, file io.Reader, opts fileOptions, report reporter) error {
+	var records, valid []record
+	err := readRecords(file, opts, func(rec record) bool {
+		// Assertions need committed state after each line, which a batch
+		// does not have until the very end
+		if rec.directive != nil {
+			rec.err = &models.ParseError{Kind: models.ErrInvalidFormat, Input: rec.directive.text, Reason: "script directives cannot be used with --atomic"}
+		}
+		records = append(records, rec)
+		if rec.err == nil {
+			valid = append(valid, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	txs := make([]models.Transaction, len(valid))
+	for i, rec := range valid {
+		txs[i] = rec.tx
+	}
+
+	// A batch with unparseable lines is never committed, but it is still
+	// validated so that every failing line is reported in one run
+	var committed []models.Transaction
+	if len(valid) < len(records) {
+		err = wallet.ValidateBatch(txs)
+	} else {
+		committed, err = wallet.ApplyBatch(txs)
+	}
+
+	var batchErr *services.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return err
+	}
+	failed := make(map[int]error)
+	if batchErr != nil {
+		for _, failure := range batchErr.Failures {
+			failed[valid[failure.Index].line] = failure.Err
+		}
+	}
+
+	rejected := err != nil || len(valid) < len(records)
+	for _, rec := range records {
+		switch {
+		case rec.err != nil:
+			report.invalid(rec)
+		case failed[rec.line] != nil:
+			report.processed(rec, nil, failed[rec.line])
+		case rejected:
+			report.processed(rec, nil, fmt.Errorf("%w: not committed because other lines failed", services.ErrBatchRejected))
+		default:
+			report.processed(rec, &committed[0], nil)
+			committed = committed[1:]
+		}
+	}
+
+	report.finish()
+	return nil
+}
+
+// readRecords parses file in the given input format and calls yield for
+// every record in order until yield returns false. Unparseable lines are
+// yielded with err set; only errors that make the rest of the input
+// unreadable are returned. Script directives exist only in the text format
+func readRecords(file io.Reader, opts fileOptions, yield func(record) bool) error {
+	switch opts.format {
+	case "text":
+		return eachLine(file, func(line int, text string) bool {
+			input := stripComment(text)
+			if input == "" {
+				return true
+			}
+			return yield(parseScriptLine(line, input))
+		})
+
+	case "jsonl":
+		return eachLine(file, func(line int, text string) bool {
+			input := strings.TrimSpace(text)
+			if input == "" || strings.HasPrefix(input, "#") {
+				return true
+			}
+			tx, err := models.ParseTransactionJSON([]byte(input))
+			return yield(record{line: line, tx: tx, err: err})
+		})
+
+	case "csv":
+		reader, err := models.NewCSVReader(file, opts.mapping)
+		if err != nil {
+			return err
+		}
+		for {
+			tx, line, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if line == 0 {
+				return fmt.Errorf("reading CSV: %w", err)
+			}
+			if !yield(record{line: line, tx: tx, err: err}) {
+				return nil
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown format %q. Must be text, csv or jsonl", opts.format)
+	}
+}
+
+// eachLine calls yield with every line of r, without its line ending,
+// until yield returns false. Unlike bufio.Scanner it has no limit on the
+// length of a line, and it hands each line over as soon as it is complete,
+// so r can be an endless stream such as a pipe fed by tail -f
+func eachLine(r io.Reader, yield func(line int, text string) bool) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if text == "" && err == io.EOF {
+			return nil
+		}
+		if !yield(line, strings.TrimRight(text, "\r\n")) || err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// stripComment removes a trailing "# comment" and surrounding whitespace
+func stripComment(line string) string {
+	line, _, _ = strings.Cut(line, "#")
+	return strings.TrimSpace(line)
+}
+
+// reporter renders the outcome of each record
+type reporter interface {
+	// invalid reports a record that could not be parsed
+	invalid(rec record)
+	// processed reports a record after the wallet accepted or rejected it
+	// committed is the entry the wallet recorded, nil when rejected
+	processed(rec record, committed *models.Transaction, err error)
+	// checked reports a script directive; err wraps errAssertionFailed when
+	// it did not hold, otherwise outcome describes the result
+	checked(rec record, outcome string, err error)
+	finish()
+}
+
+// tally counts outcomes for the file summary before forwarding them
+type tally struct {
+	reporter
+	summary fileSummary
+}
+
+func (t *tally) invalid(rec record) {
+	t.count(rec.err)
+	t.reporter.invalid(rec)
+}
+
+func (t *tally) processed(rec record, committed *models.Transaction, err error) {
+	t.count(err)
+	t.reporter.processed(rec, committed, err)
+}
+
+func (t *tally) checked(rec record, outcome string, err error) {
+	t.count(err)
+	t.reporter.checked(rec, outcome, err)
+}
+
+func (t *tally) count(err error) {
+	t.summary.processed++
+	if err == nil {
+		t.summary.succeeded++
+		return
+	}
+	t.summary.failed++
+	t.summary.byCode[models.ErrorCode(err)]++
+}
+
+// flusher is implemented by buffered outputs such as *bufio.Writer
+type flusher interface {
+	Flush() error
+}
+
+// flushing flushes buffered output after every record, so whoever reads
+// a stream sees each result as soon as its line has been processed
+type flushing struct {
+	reporter
+	out flusher
+}
+
+func (f *flushing) invalid(rec record) {
+	f.reporter.invalid(rec)
+	f.out.Flush()
+}
+
+func (f *flushing) processed(rec record, committed *models.Transaction, err error) {
+	f.reporter.processed(rec, committed, err)
+	f.out.Flush()
+}
+
+func (f *flushing) checked(rec record, outcome string, err error) {
+	f.reporter.checked(rec, outcome, err)
+	f.out.Flush()
+}
+
+func (f *flushing) finish() {
+	f.reporter.finish()
+	f.out.Flush()
+}
+
+// textReporter prints the human-readable state after every line
+type textReporter struct {
+	out    io.Writer
+	wallet *services.Wallet
+	name   string
+	dryRun bool
+	failed []string // diagnostics for every failing line, listed at the end of a dry run
+}
+
+// position formats the file:line prefix of a diagnostic
+func (r *textReporter) position(rec record) string {
+	return fmt.Sprintf("%s:%d", r.name, rec.line)
+}
+
+func (r *textReporter) invalid(rec record) {
+	fmt.Fprintf(r.out, "%s: Error: %s\n", r.position(rec), rec.err)
+	r.failed = append(r.failed, fmt.Sprintf("%s: %s", r.position(rec), rec.err))
+}
+
+func (r *textReporter) processed(rec record, committed *models.Transaction, err error) {
+	if err != nil {
+		fmt.Fprintf(r.out, "%s: Transaction failed: %s\n", r.position(rec), err)
+		r.failed = append(r.failed, fmt.Sprintf("%s: %s", r.position(rec), err))
+	} else {
+		writeCoins(r.out, "   ", *committed)
+	}
+
+	fmt.Fprintf(r.out, "   State: %s\n", r.wallet)
+}
+
+func (r *textReporter) checked(rec record, outcome string, err error) {
+	if err != nil {
+		fmt.Fprintf(r.out, "%s: %s\n", r.position(rec), err)
+		r.failed = append(r.failed, fmt.Sprintf("%s: %s", r.position(rec), err))
+		return
+	}
+
+	fmt.Fprintf(r.out, "%s: %s\n", r.position(rec), outcome)
+}
+
+func (r *textReporter) finish() {
+	fmt.Fprintln(r.out)
+	if !r.dryRun {
+		fmt.Fprintf(r.out, "Final Balance: %s\n", r.wallet)
+		return
+	}
+
+	fmt.Fprintln(r.out, "Dry run: no changes were made")
+	if len(r.failed) == 0 {
+		fmt.Fprintln(r.out, "All lines would succeed")
+	} else {
+		fmt.Fprintf(r.out, "%d line(s) would fail:\n", len(r.failed))
+		for _, failure := range r.failed {
+			fmt.Fprintf(r.out, "  %s\n", failure)
+		}
+	}
+	fmt.Fprintf(r.out, "Projected Balance: %s\n", r.wallet)
+}
+
+// lineResult is the JSON Lines output for one input record
+type lineResult struct {
+	Line        int                     `json:"line"`
+	Status      string                  `json:"status"` // "ok" or "error"
+	ErrorCode   string                  `json:"error_code,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	Directive   string                  `json:"directive,omitempty"`
+	Outcome     string                  `json:"outcome,omitempty"`
+	Transaction *models.Transaction     `json:"transaction,omitempty"`
+	Balances    map[models.Asset]string `json:"balances"`
+}
+
+// jsonlReporter emits one lineResult object per record
+type jsonlReporter struct {
+	encoder *json.Encoder
+	wallet  *services.Wallet
+}
+
+func (r *jsonlReporter) invalid(rec record) {
+	r.encoder.Encode(lineResult{
+		Line:      rec.line,
+		Status:    "error",
+		ErrorCode: models.ErrorCode(rec.err),
+		Error:     rec.err.Error(),
+		Balances:  formatBalances(r.wallet.GetAllBalances()),
+	})
+}
+
+func (r *jsonlReporter) processed(rec record, committed *models.Transaction, err error) {
+	if err != nil {
+		r.encoder.Encode(lineResult{
+			Line:        rec.line,
+			Status:      "error",
+			ErrorCode:   models.ErrorCode(err),
+			Error:       err.Error(),
+			Transaction: &rec.tx,
+			Balances:    formatBalances(r.wallet.GetAllBalances()),
+		})
+		return
+	}
+
+	// Report the committed entry so the assigned ID and timestamp are included,
+	// with the balances right after it even when a batch committed later lines
+	balances, _ := r.wallet.BalancesAfter(committed.ID)
+	r.encoder.Encode(lineResult{
+		Line:        rec.line,
+		Status:      "ok",
+		Transaction: committed,
+		Balances:    formatBalances(balances),
+	})
+}
+
+func (r *jsonlReporter) checked(rec record, outcome string, err error) {
+	result := lineResult{
+		Line:      rec.line,
+		Status:    "ok",
+		Directive: rec.directive.text,
+		Outcome:   outcome,
+		Balances:  formatBalances(r.wallet.GetAllBalances()),
+	}
+	if err != nil {
+		result.Status = "error"
+		result.ErrorCode = models.ErrorCode(err)
+		result.Error = err.Error()
+	}
+	r.encoder.Encode(result)
+}
+
+func (r *jsonlReporter) finish() {}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestRunFile_JSONLOutput(t *testing.T) {
+	input := "DEPOSIT BTC 1.5\nWITHDRAW BTC 2\nTRANSFER BTC 1\n"
+	var out bytes.Buffer
+
+	_, err := runFile(services.NewWallet(), strings.NewReader(input), &out, fileOptions{format: "text", output: "jsonl"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 result lines, got %d: %s", len(lines), out.String())
+	}
+
+	expected := []struct {
+		line   int
+		status string
+		code   string
+		btc    string
+	}{
+		{1, "ok", "", "1.50000000"},
+		{2, "error", "INSUFFICIENT_FUNDS", "1.50000000"},
+		{3, "error", "INVALID_TYPE", "1.50000000"},
+	}
+
+	for i, want := range expected {
+		var got lineResult
+		if err := json.Unmarshal([]byte(lines[i]), &got); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v", i+1, err)
+		}
+		if got.Line != want.line || got.Status != want.status || got.ErrorCode != want.code {
+			t.Errorf("Result %d: expected line=%d status=%s code=%q, got %+v", i, want.line, want.status, want.code, got)
+		}
+		if got.Balances["BTC"] != want.btc {
+			t.Errorf("Result %d: expected BTC balance %s, got %s", i, want.btc, got.Balances["BTC"])
+		}
+	}
+}
+
+func TestRunFile_JSONLInput(t *testing.T) {
+	input := `{"type":"DEPOSIT","asset":"USD","amount":"10.25","memo":"tip"}` + "\n\n" +
+		`{"type":"WITHDRAW","asset":"USD","amount":"0.25"}` + "\n"
+	wallet := services.NewWallet()
+	var out bytes.Buffer
+
+	_, err := runFile(wallet, strings.NewReader(input), &out, fileOptions{format: "jsonl", output: "text"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if balance := wallet.GetAllBalances()["USD"]; balance != 1000 {
+		t.Errorf("Expected USD balance 1000, got %d", balance)
+	}
+	if memo := wallet.GetTransactionHistory()[0].Memo; memo != "tip" {
+		t.Errorf("Expected memo tip, got %s", memo)
+	}
+}
+
+func TestRunFile_AtomicRejectsWholeFile(t *testing.T) {
+	input := "DEPOSIT BTC 1\nWITHDRAW BTC 2\nDEPOSIT XRP 1\nDEPOSIT USD 5\n"
+	wallet := services.NewWallet()
+	var out bytes.Buffer
+
+	_, err := runFile(wallet, strings.NewReader(input), &out, fileOptions{format: "text", output: "jsonl", atomic: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(wallet.GetTransactionHistory()) != 0 {
+		t.Errorf("Expected nothing committed, got %d transactions", len(wallet.GetTransactionHistory()))
+	}
+
+	expectedCodes := []string{"BATCH_REJECTED", "INSUFFICIENT_FUNDS", "INVALID_ASSET", "BATCH_REJECTED"}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expectedCodes) {
+		t.Fatalf("Expected %d result lines, got %d", len(expectedCodes), len(lines))
+	}
+	for i, code := range expectedCodes {
+		var got lineResult
+		json.Unmarshal([]byte(lines[i]), &got)
+		if got.ErrorCode != code {
+			t.Errorf("Line %d: expected code %s, got %s", i+1, code, got.ErrorCode)
+		}
+	}
+}
+
+func TestRunFile_AtomicCommitsWholeFile(t *testing.T) {
+	input := "DEPOSIT BTC 1\nWITHDRAW BTC 0.25\n"
+	wallet := services.NewWallet()
+	var out bytes.Buffer
+
+	_, err := runFile(wallet, strings.NewReader(input), &out, fileOptions{format: "text", output: "jsonl", atomic: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var first lineResult
+	json.Unmarshal([]byte(lines[0]), &first)
+	if first.Status != "ok" || first.Balances["BTC"] != "1.00000000" {
+		t.Errorf("Expected first line to report balances right after it, got %+v", first)
+	}
+	if wallet.GetBalance("BTC") != 75000000 {
+		t.Errorf("Expected BTC balance 75000000, got %d", wallet.GetBalance("BTC"))
+	}
+}
+
+func TestRunFile_JSONLOutputScoped(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000000})
+	ac, err := services.NewAccessControl(services.User{Name: "dora", Role: services.RoleDepositor, Accounts: []models.Asset{models.USD}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.EnableAccessControl(ac); err != nil {
+		t.Fatal(err)
+	}
+	dora, err := wallet.As("dora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	for _, atomic := range []bool{false, true} {
+		out.Reset()
+		_, err := runFile(dora, strings.NewReader("DEPOSIT USD 5\n"), &out, fileOptions{format: "text", output: "jsonl", atomic: atomic})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var got lineResult
+		json.Unmarshal(out.Bytes(), &got)
+		if got.Status != "ok" || got.Transaction == nil || got.Transaction.Principal != "dora" {
+			t.Errorf("Expected the entry recorded for dora, got %+v", got)
+		}
+		if _, ok := got.Balances["BTC"]; ok || got.Balances["USD"] == "" {
+			t.Errorf("Expected only the USD balance, got %v", got.Balances)
+		}
+	}
+}
+
+func TestRunFile_DryRun(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1000})
+	var out bytes.Buffer
+
+	input := "WITHDRAW USD 4\nWITHDRAW USD 7\nDEPOSIT BTC 1\n"
+	_, err := runFile(wallet, strings.NewReader(input), &out, fileOptions{name: "pay.txt", format: "text", output: "text", dryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(wallet.GetTransactionHistory()) != 1 || wallet.GetBalance(models.USD) != 1000 {
+		t.Error("Expected dry run not to change the wallet")
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Dry run: no changes were made",
+		"1 line(s) would fail:",
+		"pay.txt:2: insufficient funds",
+		"Projected Balance: BTC: 1.00000000 | ETH: 0.000000000000000000 | USD: 6.00",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunFile_CommentsDiagnosticsAndSummary(t *testing.T) {
+	input := "# payroll for May\n" +
+		"DEPOSIT USD 100 # opening balance\n" +
+		"\n" +
+		"WITHDRAW USD 500\n" +
+		"DEPOSIT XRP 1\n" +
+		"WITHDRAW USD 40\n"
+	var out bytes.Buffer
+
+	summary, err := runFile(services.NewWallet(), strings.NewReader(input), &out, fileOptions{name: "may.txt", format: "text", output: "text"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if summary.processed != 4 || summary.succeeded != 2 || summary.failed != 2 {
+		t.Errorf("Expected 4 processed, 2 succeeded, 2 failed, got %+v", summary)
+	}
+	if summary.byCode["INSUFFICIENT_FUNDS"] != 1 || summary.byCode["INVALID_ASSET"] != 1 {
+		t.Errorf("Unexpected failures per code: %v", summary.byCode)
+	}
+
+	output := out.String()
+	for _, want := range []string{"may.txt:4: Transaction failed: insufficient funds", "may.txt:5: Error: invalid asset"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	var report bytes.Buffer
+	summary.write(&report)
+	expected := "Summary: 4 processed, 2 succeeded, 2 failed\n  INSUFFICIENT_FUNDS: 1\n  INVALID_ASSET: 1\n"
+	if report.String() != expected {
+		t.Errorf("Expected summary:\n%s\ngot:\n%s", expected, report.String())
+	}
+}
+
+func TestRunFile_StreamsResultsPerLine(t *testing.T) {
+	input, feed := io.Pipe()
+	results, output := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		out := bufio.NewWriter(output)
+		_, err := runFile(services.NewWallet(), input, out, fileOptions{name: "stdin", format: "jsonl", output: "jsonl"})
+		output.Close()
+		done <- err
+	}()
+
+	// Each result must be readable while the input is still open
+	lines := bufio.NewReader(results)
+	for i, tx := range []string{`{"type":"DEPOSIT","asset":"BTC","amount":"1"}`, `{"type":"WITHDRAW","asset":"BTC","amount":"5"}`} {
+		fmt.Fprintln(feed, tx)
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected a result for line %d before the input ended, got: %v", i+1, err)
+		}
+		var got lineResult
+		if err := json.Unmarshal([]byte(line), &got); err != nil || got.Line != i+1 {
+			t.Errorf("Expected the result of line %d, got %q (%v)", i+1, line, err)
+		}
+	}
+
+	feed.Close()
+	io.Copy(io.Discard, results)
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestRunFile_VeryLongLine(t *testing.T) {
+	// Far beyond bufio.Scanner's default 64 KiB token limit
+	memo := strings.Repeat("x", 1<<20)
+	input := `{"type":"DEPOSIT","asset":"USD","amount":"1","memo":"` + memo + `"}` + "\nDEPOSIT\n"
+	wallet := services.NewWallet()
+
+	summary, err := runFile(wallet, strings.NewReader(input), io.Discard, fileOptions{format: "jsonl", output: "jsonl"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if summary.processed != 2 || summary.succeeded != 1 {
+		t.Errorf("Expected 2 lines with 1 success, got %+v", summary)
+	}
+	if history := wallet.GetTransactionHistory(); len(history) != 1 || len(history[0].Memo) != len(memo) {
+		t.Errorf("Expected the long memo to be kept intact")
+	}
+}
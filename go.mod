@@ -1,3 +1,11 @@
 module github.com/fraidev/hedix-wallet
 
 go 1.25.3
+
+require (
+	golang.org/x/crypto v0.54.0
+	golang.org/x/term v0.45.0
+	golang.org/x/text v0.40.0
+)
+
+require golang.org/x/sys v0.47.0 // indirect
@@ -1,95 +1,604 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"golang.org/x/term"
+
 	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
 	"github.com/fraidev/hedix-wallet/services"
+	"github.com/fraidev/hedix-wallet/storage"
+)
+
+// Exit statuses
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command ran but something it processed failed
+	exitUsage   = 2 // the command line itself is wrong
+)
+
+// Files inside the data directory
+const (
+	journalFile   = "journal.jsonl"  // the ledger
+	approvalsFile = "approvals.json" // approval requests
+	keysFile      = "keys.json"      // API keys of serve
+	vaultFile     = "wallet.key"     // data key of an encrypted wallet, wrapped under the passphrase
+	seedFile      = "seed.enc"       // BIP39 seed of the wallet's keys, encrypted
+	addressesFile = "addresses.json" // receive addresses derived from the seed, encrypted
+	allowlistFile = "allowlist.json" // allowlisted withdrawal destinations
 )
 
 func main() {
-	// Create wallet
-	wallet := services.NewWallet()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	// Check if user wants to use file or interactive mode (default)
-	if len(os.Args) > 1 && os.Args[1] == "--file" {
-		pathName := os.Args[2]
-		file, err := os.Open(pathName)
-		if err != nil {
-			log.Fatalf("Error reading file: %v", err)
+// command is one subcommand of the CLI
+type command struct {
+	name    string
+	args    string // positional arguments, for usage text
+	summary string
+	minArgs int
+	maxArgs int // -1 for no limit
+	// setup registers the command's own flags and returns the function
+	// that runs it once the command line has been parsed
+	setup func(fs *flag.FlagSet, app *app) func(args []string) error
+}
+
+// commands lists every subcommand in the order shown by usage
+var commands = []command{
+	{"run", "<file>", "process a transaction file, or standard input when file is -", 1, 1, setupRun},
+	{"repl", "", "start the interactive mode (the default)", 0, 0, setupRepl},
+	{"balance", "[ASSET]", "show all balances, or the balance of one asset", 0, 1, setupBalance},
+	{"history", "", "list ledger entries", 0, 0, setupHistory},
+	{"import", "<file>", "commit every transaction in a file, or none of them", 1, 1, setupImport},
+	{"export", "<file>", "write the full ledger to a file", 1, 1, setupExport},
+	{"verify", "", "check the stored ledger for inconsistencies", 0, 0, setupVerify},
+	{"serve", "", "serve the wallet over HTTP", 0, 0, setupServe},
+	{"pending", "", "list transactions waiting for approval", 0, 0, setupPending},
+	{"approve", "<request>", "approve a pending transaction", 1, 1, setupDecision(true)},
+	{"reject", "<request>", "reject a pending transaction", 1, 1, setupDecision(false)},
+	{"keys", "<create|list|revoke> [id]", "manage the API keys of serve", 1, 2, setupKeys},
+	{"encrypt", "", "encrypt the stored wallet with a passphrase", 0, 0, setupEncrypt},
+	{"passphrase", "", "change the passphrase of an encrypted wallet", 0, 0, setupPassphrase},
+	{"seed", "<create|restore|xpub> [asset]", "generate the wallet's seed, restore it from a mnemonic, or export an account's xpub", 1, 2, setupSeed},
+	{"address", "<new|list> [ASSET]", "generate a receive address, or list them with what they received", 1, 2, setupAddress},
+	{"allowlist", "<add|remove|list> [ASSET] [address]", "manage the withdrawal destinations of accounts that require them", 1, 3, setupAllowlist},
+	{"utxos", "", "list the unspent BTC outputs and check them against the balance", 0, 0, setupUTXOs},
+}
+
+// globals are the flags accepted before and after any command
+type globals struct {
+	dataDir    string
+	output     string
+	configPath string
+	user       string
+}
+
+func (g *globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.dataDir, "data-dir", "", "directory holding the wallet's ledger; without it the wallet lives in memory")
+	fs.StringVar(&g.output, "output", "text", "output format: text or json")
+	fs.StringVar(&g.configPath, "config", os.Getenv("HEDIX_CONFIG"), "JSON configuration file (default $HEDIX_CONFIG)")
+	fs.StringVar(&g.user, "user", os.Getenv("HEDIX_USER"), "user to act as when the config file defines users (default $HEDIX_USER)")
+}
+
+// app carries the parsed global settings into the commands
+type app struct {
+	globals
+	policy    *services.Policy          // from the configuration file; nil for none
+	approval  *services.ApprovalConfig  // from the configuration file; nil when approvals are off
+	access    *services.AccessControl   // from the configuration file; nil when it defines no users
+	allowlist *services.AllowlistConfig // from the configuration file; nil when no account opted in
+	coins     *services.CoinSelection   // from the configuration file; nil for oldest first without fees
+	cipher    *storage.Cipher           // data key of an encrypted wallet, once unlocked
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+// usageError is a malformed command line; it is reported with usage text
+type usageError struct {
+	command string // "" for the top-level usage
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+// exitError ends the program with a status but no message of its own,
+// for commands that already reported what went wrong
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// run executes the command line and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	err := execute(args, stdin, stdout, stderr)
+
+	var usage *usageError
+	var exit *exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usage):
+		fmt.Fprintf(stderr, "Error: %s\n\n", usage.message)
+		writeUsage(stderr, usage.command)
+		return exitUsage
+	case errors.As(err, &exit):
+		return exit.code
+	default:
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return exitFailure
+	}
+}
+
+func execute(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args, err := legacyArgs(args)
+	if err != nil {
+		return err
+	}
+
+	a := &app{stdin: stdin, stdout: stdout, stderr: stderr}
+	set := make(map[string]bool)
+
+	top := flag.NewFlagSet("hedix", flag.ContinueOnError)
+	top.SetOutput(io.Discard)
+	a.register(top)
+	if err := top.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			writeUsage(stdout, "")
+			return err
 		}
-		defer file.Close()
+		return &usageError{message: err.Error()}
+	}
+	top.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-		runFile(wallet, file)
-	} else {
-		runInteractive(wallet)
+	// Without a command, a terminal gets the interactive mode and anything
+	// else (a pipe, a redirected file) is streamed through "run -"
+	rest := top.Args()
+	name := "repl"
+	switch {
+	case len(rest) > 0:
+		name, rest = rest[0], rest[1:]
+	case !isTerminal(stdin):
+		name, rest = "run", []string{"-"}
+	}
+	if name == "help" {
+		return help(stdout, rest)
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		return &usageError{message: fmt.Sprintf("unknown command %q", name)}
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	// Registering resets the globals to their defaults; keep the values
+	// already given before the command name
+	given := a.globals
+	a.register(fs)
+	a.globals = given
+	runCmd := cmd.setup(fs, a)
+
+	positional, err := parseInterspersed(fs, rest)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			writeUsage(stdout, cmd.name)
+			return err
+		}
+		return &usageError{command: cmd.name, message: err.Error()}
+	}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	switch {
+	case len(positional) < cmd.minArgs:
+		return &usageError{command: cmd.name, message: fmt.Sprintf("%s: missing argument %s", cmd.name, cmd.args)}
+	case cmd.maxArgs >= 0 && len(positional) > cmd.maxArgs:
+		return &usageError{command: cmd.name, message: fmt.Sprintf("%s: too many arguments", cmd.name)}
 	}
+
+	if err := a.applyConfig(set); err != nil {
+		return err
+	}
+	return runCmd(positional)
 }
 
-func runFile(wallet *services.Wallet, file *os.File) {
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		input := scanner.Text()
-		tx, err := models.ParseTransaction(input)
-		if err != nil {
-			fmt.Printf("Error: %s\n", err)
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, which are returned in order. "--" ends the flags
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Parse stops at the first positional argument, or right after "--"
+		if stop := len(args) - len(rest) - 1; stop >= 0 && args[stop] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// legacyArgs rewrites the old "--file <path> [flags]" invocation as
+// "run <path> [flags]" so existing scripts keep working
+func legacyArgs(args []string) ([]string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "file" {
 			continue
 		}
+		rest := append([]string{}, args[:i]...)
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, &usageError{command: "run", message: "flag needs an argument: --file"}
+			}
+			value = args[i+1]
+			rest = append(rest, args[i+2:]...)
+		} else {
+			rest = append(rest, args[i+1:]...)
+		}
+		return append([]string{"run", value}, rest...), nil
+	}
+	return args, nil
+}
 
-		err = wallet.ProcessTransaction(tx)
+// applyConfig fills every global flag that was not given on the command
+// line from the configuration file, then validates the result
+func (a *app) applyConfig(set map[string]bool) error {
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		return err
+	}
+	if !set["data-dir"] && cfg.DataDir != "" {
+		a.dataDir = cfg.DataDir
+	}
+	if !set["output"] && cfg.Output != "" {
+		a.output = cfg.Output
+	}
+	if len(cfg.Policy) > 0 {
+		if a.policy, err = services.ParsePolicy(cfg.Policy); err != nil {
+			return fmt.Errorf("config %s: %w", a.configPath, err)
+		}
+	}
+	if cfg.Approval != nil {
+		approval, err := cfg.Approval.walletConfig()
 		if err != nil {
-			fmt.Printf("Transaction failed: %s\n", err)
+			return fmt.Errorf("config %s: %w", a.configPath, err)
 		}
-
-		fmt.Printf("   State: %s\n", wallet)
+		a.approval = &approval
+	}
+	if cfg.Allowlist != nil {
+		allowlist, err := cfg.Allowlist.walletConfig()
+		if err != nil {
+			return fmt.Errorf("config %s: %w", a.configPath, err)
+		}
+		a.allowlist = &allowlist
+	}
+	if cfg.Coins != nil {
+		coins, err := cfg.Coins.walletConfig()
+		if err != nil {
+			return fmt.Errorf("config %s: %w", a.configPath, err)
+		}
+		a.coins = &coins
+	}
+	if len(cfg.Users) > 0 {
+		if a.access, err = accessControl(cfg.Users); err != nil {
+			return fmt.Errorf("config %s: %w", a.configPath, err)
+		}
+		if a.user == "" {
+			return &usageError{message: "the config file defines users: requires --user NAME (or $HEDIX_USER)"}
+		}
+	} else if set["user"] {
+		return &usageError{message: "--user requires users in the config file"}
 	}
 
-	fmt.Println()
-	fmt.Printf("Final Balance: %s\n", wallet)
+	switch a.output {
+	case "text", "json":
+	case "jsonl":
+		a.output = "json"
+	default:
+		return &usageError{message: fmt.Sprintf("unknown output format %q. Must be text or json", a.output)}
+	}
+	return nil
 }
 
-func runInteractive(wallet *services.Wallet) {
-	fmt.Println("Interactive Mode - Enter transactions")
-	fmt.Println("Format: <DEPOSIT|WITHDRAW> <BTC|ETH|USD> <amount>")
-	fmt.Println("Example: DEPOSIT BTC 1.5")
-	fmt.Println()
-	fmt.Printf("Current State: %s\n", wallet)
-	fmt.Println()
+// openWallet opens the wallet persisted in the data directory, or an
+// in-memory wallet when there is none, with the configured policy,
+// approval workflow, withdrawal allowlist and coin selection, and its
+// receive addresses once it has a seed. When the configuration defines users, the wallet
+// acts as --user
+func (a *app) openWallet() (*services.Wallet, error) {
+	wallet, err := a.loadWallet()
+	if err != nil {
+		return nil, err
+	}
+	wallet.SetPolicy(a.policy)
+
+	if a.approval != nil {
+		var store services.ApprovalStore
+		if a.dataDir != "" {
+			if store, err = a.openApprovalFile(); err != nil {
+				return nil, err
+			}
+		}
+		if err := wallet.EnableApprovals(*a.approval, store); err != nil {
+			return nil, err
+		}
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
+	if a.allowlist != nil || a.dataDir != "" {
+		var store services.AllowlistStore
+		if a.dataDir != "" {
+			if store, err = a.openAllowlistFile(); err != nil {
+				return nil, err
+			}
+		}
+		cfg := services.AllowlistConfig{}
+		if a.allowlist != nil {
+			cfg = *a.allowlist
+		}
+		if err := wallet.EnableAllowlist(cfg, store); err != nil {
+			return nil, err
+		}
+	}
 
-	for {
-		fmt.Print("> ")
-		if !scanner.Scan() {
-			break
+	if a.coins != nil {
+		if err := wallet.EnableCoinSelection(*a.coins); err != nil {
+			return nil, err
 		}
+	}
 
-		input := strings.TrimSpace(scanner.Text())
+	if a.dataDir != "" {
+		if _, err := os.Stat(filepath.Join(a.dataDir, seedFile)); err == nil {
+			store := storage.OpenAddressFile(filepath.Join(a.dataDir, addressesFile), a.cipher)
+			if err := wallet.EnableAddresses(a.addressDeriver(), store); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-		if input == "" {
-			continue
+	if a.access != nil {
+		if err := wallet.EnableAccessControl(a.access); err != nil {
+			return nil, err
 		}
+		return wallet.As(a.user)
+	}
+	return wallet, nil
+}
 
-		tx, err := models.ParseTransaction(input)
+// addressDeriver derives receive addresses from the seed of the data
+// directory, which it reads on first use; it keeps only the xpubs of the
+// accounts
+func (a *app) addressDeriver() services.AddressDeriver {
+	accounts := make(map[models.Asset]*seed.ExtendedKey)
+	return func(asset models.Asset, index uint32) (string, string, error) {
+		account, ok := accounts[asset]
+		if !ok {
+			stored, err := storage.LoadSeed(filepath.Join(a.dataDir, seedFile), a.cipher)
+			if err != nil {
+				return "", "", err
+			}
+			private, err := seed.AccountKey(stored, asset)
+			if err != nil {
+				return "", "", err
+			}
+			account = private.Neuter()
+			accounts[asset] = account
+		}
+		address, err := seed.ReceiveAddress(account, asset, index)
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
-			continue
+			return "", "", err
+		}
+		path, _ := seed.AddressPath(asset, index)
+		return address, seed.FormatPath(path), nil
+	}
+}
+
+func (a *app) loadWallet() (*services.Wallet, error) {
+	if a.dataDir == "" {
+		return services.NewWallet(), nil
+	}
+	if err := os.MkdirAll(a.dataDir, 0o700); err != nil {
+		return nil, err
+	}
+	journal, err := a.openJournal()
+	if err != nil {
+		return nil, err
+	}
+	return services.OpenWallet(journal)
+}
+
+// openJournal opens the journal of the data directory, unlocking it first
+// when the wallet is encrypted
+func (a *app) openJournal() (*storage.Journal, error) {
+	path := filepath.Join(a.dataDir, journalFile)
+	cipher, err := a.unlock()
+	if err != nil || cipher == nil {
+		if err == nil {
+			return storage.OpenJournal(path)
 		}
+		return nil, err
+	}
+	return storage.OpenEncryptedJournal(path, cipher)
+}
 
-		err = wallet.ProcessTransaction(tx)
-		if err != nil {
-			fmt.Printf("Transaction failed: %s\n", err)
-		} else {
-			fmt.Println("Transaction successful")
+func (a *app) openApprovalFile() (*storage.ApprovalFile, error) {
+	path := filepath.Join(a.dataDir, approvalsFile)
+	cipher, err := a.unlock()
+	if err != nil || cipher == nil {
+		return storage.OpenApprovalFile(path), err
+	}
+	return storage.OpenEncryptedApprovalFile(path, cipher), nil
+}
+
+func (a *app) openKeyFile() (*storage.KeyFile, error) {
+	path := filepath.Join(a.dataDir, keysFile)
+	cipher, err := a.unlock()
+	if err != nil || cipher == nil {
+		return storage.OpenKeyFile(path), err
+	}
+	return storage.OpenEncryptedKeyFile(path, cipher), nil
+}
+
+func (a *app) openAllowlistFile() (*storage.AllowlistFile, error) {
+	path := filepath.Join(a.dataDir, allowlistFile)
+	cipher, err := a.unlock()
+	if err != nil || cipher == nil {
+		return storage.OpenAllowlistFile(path), err
+	}
+	return storage.OpenEncryptedAllowlistFile(path, cipher), nil
+}
+
+// unlock returns the data key of an encrypted wallet, asking for the
+// passphrase the first time, or nil when the wallet is not encrypted
+func (a *app) unlock() (*storage.Cipher, error) {
+	path := filepath.Join(a.dataDir, vaultFile)
+	if a.cipher != nil || !storage.IsVault(path) {
+		return a.cipher, nil
+	}
+	passphrase, err := a.readPassphrase("HEDIX_PASSPHRASE", "Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if a.cipher, err = storage.UnlockVault(path, passphrase); err != nil {
+		return nil, fmt.Errorf("unlocking %s: %w", path, err)
+	}
+	return a.cipher, nil
+}
+
+// readPassphrase returns the passphrase in the environment variable env,
+// or asks for it when standard input is a terminal
+func (a *app) readPassphrase(env, prompt string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	file, ok := a.stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return "", fmt.Errorf("the wallet is encrypted: set $%s or run from a terminal", env)
+	}
+	fmt.Fprint(a.stderr, prompt)
+	passphrase, err := term.ReadPassword(int(file.Fd()))
+	fmt.Fprintln(a.stderr)
+	return string(passphrase), err
+}
+
+// readNewPassphrase returns the passphrase in the environment variable
+// env, or asks for it twice when standard input is a terminal
+func (a *app) readNewPassphrase(env string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := a.readPassphrase(env, "New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	again, err := a.readPassphrase(env, "Repeat the new passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != again {
+		return "", errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// requireDataDir rejects commands that only make sense on a stored wallet
+func (a *app) requireDataDir(name string) error {
+	if a.dataDir == "" {
+		return &usageError{command: name, message: name + ": requires --data-dir (or data_dir in the config file)"}
+	}
+	return nil
+}
+
+// isTerminal reports whether r is an interactive terminal
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
+	}
+	return command{}, false
+}
 
-		fmt.Printf("Current State: %s\n", wallet)
+// help prints the top-level usage, or the usage of one command
+func help(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		writeUsage(out, "")
+		return nil
 	}
+	if _, ok := findCommand(args[0]); !ok {
+		return &usageError{message: fmt.Sprintf("unknown command %q", args[0])}
+	}
+	writeUsage(out, args[0])
+	return nil
+}
+
+// writeUsage prints the usage of a command, or the top-level usage when
+// name is empty
+func writeUsage(out io.Writer, name string) {
+	global := flag.NewFlagSet("global", flag.ContinueOnError)
+	new(globals).register(global)
 
-	fmt.Println()
-	fmt.Printf("Final Balance: %s\n", wallet)
+	if cmd, ok := findCommand(name); ok {
+		fmt.Fprintf(out, "Usage: %s\n\n%s\n", strings.TrimSpace("hedix "+cmd.name+" [flags] "+cmd.args), capitalize(cmd.summary))
+
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.setup(fs, &app{})
+		if hasFlags(fs) {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.SetOutput(out)
+			fs.PrintDefaults()
+		}
+	} else {
+		fmt.Fprintln(out, "Usage: hedix [global flags] <command> [flags] [arguments]")
+		fmt.Fprintln(out, "\nCommands:")
+		for _, cmd := range commands {
+			fmt.Fprintf(out, "  %-18s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+		}
+		fmt.Fprintln(out, "\nRun 'hedix help <command>' for the flags of a command.")
+	}
+
+	fmt.Fprintln(out, "\nGlobal flags:")
+	global.SetOutput(out)
+	global.PrintDefaults()
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
 }
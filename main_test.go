@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs the command line with empty standard input and returns its
+// exit status and output
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"legacy file flag without path", []string{"--file"}, "flag needs an argument: --file"},
+		{"unknown command", []string{"bogus"}, `unknown command "bogus"`},
+		{"missing argument", []string{"run"}, "run: missing argument <file>"},
+		{"too many arguments", []string{"--data-dir", t.TempDir(), "balance", "BTC", "ETH"}, "balance: too many arguments"},
+		{"unknown flag", []string{"history", "--bogus"}, "flag provided but not defined: -bogus"},
+		{"missing data dir", []string{"balance"}, "balance: requires --data-dir"},
+		{"bad output", []string{"--output", "xml", "run", "x.txt"}, `unknown output format "xml"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLI(t, tt.args...)
+			if code != exitUsage {
+				t.Errorf("Expected exit status %d, got %d", exitUsage, code)
+			}
+			if !strings.Contains(stderr, tt.want) || !strings.Contains(stderr, "Usage: hedix") {
+				t.Errorf("Expected %q followed by usage, got: %s", tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRun_PersistsAcrossCommands(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT BTC 1.5\nWITHDRAW BTC 0.5\n")
+
+	// Flags may come before or after the command and its arguments
+	if code, _, stderr := runCLI(t, "run", script, "--data-dir", dataDir); code != exitOK {
+		t.Fatalf("Expected run to succeed, got %d: %s", code, stderr)
+	}
+
+	code, stdout, _ := runCLI(t, "--data-dir", dataDir, "balance", "btc")
+	if code != exitOK || stdout != "BTC: 1.00000000\n" {
+		t.Errorf("Expected the balance to persist, got %d: %q", code, stdout)
+	}
+
+	_, stdout, _ = runCLI(t, "--data-dir", dataDir, "history", "--limit", "1")
+	if !strings.Contains(stdout, "WITHDRAW") || strings.Contains(stdout, "DEPOSIT") {
+		t.Errorf("Expected only the last entry, got: %s", stdout)
+	}
+
+	if code, stdout, _ := runCLI(t, "--data-dir", dataDir, "verify"); code != exitOK || !strings.Contains(stdout, "OK: 2 entries verified") {
+		t.Errorf("Expected verify to pass, got %d: %s", code, stdout)
+	}
+}
+
+func TestRun_LegacyFileFlag(t *testing.T) {
+	script := writeFile(t, t.TempDir(), "txs.txt", "DEPOSIT USD 10\nWITHDRAW USD 20\n")
+
+	code, stdout, _ := runCLI(t, "--file", script)
+	if code != exitFailure {
+		t.Errorf("Expected exit status %d for a failing line, got %d", exitFailure, code)
+	}
+	if !strings.Contains(stdout, "Summary: 2 processed, 1 succeeded, 1 failed") {
+		t.Errorf("Expected the file to be processed, got: %s", stdout)
+	}
+}
+
+func TestRun_ImportExport(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT ETH 2\nWITHDRAW ETH 0.5\n")
+	exported := filepath.Join(dir, "ledger.csv")
+
+	runCLI(t, "--data-dir", source, "run", script)
+	if code, _, stderr := runCLI(t, "--data-dir", source, "export", exported); code != exitOK {
+		t.Fatalf("Expected export to succeed, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", target, "import", exported); code != exitOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", code, stderr)
+	}
+
+	// Importing again collides with every ID, so nothing is committed
+	code, _, stderr := runCLI(t, "--data-dir", target, "import", exported)
+	if code != exitFailure || !strings.Contains(stderr, "ledger.csv:2: Transaction failed: duplicate transaction id: 1") {
+		t.Errorf("Expected the duplicate import to fail, got %d: %s", code, stderr)
+	}
+
+	_, stdout, _ := runCLI(t, "--data-dir", target, "--output", "json", "balance", "ETH")
+	if !strings.Contains(stdout, `"ETH": "1.500000000000000000"`) {
+		t.Errorf("Expected the imported balance once, got: %s", stdout)
+	}
+}
+
+func TestRun_ImportRefusesCompensations(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	rows := writeFile(t, dir, "rows.csv", "type,asset,amount,reverses\nWITHDRAW,ETH,4,1\n")
+
+	runCLI(t, "--data-dir", dataDir, "run", writeFile(t, dir, "txs.txt", "DEPOSIT ETH 5\n"))
+	code, _, stderr := runCLI(t, "--data-dir", dataDir, "import", rows)
+	if code != exitFailure || !strings.Contains(stderr, "reverses") {
+		t.Errorf("Expected the forged compensation to be refused, got %d: %s", code, stderr)
+	}
+
+	_, stdout, _ := runCLI(t, "--data-dir", dataDir, "--output", "json", "balance", "ETH")
+	if !strings.Contains(stdout, `"ETH": "5.000000000000000000"`) {
+		t.Errorf("Expected the balance to be untouched, got: %s", stdout)
+	}
+}
+
+func TestRun_ConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	config := writeFile(t, dir, "config.json", `{"data_dir": "`+dataDir+`", "output": "json"}`)
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT USD 3\n")
+
+	runCLI(t, "--config", config, "run", script)
+
+	_, stdout, _ := runCLI(t, "--config", config, "balance", "USD")
+	if !strings.Contains(stdout, `"USD": "3.00"`) {
+		t.Errorf("Expected JSON output in the configured data dir, got: %s", stdout)
+	}
+
+	// Flags take precedence over the configuration file
+	_, stdout, _ = runCLI(t, "--config", config, "--output", "text", "balance", "USD")
+	if stdout != "USD: 3.00\n" {
+		t.Errorf("Expected the --output flag to win, got: %q", stdout)
+	}
+}
+
+func TestRun_ConfigPolicy(t *testing.T) {
+	dir := t.TempDir()
+	config := writeFile(t, dir, "config.json", `{"policy": ["WITHDRAW USD > 100 requires approval"]}`)
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT USD 500\nWITHDRAW USD 200\n")
+
+	code, stdout, _ := runCLI(t, "--config", config, "run", script)
+	if code != exitFailure || !strings.Contains(stdout, "rejected by rule WITHDRAW USD > 100 requires approval") {
+		t.Errorf("Expected the withdrawal to be rejected by the policy, got %d: %s", code, stdout)
+	}
+
+	bad := writeFile(t, dir, "bad.json", `{"policy": ["WITHDRAW USD > 100"]}`)
+	if code, _, stderr := runCLI(t, "--config", bad, "run", script); code != exitFailure || !strings.Contains(stderr, "policy rule 1") {
+		t.Errorf("Expected an invalid rule to be reported, got %d: %s", code, stderr)
+	}
+}
+
+func TestRun_Approvals(t *testing.T) {
+	dir := t.TempDir()
+	config := writeFile(t, dir, "config.json", `{
+		"data_dir": "`+filepath.Join(dir, "data")+`",
+		"users": {"ops": {"role": "withdrawer"}, "alice": {"role": "viewer"}, "bob": {"role": "viewer"}},
+		"approval": {"approvers": ["ops", "alice", "bob"], "required": 2, "thresholds": {"USD": "100"}, "timeout": "24h"}
+	}`)
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT USD 500\nWITHDRAW USD 200\n")
+
+	runCLI(t, "--config", config, "--user", "ops", "run", script)
+	_, stdout, _ := runCLI(t, "--config", config, "--user", "alice", "pending")
+	if !strings.Contains(stdout, "A1 ") || !strings.Contains(stdout, "0/2 approvals") {
+		t.Fatalf("Expected A1 to be pending, got: %s", stdout)
+	}
+
+	if code, _, stderr := runCLI(t, "--config", config, "approve", "A1"); code != exitUsage || !strings.Contains(stderr, "requires --user") {
+		t.Errorf("Expected approve without --user to be a usage error, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCLI(t, "--config", config, "--user", "ops", "approve", "A1"); code != exitFailure || !strings.Contains(stderr, "SELF_APPROVAL") && !strings.Contains(stderr, "may not approve") {
+		t.Errorf("Expected the submitter's approval to be refused, got %d: %s", code, stderr)
+	}
+	_, stdout, _ = runCLI(t, "--config", config, "--user", "alice", "approve", "A1")
+	if stdout != "Request A1: 1 of 2 approvals\n" {
+		t.Errorf("Expected one approval recorded, got: %q", stdout)
+	}
+	_, stdout, _ = runCLI(t, "--config", config, "--user", "bob", "approve", "A1")
+	if stdout != "Request A1 approved: committed as entry 2\n" {
+		t.Errorf("Expected A1 to be committed, got: %q", stdout)
+	}
+
+	_, stdout, _ = runCLI(t, "--config", config, "--user", "ops", "balance", "USD")
+	if stdout != "USD: 300.00\n" {
+		t.Errorf("Expected the approved withdrawal in the balance, got: %q", stdout)
+	}
+}
+
+func TestRun_Users(t *testing.T) {
+	dir := t.TempDir()
+	config := writeFile(t, dir, "config.json", `{
+		"data_dir": "`+filepath.Join(dir, "data")+`",
+		"users": {"ops": {"role": "admin"}, "cashier": {"role": "depositor", "accounts": ["USD"]}}
+	}`)
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT USD 500\nWITHDRAW USD 200\n")
+
+	if code, _, stderr := runCLI(t, "--config", config, "balance"); code != exitUsage || !strings.Contains(stderr, "requires --user") {
+		t.Errorf("Expected a missing user to be a usage error, got %d: %s", code, stderr)
+	}
+
+	code, stdout, _ := runCLI(t, "--config", config, "--user", "cashier", "run", script)
+	if code != exitFailure || !strings.Contains(stdout, "cashier may not withdraw") {
+		t.Errorf("Expected the withdrawal to be forbidden, got %d: %s", code, stdout)
+	}
+	if _, stdout, _ := runCLI(t, "--config", config, "--user", "cashier", "balance"); stdout != "USD: 500.00\n" {
+		t.Errorf("Expected only the USD balance, got: %q", stdout)
+	}
+	if code, _, stderr := runCLI(t, "--config", config, "--user", "cashier", "balance", "BTC"); code != exitFailure || !strings.Contains(stderr, "permission denied") {
+		t.Errorf("Expected the BTC balance to be forbidden, got %d: %s", code, stderr)
+	}
+
+	_, stdout, _ = runCLI(t, "--config", config, "--user", "ops", "--output", "json", "history")
+	if !strings.Contains(stdout, `"principal": "cashier"`) && !strings.Contains(stdout, `"principal":"cashier"`) {
+		t.Errorf("Expected the entry to name cashier, got: %s", stdout)
+	}
+}
+
+func TestRun_Keys(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+
+	if code, _, stderr := runCLI(t, "--data-dir", data, "serve", "--addr", "127.0.0.1:0"); code != exitFailure || !strings.Contains(stderr, "--insecure") {
+		t.Errorf("Expected serve to refuse to start without keys, got %d: %s", code, stderr)
+	}
+
+	code, stdout, _ := runCLI(t, "--data-dir", data, "keys", "create", "--accounts", "USD", "--operations", "view,deposit", "--expires", "24h")
+	if code != exitOK || !strings.Contains(stdout, "Secret: k") {
+		t.Fatalf("Expected a key to be created, got %d: %s", code, stdout)
+	}
+	id := strings.TrimPrefix(strings.SplitN(stdout, "\n", 2)[0], "Created key ")
+
+	_, stdout, _ = runCLI(t, "--data-dir", data, "keys", "list")
+	if !strings.Contains(stdout, id+" ") || !strings.Contains(stdout, "active") || !strings.Contains(stdout, "view,deposit") {
+		t.Errorf("Expected the key to be listed, got: %s", stdout)
+	}
+	if stored, _ := os.ReadFile(filepath.Join(data, keysFile)); strings.Contains(string(stored), "Secret") {
+		t.Errorf("Expected no secret in the key file")
+	}
+
+	if _, stdout, _ = runCLI(t, "--data-dir", data, "keys", "revoke", id); stdout != "Revoked key "+id+"\n" {
+		t.Errorf("Expected the key to be revoked, got: %q", stdout)
+	}
+	if _, stdout, _ = runCLI(t, "--data-dir", data, "keys", "list"); !strings.Contains(stdout, "revoked") {
+		t.Errorf("Expected the key to be listed as revoked, got: %s", stdout)
+	}
+
+	if code, _, stderr := runCLI(t, "--data-dir", data, "keys", "create", "--operations", "launch"); code != exitUsage || !strings.Contains(stderr, "unknown operation") {
+		t.Errorf("Expected an unknown operation to be a usage error, got %d: %s", code, stderr)
+	}
+}
+
+func TestRun_Encrypt(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	script := writeFile(t, dir, "txs.txt", "DEPOSIT USD 500\n")
+	runCLI(t, "--data-dir", data, "run", script)
+
+	runCLI(t, "--data-dir", data, "keys", "create")
+	t.Setenv("HEDIX_NEW_PASSPHRASE", "first")
+	if code, stdout, stderr := runCLI(t, "--data-dir", data, "encrypt"); code != exitOK || !strings.Contains(stdout, "Encrypted") {
+		t.Fatalf("Expected the wallet to be encrypted, got %d: %s%s", code, stdout, stderr)
+	}
+	if journal, _ := os.ReadFile(filepath.Join(data, journalFile)); strings.Contains(string(journal), "USD") {
+		t.Errorf("Expected no plaintext in the journal, got %s", journal)
+	}
+	if keys, _ := os.ReadFile(filepath.Join(data, keysFile)); strings.Contains(string(keys), "hash") {
+		t.Errorf("Expected no plaintext in the key file, got %s", keys)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", data, "balance", "USD"); code != exitFailure || !strings.Contains(stderr, "HEDIX_PASSPHRASE") {
+		t.Errorf("Expected the wallet to need a passphrase, got %d: %s", code, stderr)
+	}
+
+	t.Setenv("HEDIX_PASSPHRASE", "first")
+	t.Setenv("HEDIX_NEW_PASSPHRASE", "second")
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "passphrase"); stdout != "Passphrase changed\n" {
+		t.Errorf("Expected the passphrase to change, got: %q", stdout)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", data, "balance", "USD"); code != exitFailure || !strings.Contains(stderr, "wrong passphrase") {
+		t.Errorf("Expected the old passphrase to be refused, got %d: %s", code, stderr)
+	}
+
+	t.Setenv("HEDIX_PASSPHRASE", "second")
+	runCLI(t, "--data-dir", data, "run", script)
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "balance", "USD"); stdout != "USD: 1000.00\n" {
+		t.Errorf("Expected the ledger to survive the change, got: %q", stdout)
+	}
+}
+
+func TestRun_Seed(t *testing.T) {
+	data := filepath.Join(t.TempDir(), "data")
+	if code, _, stderr := runCLI(t, "--data-dir", data, "seed", "create"); code != exitFailure || !strings.Contains(stderr, "not encrypted") {
+		t.Errorf("Expected a plaintext wallet to be refused a seed, got %d: %s", code, stderr)
+	}
+
+	t.Setenv("HEDIX_NEW_PASSPHRASE", "pass")
+	t.Setenv("HEDIX_PASSPHRASE", "pass")
+	runCLI(t, "--data-dir", data, "encrypt")
+	code, stdout, stderr := runCLI(t, "--data-dir", data, "seed", "create", "--words", "12")
+	if code != exitOK || len(strings.Fields(strings.SplitN(stdout, "\n", 2)[0])) != 12 {
+		t.Fatalf("Expected a 12-word mnemonic, got %d: %s%s", code, stdout, stderr)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", data, "seed", "create"); code != exitFailure || !strings.Contains(stderr, "already has a seed") {
+		t.Errorf("Expected the seed not to be replaced, got %d: %s", code, stderr)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	runCLI(t, "--data-dir", restored, "encrypt")
+	t.Setenv("HEDIX_MNEMONIC", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+	if code, _, stderr := runCLI(t, "--data-dir", restored, "seed", "restore"); code != exitFailure || !strings.Contains(stderr, "checksum") {
+		t.Errorf("Expected an invalid mnemonic to be refused, got %d: %s", code, stderr)
+	}
+	t.Setenv("HEDIX_MNEMONIC", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about")
+	if _, stdout, _ := runCLI(t, "--data-dir", restored, "seed", "restore"); stdout != "Seed restored\n" {
+		t.Errorf("Expected the seed to be restored, got: %q", stdout)
+	}
+	if stored, _ := os.ReadFile(filepath.Join(restored, seedFile)); strings.Contains(string(stored), "abandon") {
+		t.Errorf("Expected the seed file to be encrypted")
+	}
+
+	// The well-known BIP44 account of the "abandon ... about" mnemonic
+	code, stdout, stderr = runCLI(t, "--data-dir", restored, "seed", "xpub", "btc")
+	if want := "BTC m/44'/0'/0'\nxpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj\n"; stdout != want {
+		t.Errorf("Expected the BTC account xpub, got %d: %q%s", code, stdout, stderr)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", restored, "seed", "xpub", "USD"); code != exitFailure || !strings.Contains(stderr, "has no keys") {
+		t.Errorf("Expected USD to have no account key, got %d: %s", code, stderr)
+	}
+	if code, _, _ := runCLI(t, "--data-dir", restored, "seed", "xpub"); code != exitUsage {
+		t.Errorf("Expected a usage error without an asset, got %d", code)
+	}
+}
+
+func TestRun_Address(t *testing.T) {
+	data := filepath.Join(t.TempDir(), "data")
+	t.Setenv("HEDIX_NEW_PASSPHRASE", "pass")
+	t.Setenv("HEDIX_PASSPHRASE", "pass")
+	runCLI(t, "--data-dir", data, "encrypt")
+	if code, _, stderr := runCLI(t, "--data-dir", data, "address", "new", "BTC"); code != exitFailure || !strings.Contains(stderr, "no seed") {
+		t.Errorf("Expected a wallet without a seed to have no addresses, got %d: %s", code, stderr)
+	}
+
+	t.Setenv("HEDIX_MNEMONIC", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about")
+	runCLI(t, "--data-dir", data, "seed", "restore")
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "address", "new", "eth"); stdout != "0x9858EfFD232B4033E47d90003D41EC34EcaEda94\n" {
+		t.Errorf("Expected the first ETH address of the mnemonic, got %q", stdout)
+	}
+	_, stdout, _ := runCLI(t, "--data-dir", data, "address", "new", "BTC")
+	btc := strings.TrimSpace(stdout)
+	if btc != "bc1qmxrw6qdh5g3ztfcwm0et5l8mvws4eva24kmp8m" {
+		t.Fatalf("Expected the native SegWit address of m/44'/0'/0'/0/0, got %q", stdout)
+	}
+
+	script := writeFile(t, t.TempDir(), "deposits.txt", "DEPOSIT BTC 0.5 "+btc+"\nDEPOSIT BTC 0.25 "+strings.ToUpper(btc)+"\nDEPOSIT BTC 1 bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4\n")
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "run", script); !strings.Contains(stdout, "not a receive address") {
+		t.Errorf("Expected a deposit to a foreign address to fail, got: %s", stdout)
+	}
+	_, stdout, _ = runCLI(t, "--data-dir", data, "address", "list", "BTC")
+	if want := "BTC m/44'/0'/0'/0/0    " + btc + "  received 0.75000000 in 2 deposits\n"; stdout != want {
+		t.Errorf("Expected %q, got %q", want, stdout)
+	}
+	if stored, _ := os.ReadFile(filepath.Join(data, addressesFile)); strings.Contains(string(stored), btc) {
+		t.Errorf("Expected the address file to be encrypted")
+	}
+}
+
+func TestRun_Allowlist(t *testing.T) {
+	const destination = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	cooling := writeFile(t, dir, "cooling.json", `{"allowlist": {"accounts": ["ETH"], "cooling_off": "24h"}}`)
+	immediate := writeFile(t, dir, "immediate.json", `{"allowlist": {"accounts": ["eth"]}}`)
+	script := writeFile(t, dir, "withdraw.txt", "DEPOSIT ETH 2\nWITHDRAW ETH 1 "+strings.ToLower(destination)+"\nWITHDRAW ETH 1\nWITHDRAW BTC 1 bc1qnotanaddress\n")
+
+	code, stdout, stderr := runCLI(t, "--data-dir", data, "--config", cooling, "allowlist", "add", "ETH", strings.ToLower(destination), "--label", "cold")
+	if code != exitOK || !strings.Contains(stdout, "Added "+destination+" to the ETH allowlist") {
+		t.Fatalf("Expected the checksummed address to be added, got %d: %s%s", code, stdout, stderr)
+	}
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "--config", cooling, "allowlist", "list"); !strings.Contains(stdout, "cooling off until") || !strings.Contains(stdout, "(cold)") {
+		t.Errorf("Expected the address to be listed as cooling off, got: %s", stdout)
+	}
+	_, stdout, _ = runCLI(t, "--data-dir", data, "--config", cooling, "run", script)
+	for _, code := range []string{"COOLING_OFF: 1", "NOT_ALLOWLISTED: 1", "INVALID_ADDRESS: 1"} {
+		if !strings.Contains(stdout, code) {
+			t.Errorf("Expected %s, got: %s", code, stdout)
+		}
+	}
+
+	// Without a cooling-off period the address is usable at once
+	other := filepath.Join(dir, "other")
+	runCLI(t, "--data-dir", other, "--config", immediate, "allowlist", "add", "ETH", destination)
+	runCLI(t, "--data-dir", other, "--config", immediate, "run", script)
+	if _, stdout, _ := runCLI(t, "--data-dir", other, "history"); !strings.Contains(stdout, "WITHDRAW ETH 1.000000000000000000  to "+destination) {
+		t.Errorf("Expected the withdrawal with its destination, got: %s", stdout)
+	}
+	if code, _, stderr := runCLI(t, "--data-dir", other, "allowlist", "add", "USD", destination); code != exitFailure || !strings.Contains(stderr, "no addresses") {
+		t.Errorf("Expected USD to have no allowlist, got %d: %s", code, stderr)
+	}
+
+	// A row claiming to compensate an entry is no way around the allowlist
+	forged := writeFile(t, dir, "forged.csv", "type,asset,amount,address,reverses\nWITHDRAW,ETH,0.5,0x52908400098527886e0f7030069857d2e4169ee7,1\n")
+	if code, _, stderr := runCLI(t, "--data-dir", other, "--config", immediate, "import", forged); code != exitFailure || !strings.Contains(stderr, "reverses") {
+		t.Errorf("Expected the forged compensation to be refused, got %d: %s", code, stderr)
+	}
+	if _, stdout, _ := runCLI(t, "--data-dir", other, "--output", "json", "balance", "ETH"); !strings.Contains(stdout, `"ETH": "1.000000000000000000"`) {
+		t.Errorf("Expected the ETH balance to be untouched, got: %s", stdout)
+	}
+}
+
+func TestRun_StreamsNonTerminalStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	input := strings.NewReader("DEPOSIT ETH 1\nWITHDRAW ETH 0.25") // no final newline
+
+	code := run(nil, input, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("Expected exit status %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "ETH: 0.750000000000000000") || strings.Contains(stdout.String(), "Interactive Mode") {
+		t.Errorf("Expected the piped input to be processed without prompts, got: %s", stdout.String())
+	}
+
+	// "-" reads standard input explicitly and names it in diagnostics
+	stdout.Reset()
+	code = run([]string{"run", "-"}, strings.NewReader("WITHDRAW BTC 1\n"), &stdout, &stderr)
+	if code != exitFailure || !strings.Contains(stdout.String(), "stdin:1: Transaction failed") {
+		t.Errorf("Expected a stdin:1 diagnostic, got %d: %s", code, stdout.String())
+	}
+}
+
+func TestRun_UTXOs(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	script := writeFile(t, dir, "btc.txt", "DEPOSIT BTC 0.5\nDEPOSIT BTC 0.3\nWITHDRAW BTC 0.6\n")
+	runCLI(t, "--data-dir", data, "run", script)
+
+	code, stdout, stderr := runCLI(t, "--data-dir", data, "utxos")
+	if code != exitOK || !strings.Contains(stdout, ":1  0.20000000  entry 3") || !strings.Contains(stdout, "Total: 0.20000000 BTC in 1 outputs") {
+		t.Errorf("Expected the change of the withdrawal as the only output, got %d: %s%s", code, stdout, stderr)
+	}
+	if code, stdout, _ := runCLI(t, "--data-dir", data, "verify"); code != exitOK {
+		t.Errorf("Expected the coins to verify, got %d: %s", code, stdout)
+	}
+}
+
+func TestRun_CoinSelection(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	config := writeFile(t, dir, "hedix.json", `{"coin_selection": {"strategy": "largest-first", "fee_rate": 1}}`)
+	script := writeFile(t, dir, "btc.txt", "DEPOSIT BTC 0.001\nDEPOSIT BTC 0.002\nWITHDRAW BTC 0.0015\nWITHDRAW BTC 0.00000100\n")
+
+	code, stdout, stderr := runCLI(t, "--data-dir", data, "--config", config, "run", script)
+	if !strings.Contains(stdout, "Spent 1 input(s): fee 0.00000141, change 0.00049859 (largest-first)") || !strings.Contains(stdout, "DUST_OUTPUT: 1") {
+		t.Errorf("Expected the largest output to be spent and dust refused, got %d: %s%s", code, stdout, stderr)
+	}
+	if _, stdout, _ := runCLI(t, "--data-dir", data, "balance", "BTC"); stdout != "BTC: 0.00149859\n" {
+		t.Errorf("Expected the fee to leave the balance, got %q", stdout)
+	}
+
+	bad := writeFile(t, dir, "bad.json", `{"coin_selection": {"strategy": "fastest"}}`)
+	if code, _, stderr := runCLI(t, "--config", bad, "balance"); code == exitOK || !strings.Contains(stderr, "unknown strategy") {
+		t.Errorf("Expected an unknown strategy to be refused, got %d: %s", code, stderr)
+	}
+}
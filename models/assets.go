@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
 // Asset represents the type of crypto asset
 type Asset string
 
@@ -19,6 +25,26 @@ const (
 	USDDecimals = 2
 )
 
+// SLIP-44 coin types of the assets held on a blockchain, used in their
+// BIP44 derivation paths
+const (
+	BTCCoinType = 0
+	ETHCoinType = 60
+)
+
+// CoinType returns the SLIP-44 coin type of an asset, and false for an
+// asset without keys such as USD
+func (a Asset) CoinType() (uint32, bool) {
+	switch a {
+	case BTC:
+		return BTCCoinType, true
+	case ETH:
+		return ETHCoinType, true
+	default:
+		return 0, false
+	}
+}
+
 // GetDecimals returns the number of decimal places for an asset
 func (a Asset) GetDecimals() int {
 	switch a {
@@ -32,3 +58,73 @@ func (a Asset) GetDecimals() int {
 		return 0
 	}
 }
+
+// Format converts an amount in smallest units to a decimal string with
+// exactly GetDecimals() fractional digits, e.g. 150000000 BTC -> "1.50000000"
+func (a Asset) Format(amount int64) string {
+	decimals := a.GetDecimals()
+
+	sign := ""
+	// Work on the magnitude as uint64 so math.MinInt64 does not overflow
+	magnitude := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		magnitude = -magnitude
+	}
+
+	divisor := uint64(1)
+	for range decimals {
+		divisor *= 10
+	}
+
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, magnitude)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, magnitude/divisor, decimals, magnitude%divisor)
+}
+
+// ParseAmount parses a non-negative decimal string in the main unit (BTC, ETH, USD)
+// into smallest units without going through floating point, so every value that
+// Format produces parses back to the same integer
+func (a Asset) ParseAmount(s string) (int64, error) {
+	decimals := a.GetDecimals()
+
+	if strings.HasPrefix(s, "-") {
+		return 0, newParseError(ErrInvalidAmount, "amount", s, "amount must be positive")
+	}
+
+	intPart, fracPart, _ := strings.Cut(strings.TrimPrefix(s, "+"), ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, newParseError(ErrInvalidAmount, "amount", s, "invalid amount: %q", s)
+	}
+
+	// Extra fractional digits are only accepted when they are zeros
+	if len(fracPart) > decimals {
+		if strings.Trim(fracPart[decimals:], "0") != "" {
+			return 0, newParseError(ErrInvalidAmount, "amount", s, "invalid amount: %q has more than %d decimal places", s, decimals)
+		}
+		fracPart = fracPart[:decimals]
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+
+	var amount uint64
+	for _, c := range intPart + fracPart {
+		digit := uint64(c - '0')
+		if amount > (math.MaxInt64-digit)/10 {
+			return 0, newParseError(ErrInvalidAmount, "amount", s, "invalid amount: %q is too large for %s", s, a)
+		}
+		amount = amount*10 + digit
+	}
+
+	return int64(amount), nil
+}
+
+// isDigits reports whether s consists only of ASCII digits (empty is allowed)
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAsset_ParseAmount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		asset    Asset
+		input    string
+		expected int64
+	}{
+		{"BTCWhole", BTC, "2", 200000000},
+		{"BTCFraction", BTC, "1.5", 150000000},
+		{"BTCOneSatoshi", BTC, "0.00000001", 1},
+		{"LeadingPoint", BTC, ".5", 50000000},
+		{"TrailingZeros", USD, "1.2300", 123},
+		{"ETHFullPrecision", ETH, "1.234567890123456789", 1234567890123456789},
+		{"USDCents", USD, "100.50", 10050},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, err := tc.asset.ParseAmount(tc.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if amount != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, amount)
+			}
+		})
+	}
+}
+
+func TestAsset_ParseAmount_Invalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		asset Asset
+		input string
+	}{
+		{"Empty", BTC, ""},
+		{"OnlyPoint", BTC, "."},
+		{"Negative", BTC, "-1"},
+		{"Letters", BTC, "1.5a"},
+		{"TooPrecise", USD, "1.001"},
+		{"Overflow", ETH, "10"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.asset.ParseAmount(tc.input); err == nil {
+				t.Errorf("Expected error for %s amount %q", tc.asset, tc.input)
+			}
+		})
+	}
+}
+
+func TestAsset_Format(t *testing.T) {
+	testCases := []struct {
+		name     string
+		asset    Asset
+		amount   int64
+		expected string
+	}{
+		{"BTC", BTC, 150000000, "1.50000000"},
+		{"USDNegative", USD, -50, "-0.50"},
+		{"ETHMax", ETH, math.MaxInt64, "9.223372036854775807"},
+		{"ETHMin", ETH, math.MinInt64, "-9.223372036854775808"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.asset.Format(tc.amount)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+
+			if tc.amount >= 0 {
+				parsed, err := tc.asset.ParseAmount(result)
+				if err != nil || parsed != tc.amount {
+					t.Errorf("Expected %s to parse back to %d, got %d (err: %v)", result, tc.amount, parsed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAsset_CoinType(t *testing.T) {
+	testCases := []struct {
+		asset    Asset
+		coinType uint32
+		ok       bool
+	}{
+		{BTC, 0, true},
+		{ETH, 60, true},
+		{USD, 0, false},
+	}
+
+	for _, tc := range testCases {
+		coinType, ok := tc.asset.CoinType()
+		if coinType != tc.coinType || ok != tc.ok {
+			t.Errorf("%s: expected %d, %v, got %d, %v", tc.asset, tc.coinType, tc.ok, coinType, ok)
+		}
+	}
+}
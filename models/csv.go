@@ -0,0 +1,243 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CSVMapping maps transaction fields to the column names of a CSV file
+// An empty column name means the field is not present in the file
+type CSVMapping struct {
+	ID         string
+	Type       string
+	Asset      string
+	Amount     string
+	Timestamp  string
+	Memo       string
+	Reverses   string
+	Address    string
+	TimeLayout string // time.Parse layout for the timestamp column
+}
+
+// DefaultCSVMapping returns the mapping used by WriteCSV, so exported
+// ledgers can be imported back without any configuration
+func DefaultCSVMapping() CSVMapping {
+	return CSVMapping{
+		ID:         "id",
+		Type:       "type",
+		Asset:      "asset",
+		Amount:     "amount",
+		Timestamp:  "timestamp",
+		Memo:       "memo",
+		Reverses:   "reverses",
+		Address:    "address",
+		TimeLayout: time.RFC3339Nano,
+	}
+}
+
+// ParseCSVMapping parses a mapping spec such as "type=Side,asset=Currency,amount=Qty"
+// Fields that are not mentioned keep their default column names
+func ParseCSVMapping(spec string) (CSVMapping, error) {
+	mapping := DefaultCSVMapping()
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return CSVMapping{}, fmt.Errorf("invalid CSV mapping %q. Expected: <field>=<column>", pair)
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.TrimSpace(column)
+
+		switch field {
+		case "id":
+			mapping.ID = column
+		case "type":
+			mapping.Type = column
+		case "asset":
+			mapping.Asset = column
+		case "amount":
+			mapping.Amount = column
+		case "timestamp":
+			mapping.Timestamp = column
+		case "memo":
+			mapping.Memo = column
+		case "reverses":
+			mapping.Reverses = column
+		case "address":
+			mapping.Address = column
+		case "time_layout":
+			mapping.TimeLayout = column
+		default:
+			return CSVMapping{}, fmt.Errorf("unknown CSV mapping field: %s", field)
+		}
+	}
+
+	return mapping, nil
+}
+
+// CSVReader reads transactions one row at a time, so a bad row can be
+// reported without abandoning the rest of the file
+type CSVReader struct {
+	reader *csv.Reader
+	layout string
+
+	typeCol, assetCol, amountCol int
+	// Optional columns are -1 when absent from the header
+	idCol, timestampCol, memoCol, reversesCol, addressCol int
+}
+
+// NewCSVReader reads the header row and locates columns through the mapping
+// Type, asset and amount columns are required; the others are read only
+// when the header contains them
+func NewCSVReader(r io.Reader, mapping CSVMapping) (*CSVReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, newParseError(ErrInvalidFormat, "", "", "CSV file is empty, expected a header row")
+	}
+	if err != nil {
+		return nil, &ParseError{Kind: ErrInvalidFormat, Reason: "reading CSV header", Err: err}
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		if i, ok := columns[strings.ToLower(name)]; ok {
+			return i
+		}
+		return -1
+	}
+
+	c := &CSVReader{
+		reader:       reader,
+		layout:       mapping.TimeLayout,
+		typeCol:      column(mapping.Type),
+		assetCol:     column(mapping.Asset),
+		amountCol:    column(mapping.Amount),
+		idCol:        column(mapping.ID),
+		timestampCol: column(mapping.Timestamp),
+		memoCol:      column(mapping.Memo),
+		reversesCol:  column(mapping.Reverses),
+		addressCol:   column(mapping.Address),
+	}
+	if c.layout == "" {
+		c.layout = time.RFC3339Nano
+	}
+
+	for _, required := range []struct {
+		field string
+		col   int
+	}{{"type", c.typeCol}, {"asset", c.assetCol}, {"amount", c.amountCol}} {
+		if required.col < 0 {
+			return nil, newParseError(ErrInvalidFormat, required.field, "", "CSV header is missing the %s column", required.field)
+		}
+	}
+
+	return c, nil
+}
+
+// Read returns the next transaction and the line it starts on
+// It returns io.EOF after the last row. A row that fails validation is
+// reported with its line number and reading may continue; malformed CSV
+// is returned as a *csv.ParseError and ends the file
+func (c *CSVReader) Read() (Transaction, int, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return Transaction{}, 0, err
+	}
+	line, _ := c.reader.FieldPos(0)
+
+	field := func(col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return record[col]
+	}
+
+	tx, err := parseFields(field(c.typeCol), field(c.assetCol), field(c.amountCol))
+	if err != nil {
+		return Transaction{}, line, err
+	}
+
+	tx.ID = strings.TrimSpace(field(c.idCol))
+	tx.Memo = field(c.memoCol)
+	// Only Undo records compensations; the column is exported for reference
+	if value := strings.TrimSpace(field(c.reversesCol)); value != "" {
+		return Transaction{}, line, newParseError(ErrInvalidFormat, "reverses", value, "invalid format: reverses is recorded by the wallet")
+	}
+	tx.Address = strings.TrimSpace(field(c.addressCol))
+	if value := strings.TrimSpace(field(c.timestampCol)); value != "" {
+		tx.Timestamp, err = time.Parse(c.layout, value)
+		if err != nil {
+			return Transaction{}, line, &ParseError{Kind: ErrInvalidTimestamp, Field: "timestamp", Input: value, Reason: "invalid timestamp", Err: err}
+		}
+	}
+
+	return tx, line, nil
+}
+
+// ReadCSV reads every transaction from CSV with a header row
+// It stops at the first invalid row, reporting its line number
+func ReadCSV(r io.Reader, mapping CSVMapping) ([]Transaction, error) {
+	reader, err := NewCSVReader(r, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]Transaction, 0)
+	for {
+		tx, line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if line == 0 {
+				return nil, fmt.Errorf("reading CSV: %w", err)
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		transactions = append(transactions, tx)
+	}
+
+	return transactions, nil
+}
+
+// WriteCSV writes transactions using DefaultCSVMapping column names
+// Amounts are written in the main unit with the asset's full precision
+func WriteCSV(w io.Writer, transactions []Transaction) error {
+	mapping := DefaultCSVMapping()
+	writer := csv.NewWriter(w)
+
+	err := writer.Write([]string{mapping.ID, mapping.Type, mapping.Asset, mapping.Amount, mapping.Timestamp, mapping.Memo, mapping.Reverses, mapping.Address})
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range transactions {
+		timestamp := ""
+		if !tx.Timestamp.IsZero() {
+			timestamp = tx.Timestamp.Format(mapping.TimeLayout)
+		}
+
+		err := writer.Write([]string{tx.ID, string(tx.Type), string(tx.Asset), tx.FormatAmount(), timestamp, tx.Memo, tx.Reverses, tx.Address})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
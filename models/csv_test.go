@@ -0,0 +1,123 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSV_RoundTrip(t *testing.T) {
+	original := []Transaction{
+		{ID: "1", Type: Deposit, Asset: BTC, Amount: 150000000, Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), Memo: "salary, january"},
+		{ID: "2", Type: Deposit, Asset: ETH, Amount: 1234567890123456789, Timestamp: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Memo: `quoted "memo"`},
+		{ID: "3", Type: Withdraw, Asset: USD, Amount: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, original); err != nil {
+		t.Fatalf("Expected no error writing CSV, got: %v", err)
+	}
+
+	imported, err := ReadCSV(&buf, DefaultCSVMapping())
+	if err != nil {
+		t.Fatalf("Expected no error reading CSV, got: %v", err)
+	}
+
+	if len(imported) != len(original) {
+		t.Fatalf("Expected %d transactions, got %d", len(original), len(imported))
+	}
+	for i := range original {
+		want, got := original[i], imported[i]
+		if got.ID != want.ID || got.Type != want.Type || got.Asset != want.Asset ||
+			got.Amount != want.Amount || got.Memo != want.Memo || !got.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("Row %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestReadCSV_RefusesReverses(t *testing.T) {
+	var buf bytes.Buffer
+	WriteCSV(&buf, []Transaction{
+		{ID: "1", Type: Deposit, Asset: USD, Amount: 500},
+		{ID: "2", Type: Withdraw, Asset: USD, Amount: 500, Reverses: "1"},
+	})
+	if !strings.Contains(buf.String(), ",1,") {
+		t.Errorf("Expected the export to keep the reverses column, got %s", buf.String())
+	}
+
+	_, err := ReadCSV(&buf, DefaultCSVMapping())
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Kind != ErrInvalidFormat || parseErr.Field != "reverses" {
+		t.Errorf("Expected the compensation to be refused, got %v", err)
+	}
+}
+
+func TestReadCSV_CustomMapping(t *testing.T) {
+	input := "Date,Side,Currency,Qty,Note\n" +
+		"2024-05-01,deposit,usd,1000.50,Paycheck\n" +
+		"2024-05-02,withdraw,USD,300,Rent\n"
+
+	mapping, err := ParseCSVMapping("type=Side,asset=Currency,amount=Qty,timestamp=Date,memo=Note,time_layout=2006-01-02")
+	if err != nil {
+		t.Fatalf("Expected no error parsing mapping, got: %v", err)
+	}
+
+	transactions, err := ReadCSV(strings.NewReader(input), mapping)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(transactions))
+	}
+	if transactions[0].Type != Deposit || transactions[0].Asset != USD || transactions[0].Amount != 100050 {
+		t.Errorf("Unexpected first transaction: %+v", transactions[0])
+	}
+	if transactions[0].Memo != "Paycheck" {
+		t.Errorf("Expected memo Paycheck, got %s", transactions[0].Memo)
+	}
+	if !transactions[1].Timestamp.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected timestamp: %s", transactions[1].Timestamp)
+	}
+	if transactions[1].ID != "" {
+		t.Errorf("Expected empty ID without an id column, got %s", transactions[1].ID)
+	}
+}
+
+func TestReadCSV_Errors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"MissingAmountColumn", "type,asset\nDEPOSIT,BTC\n"},
+		{"InvalidAsset", "type,asset,amount\nDEPOSIT,XRP,1\n"},
+		{"InvalidAmount", "type,asset,amount\nDEPOSIT,BTC,abc\n"},
+		{"InvalidTimestamp", "type,asset,amount,timestamp\nDEPOSIT,BTC,1,yesterday\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadCSV(strings.NewReader(tc.input), DefaultCSVMapping())
+			if err == nil {
+				t.Errorf("Expected error for input: %q", tc.input)
+			}
+		})
+	}
+}
+
+func TestReadCSV_ErrorIncludesLine(t *testing.T) {
+	input := "type,asset,amount\nDEPOSIT,BTC,1\nDEPOSIT,BTC,oops\n"
+
+	_, err := ReadCSV(strings.NewReader(input), DefaultCSVMapping())
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected error mentioning line 3, got: %v", err)
+	}
+}
+
+func TestParseCSVMapping_UnknownField(t *testing.T) {
+	if _, err := ParseCSVMapping("price=Px"); err == nil {
+		t.Error("Expected error for unknown mapping field")
+	}
+}
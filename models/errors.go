@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is a sentinel error with a stable, machine-readable code
+// Match it with errors.Is; the code is what CLI and API output report
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Sentinel errors returned (wrapped) by the parsers in this package
+var (
+	ErrInvalidFormat    = &Error{Code: "INVALID_FORMAT", Message: "invalid format"}
+	ErrInvalidType      = &Error{Code: "INVALID_TYPE", Message: "invalid transaction type"}
+	ErrInvalidAsset     = &Error{Code: "INVALID_ASSET", Message: "invalid asset"}
+	ErrInvalidAmount    = &Error{Code: "INVALID_AMOUNT", Message: "invalid amount"}
+	ErrInvalidTimestamp = &Error{Code: "INVALID_TIMESTAMP", Message: "invalid timestamp"}
+)
+
+// CodeInternal is reported for errors that carry no code of their own
+const CodeInternal = "INTERNAL"
+
+// ErrorCode returns the code of the first *Error in err's chain,
+// CodeInternal if there is none, or "" for a nil error
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return CodeInternal
+}
+
+// ParseError reports which field of an input could not be parsed and why
+type ParseError struct {
+	Kind   *Error // one of the Err* sentinels above
+	Field  string // "type", "asset", "amount", "timestamp" or "" for the whole input
+	Input  string // the offending text
+	Reason string // human-readable explanation
+	Err    error  // underlying error, if any
+}
+
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+	}
+	return e.Reason
+}
+
+// Unwrap exposes both the sentinel and the underlying cause to errors.Is/As
+func (e *ParseError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// newParseError builds a ParseError with a formatted reason
+func newParseError(kind *Error, field, input, format string, args ...any) *ParseError {
+	return &ParseError{Kind: kind, Field: field, Input: input, Reason: fmt.Sprintf(format, args...)}
+}
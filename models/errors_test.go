@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Nil", nil, ""},
+		{"Sentinel", ErrInvalidAsset, "INVALID_ASSET"},
+		{"Wrapped", fmt.Errorf("line 3: %w", newParseError(ErrInvalidAmount, "amount", "x", "invalid amount")), "INVALID_AMOUNT"},
+		{"Uncoded", errors.New("disk on fire"), CodeInternal},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := ErrorCode(tc.err); code != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestParseError_UnwrapsCause(t *testing.T) {
+	cause := errors.New("bad layout")
+	err := &ParseError{Kind: ErrInvalidTimestamp, Field: "timestamp", Reason: "invalid timestamp", Err: cause}
+
+	if !errors.Is(err, ErrInvalidTimestamp) || !errors.Is(err, cause) {
+		t.Error("Expected ParseError to match both its kind and its cause")
+	}
+	if err.Error() != "invalid timestamp: bad layout" {
+		t.Errorf("Unexpected message: %s", err.Error())
+	}
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// jsonTransaction is the wire form of a Transaction
+// Amounts are decimal strings in the main unit so that 18-decimal ETH
+// values survive JSON tools that read numbers as float64
+type jsonTransaction struct {
+	ID         string          `json:"id,omitempty"`
+	Type       string          `json:"type"`
+	Asset      string          `json:"asset"`
+	Amount     json.RawMessage `json:"amount"`
+	Timestamp  *time.Time      `json:"timestamp,omitempty"`
+	Memo       string          `json:"memo,omitempty"`
+	Reverses   string          `json:"reverses,omitempty"`
+	PolicyHits []string        `json:"policy_hits,omitempty"`
+	Approval   *Approval       `json:"approval,omitempty"`
+	Principal  string          `json:"principal,omitempty"`
+	Address    string          `json:"address,omitempty"`
+	Coins      *Coins          `json:"coins,omitempty"`
+}
+
+// ParseTransactionJSON parses a transaction submitted as a single JSON
+// object, such as one line of a JSON Lines file or an API request body
+// The fields the wallet records on its entries (principal, policy_hits,
+// reverses, approval and coins) are refused; only the journal holds them
+func ParseTransactionJSON(input []byte) (Transaction, error) {
+	var tx Transaction
+	if !json.Valid(input) {
+		return Transaction{}, newParseError(ErrInvalidFormat, "", string(input), "invalid format. Expected a JSON transaction object")
+	}
+	if err := json.Unmarshal(input, &tx); err != nil {
+		return Transaction{}, err
+	}
+	if field := RecordedField(tx); field != "" {
+		return Transaction{}, newParseError(ErrInvalidFormat, field, string(input), "invalid format: %s is recorded by the wallet", field)
+	}
+	return tx, nil
+}
+
+// RecordedField returns the name of the first field set on tx that only
+// the wallet records on its entries, or ""
+func RecordedField(tx Transaction) string {
+	switch {
+	case tx.Principal != "":
+		return "principal"
+	case tx.PolicyHits != nil:
+		return "policy_hits"
+	case tx.Reverses != "":
+		return "reverses"
+	case tx.Approval != nil:
+		return "approval"
+	case tx.Coins != nil:
+		return "coins"
+	}
+	return ""
+}
+
+// MarshalJSON encodes the transaction with its amount in the main unit
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	amount, err := json.Marshal(t.FormatAmount())
+	if err != nil {
+		return nil, err
+	}
+
+	wire := jsonTransaction{
+		ID:         t.ID,
+		Type:       string(t.Type),
+		Asset:      string(t.Asset),
+		Amount:     amount,
+		Memo:       t.Memo,
+		Reverses:   t.Reverses,
+		PolicyHits: t.PolicyHits,
+		Approval:   t.Approval,
+		Principal:  t.Principal,
+		Address:    t.Address,
+		Coins:      t.Coins,
+	}
+	if !t.Timestamp.IsZero() {
+		wire.Timestamp = &t.Timestamp
+	}
+
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodes and validates a transaction object
+// The amount may be given as a string ("1.5") or a bare number (1.5)
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var wire jsonTransaction
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&wire); err != nil {
+		return &ParseError{Kind: ErrInvalidFormat, Input: string(data), Reason: "invalid format", Err: err}
+	}
+
+	amount := strings.TrimSpace(string(wire.Amount))
+	if amount == "" || amount == "null" {
+		return newParseError(ErrInvalidFormat, "amount", string(data), "invalid format: missing amount")
+	}
+	if strings.HasPrefix(amount, `"`) {
+		if err := json.Unmarshal(wire.Amount, &amount); err != nil {
+			return &ParseError{Kind: ErrInvalidAmount, Field: "amount", Input: string(wire.Amount), Reason: "invalid amount", Err: err}
+		}
+	}
+
+	tx, err := parseFields(wire.Type, wire.Asset, amount)
+	if err != nil {
+		return err
+	}
+
+	tx.ID = wire.ID
+	tx.Memo = wire.Memo
+	tx.Reverses = wire.Reverses
+	tx.PolicyHits = wire.PolicyHits
+	tx.Approval = wire.Approval
+	tx.Principal = wire.Principal
+	tx.Address = strings.TrimSpace(wire.Address)
+	tx.Coins = wire.Coins
+	if wire.Timestamp != nil {
+		tx.Timestamp = *wire.Timestamp
+	}
+
+	*t = tx
+	return nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransaction_JSONRoundTrip(t *testing.T) {
+	original := Transaction{
+		ID:        "7",
+		Type:      Withdraw,
+		Asset:     ETH,
+		Amount:    1000000000000000001, // 1.000000000000000001 ETH
+		Timestamp: time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC),
+		Memo:      "gas",
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := `{"id":"7","type":"WITHDRAW","asset":"ETH","amount":"1.000000000000000001","timestamp":"2024-02-29T10:00:00Z","memo":"gas"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	decoded, err := ParseTransactionJSON(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if decoded.ID != original.ID || decoded.Type != original.Type || decoded.Asset != original.Asset ||
+		decoded.Amount != original.Amount || decoded.Memo != original.Memo || !decoded.Timestamp.Equal(original.Timestamp) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+}
+
+func TestParseTransactionJSON_NumericAmount(t *testing.T) {
+	tx, err := ParseTransactionJSON([]byte(`{"type":"deposit","asset":"usd","amount":100.5}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if tx.Type != Deposit || tx.Asset != USD || tx.Amount != 10050 {
+		t.Errorf("Unexpected transaction: %+v", tx)
+	}
+}
+
+func TestParseTransactionJSON_Invalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"NotJSON", "DEPOSIT BTC 1"},
+		{"MissingAmount", `{"type":"DEPOSIT","asset":"BTC"}`},
+		{"UnknownField", `{"type":"DEPOSIT","asset":"BTC","amount":"1","fee":"1"}`},
+		{"InvalidAsset", `{"type":"DEPOSIT","asset":"XRP","amount":"1"}`},
+		{"NegativeAmount", `{"type":"DEPOSIT","asset":"BTC","amount":-1}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseTransactionJSON([]byte(tc.input)); err == nil {
+				t.Errorf("Expected error for input: %s", tc.input)
+			}
+		})
+	}
+}
+
+func TestParseTransactionJSON_RecordedFields(t *testing.T) {
+	for _, field := range []string{
+		`"principal":"ops"`,
+		`"policy_hits":["WITHDRAW USD > 1"]`,
+		`"reverses":"1"`,
+		`"approval":{"request":"A1"}`,
+		`"coins":{"txid":"` + EntryTxID("1") + `"}`,
+	} {
+		input := `{"type":"WITHDRAW","asset":"BTC","amount":"1",` + field + `}`
+		if _, err := ParseTransactionJSON([]byte(input)); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("Expected %s to be refused, got %v", field, err)
+		}
+	}
+
+	// The journal decodes them as the wallet recorded them
+	var tx Transaction
+	if err := json.Unmarshal([]byte(`{"type":"DEPOSIT","asset":"USD","amount":"1","principal":"ops","reverses":"1"}`), &tx); err != nil || tx.Principal != "ops" || tx.Reverses != "1" {
+		t.Errorf("Expected the recorded fields to be decoded, got %+v, %v", tx, err)
+	}
+}
@@ -1,22 +1,71 @@
 package models
 
+import "fmt"
+
 // Ledger represents a transaction ledger that stores all transaction history
 type Ledger struct {
 	transactions []Transaction
+	byID         map[string]int // transaction ID -> index in transactions
+	utxos        *UTXOSet       // unspent BTC outputs after every entry
+	utxoErr      error          // first BTC entry the UTXO set could not apply
 }
 
 // NewLedger creates a new empty ledger
 func NewLedger() *Ledger {
 	return &Ledger{
 		transactions: make([]Transaction, 0),
+		byID:         make(map[string]int),
+		utxos:        NewUTXOSet(),
 	}
 }
 
 // AddTransaction adds a new transaction entry to the ledger
+// BTC entries also update the UTXO set; one that does not fit it is
+// still recorded and reported by CheckUTXOs
 func (l *Ledger) AddTransaction(tx Transaction) {
+	if tx.ID != "" {
+		if l.byID == nil {
+			l.byID = make(map[string]int)
+		}
+		l.byID[tx.ID] = len(l.transactions)
+	}
+	if l.utxos == nil {
+		l.utxos = NewUTXOSet()
+	}
+	if err := l.utxos.Apply(tx); err != nil && l.utxoErr == nil {
+		l.utxoErr = fmt.Errorf("entry %d (id %q): %w", len(l.transactions)+1, tx.ID, err)
+	}
 	l.transactions = append(l.transactions, tx)
 }
 
+// Clone returns an independent copy of the ledger
+// Entries are copied by value, so appending to either ledger never
+// affects the other
+func (l *Ledger) Clone() *Ledger {
+	clone := &Ledger{
+		transactions: make([]Transaction, len(l.transactions)),
+		byID:         make(map[string]int, len(l.byID)),
+	}
+	copy(clone.transactions, l.transactions)
+	for id, i := range l.byID {
+		clone.byID[id] = i
+	}
+	if l.utxos != nil {
+		clone.utxos = l.utxos.Clone()
+	}
+	clone.utxoErr = l.utxoErr
+	return clone
+}
+
+// GetTransaction looks up a transaction by its ID
+func (l *Ledger) GetTransaction(id string) (Transaction, bool) {
+	i, ok := l.byID[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return l.transactions[i], true
+}
+
 // GetTransactions returns all transactions in the ledger
 func (l *Ledger) GetTransactions() []Transaction {
 	return l.transactions
@@ -26,9 +75,14 @@ func (l *Ledger) GetTransactions() []Transaction {
 // by replaying all successful transactions from the ledger
 // Returns balance in smallest unit (satoshis, wei, cents)
 func (l *Ledger) CalculateBalance(asset Asset) int64 {
+	return l.calculateBalance(asset, len(l.transactions))
+}
+
+// calculateBalance replays the first n transactions for one asset
+func (l *Ledger) calculateBalance(asset Asset, n int) int64 {
 	var balance int64 = 0
 
-	for _, transaction := range l.transactions {
+	for _, transaction := range l.transactions[:n] {
 		// Only process successful transactions for the requested asset
 		if transaction.Asset != asset {
 			continue
@@ -38,7 +92,7 @@ func (l *Ledger) CalculateBalance(asset Asset) int64 {
 		case Deposit:
 			balance += transaction.Amount
 		case Withdraw:
-			balance -= transaction.Amount
+			balance -= transaction.Amount + transaction.Fee()
 		}
 	}
 
@@ -54,3 +108,45 @@ func (l *Ledger) CalculateAllBalances() map[Asset]int64 {
 		USD: l.CalculateBalance(USD),
 	}
 }
+
+// CalculateBalancesAt calculates balances for all assets as they were
+// right after the first seq transactions (seq 0 is the empty ledger)
+func (l *Ledger) CalculateBalancesAt(seq int) map[Asset]int64 {
+	seq = min(max(seq, 0), len(l.transactions))
+	return map[Asset]int64{
+		BTC: l.calculateBalance(BTC, seq),
+		ETH: l.calculateBalance(ETH, seq),
+		USD: l.calculateBalance(USD, seq),
+	}
+}
+
+// BalancesAfter calculates balances for all assets as they were right
+// after the transaction with the given ID
+func (l *Ledger) BalancesAfter(id string) (map[Asset]int64, bool) {
+	i, ok := l.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return l.CalculateBalancesAt(i + 1), true
+}
+
+// UTXOs returns the set of unspent BTC outputs
+// It must not be modified; Clone it to project entries onto it
+func (l *Ledger) UTXOs() *UTXOSet {
+	if l.utxos == nil {
+		l.utxos = NewUTXOSet()
+	}
+	return l.utxos
+}
+
+// CheckUTXOs reports whether the UTXO set agrees with the ledger: every
+// BTC entry applied to it, and its outputs add up to the BTC balance
+func (l *Ledger) CheckUTXOs() error {
+	if l.utxoErr != nil {
+		return fmt.Errorf("%w: %w", ErrUTXOMismatch, l.utxoErr)
+	}
+	if total, balance := l.UTXOs().Total(), l.CalculateBalance(BTC); total != balance {
+		return fmt.Errorf("%w: outputs hold %s, balance is %s", ErrUTXOMismatch, BTC.Format(total), BTC.Format(balance))
+	}
+	return nil
+}
@@ -121,3 +121,61 @@ func TestLedger_EmptyBalance(t *testing.T) {
 		t.Errorf("Expected balance 0 for empty ledger, got %d", balance)
 	}
 }
+
+func TestLedger_GetTransaction(t *testing.T) {
+	ledger := NewLedger()
+
+	ledger.AddTransaction(Transaction{ID: "a", Type: Deposit, Asset: BTC, Amount: 100})
+	ledger.AddTransaction(Transaction{ID: "b", Type: Deposit, Asset: ETH, Amount: 200})
+
+	tx, ok := ledger.GetTransaction("b")
+	if !ok {
+		t.Fatal("Expected transaction b to be found")
+	}
+	if tx.Asset != ETH || tx.Amount != 200 {
+		t.Errorf("Unexpected transaction: %+v", tx)
+	}
+
+	if _, ok := ledger.GetTransaction("missing"); ok {
+		t.Error("Expected missing transaction not to be found")
+	}
+}
+
+func TestLedger_CalculateBalancesAt(t *testing.T) {
+	ledger := NewLedger()
+
+	ledger.AddTransaction(Transaction{Type: Deposit, Asset: USD, Amount: 1000})
+	ledger.AddTransaction(Transaction{Type: Withdraw, Asset: USD, Amount: 400})
+	ledger.AddTransaction(Transaction{Type: Deposit, Asset: BTC, Amount: 5})
+
+	if balances := ledger.CalculateBalancesAt(0); balances[USD] != 0 {
+		t.Errorf("Expected USD 0 at seq 0, got %d", balances[USD])
+	}
+	if balances := ledger.CalculateBalancesAt(1); balances[USD] != 1000 {
+		t.Errorf("Expected USD 1000 at seq 1, got %d", balances[USD])
+	}
+	if balances := ledger.CalculateBalancesAt(2); balances[USD] != 600 || balances[BTC] != 0 {
+		t.Errorf("Expected USD 600 and BTC 0 at seq 2, got %v", balances)
+	}
+	if balances := ledger.CalculateBalancesAt(99); balances[BTC] != 5 {
+		t.Errorf("Expected out-of-range seq to use the whole ledger, got %v", balances)
+	}
+}
+
+func TestLedger_Clone(t *testing.T) {
+	ledger := NewLedger()
+	ledger.AddTransaction(Transaction{ID: "1", Type: Deposit, Asset: BTC, Amount: 100})
+
+	clone := ledger.Clone()
+	clone.AddTransaction(Transaction{ID: "2", Type: Deposit, Asset: BTC, Amount: 50})
+
+	if len(ledger.GetTransactions()) != 1 {
+		t.Errorf("Expected original ledger to keep 1 transaction, got %d", len(ledger.GetTransactions()))
+	}
+	if _, ok := ledger.GetTransaction("2"); ok {
+		t.Error("Expected clone's entry not to be visible in the original")
+	}
+	if clone.CalculateBalance(BTC) != 150 {
+		t.Errorf("Expected clone BTC balance 150, got %d", clone.CalculateBalance(BTC))
+	}
+}
@@ -1,10 +1,8 @@
 package models
 
 import (
-	"fmt"
-	"math"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // TransactionType represents the type of transaction
@@ -18,44 +16,69 @@ const (
 // Transaction represents a single wallet transaction
 // Amount is stored as the smallest unit (satoshis, wei, cents)
 type Transaction struct {
-	Type   TransactionType
-	Asset  Asset
-	Amount int64 // Smallest unit: satoshis for BTC, wei for ETH, cents for USD
+	ID         string // Unique within a ledger; assigned by the wallet when empty
+	Type       TransactionType
+	Asset      Asset
+	Amount     int64     // Smallest unit: satoshis for BTC, wei for ETH, cents for USD
+	Timestamp  time.Time // Assigned by the wallet when zero
+	Memo       string
+	Reverses   string    // ID of the entry this one compensates, set by Wallet.Undo
+	PolicyHits []string  // policy rules that flagged the entry when it was committed, for audit
+	Approval   *Approval // how the entry was approved, when it needed approval
+	Principal  string    // the user who submitted the entry; empty for the wallet's owner
+	Address    string    // receive address of a deposit or destination of a withdrawal; empty when not known
+	Coins      *Coins    // outputs a BTC entry creates and spends; assigned by the wallet when nil
+}
+
+// Approval is the approval trail of an entry that was held for approval
+type Approval struct {
+	Request   string             `json:"request"` // ID of the approval request
+	Reason    string             `json:"reason"`  // why approval was needed
+	Decisions []ApprovalDecision `json:"decisions"`
+}
+
+// ApprovalDecision is one approver's vote on an approval request
+type ApprovalDecision struct {
+	Approver string    `json:"approver"`
+	Approved bool      `json:"approved"`
+	At       time.Time `json:"at"`
 }
 
 // ParseTransaction parses a transaction from a string input
 // Input amount is in the main unit (BTC, ETH, USD) and is converted to smallest unit
+// An optional fourth field is the address of the transaction
 func ParseTransaction(input string) (Transaction, error) {
 	parts := strings.Fields(input)
-	if len(parts) != 3 {
-		return Transaction{}, fmt.Errorf("invalid format. Expected: <TYPE> <ASSET> <AMOUNT>")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Transaction{}, newParseError(ErrInvalidFormat, "", input, "invalid format. Expected: <TYPE> <ASSET> <AMOUNT> [ADDRESS]")
 	}
 
-	txType := TransactionType(strings.ToUpper(parts[0]))
+	tx, err := parseFields(parts[0], parts[1], parts[2])
+	if err == nil && len(parts) == 4 {
+		tx.Address = parts[3]
+	}
+	return tx, err
+}
+
+// parseFields builds a transaction from its textual type, asset and amount,
+// shared by every input format so they validate identically
+func parseFields(typeField, assetField, amountField string) (Transaction, error) {
+	txType := TransactionType(strings.ToUpper(strings.TrimSpace(typeField)))
 	if txType != Deposit && txType != Withdraw {
-		return Transaction{}, fmt.Errorf("invalid transaction type. Must be DEPOSIT or WITHDRAW")
+		return Transaction{}, newParseError(ErrInvalidType, "type", typeField, "invalid transaction type. Must be DEPOSIT or WITHDRAW")
 	}
 
-	asset := Asset(strings.ToUpper(parts[1]))
+	asset := Asset(strings.ToUpper(strings.TrimSpace(assetField)))
 	if asset != BTC && asset != ETH && asset != USD {
-		return Transaction{}, fmt.Errorf("invalid asset. Must be BTC, ETH, or USD")
+		return Transaction{}, newParseError(ErrInvalidAsset, "asset", assetField, "invalid asset. Must be BTC, ETH, or USD")
 	}
 
-	// Parse as float to handle decimal input
-	amountFloat, err := strconv.ParseFloat(parts[2], 64)
+	// Convert to smallest unit based on asset decimals
+	amountSmallestUnit, err := asset.ParseAmount(strings.TrimSpace(amountField))
 	if err != nil {
-		return Transaction{}, fmt.Errorf("invalid amount: %s", err)
+		return Transaction{}, err
 	}
 
-	if amountFloat < 0 {
-		return Transaction{}, fmt.Errorf("amount must be positive")
-	}
-
-	// Convert to smallest unit based on asset decimals
-	decimals := asset.GetDecimals()
-	multiplier := math.Pow(10, float64(decimals))
-	amountSmallestUnit := int64(amountFloat * multiplier)
-
 	return Transaction{
 		Type:   txType,
 		Asset:  asset,
@@ -63,10 +86,16 @@ func ParseTransaction(input string) (Transaction, error) {
 	}, nil
 }
 
+// Fee returns the network fee the entry pays on top of its amount, in the
+// smallest unit; only BTC withdrawals pay one
+func (t Transaction) Fee() int64 {
+	if t.Coins == nil || t.Type != Withdraw {
+		return 0
+	}
+	return t.Coins.Fee
+}
+
 // FormatAmount formats the amount from smallest unit to human-readable string
 func (t Transaction) FormatAmount() string {
-	decimals := t.Asset.GetDecimals()
-	divisor := math.Pow(10, float64(decimals))
-	amount := float64(t.Amount) / divisor
-	return fmt.Sprintf("%.*f", decimals, amount)
+	return t.Asset.Format(t.Amount)
 }
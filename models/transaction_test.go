@@ -1,6 +1,9 @@
 package models
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestParseTransaction_ValidDeposit(t *testing.T) {
 	input := "DEPOSIT BTC 1.5"
@@ -80,6 +83,16 @@ func TestParseTransaction_SmallAmount(t *testing.T) {
 	}
 }
 
+func TestParseTransaction_Address(t *testing.T) {
+	tx, err := ParseTransaction("DEPOSIT BTC 0.5 bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if tx.Address != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Errorf("Expected the address, got: %q", tx.Address)
+	}
+}
+
 func TestParseTransaction_InvalidFormat(t *testing.T) {
 	testCases := []struct {
 		name  string
@@ -87,7 +100,7 @@ func TestParseTransaction_InvalidFormat(t *testing.T) {
 	}{
 		{"Empty", ""},
 		{"TooFewArgs", "DEPOSIT BTC"},
-		{"TooManyArgs", "DEPOSIT BTC 1.5 EXTRA"},
+		{"TooManyArgs", "DEPOSIT BTC 1.5 ADDRESS EXTRA"},
 	}
 
 	for _, tc := range testCases {
@@ -181,3 +194,38 @@ func TestTransaction_FormatAmount(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTransaction_TypedErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		kind  *Error
+		field string
+	}{
+		{"Format", "DEPOSIT BTC", ErrInvalidFormat, ""},
+		{"Type", "TRANSFER BTC 1", ErrInvalidType, "type"},
+		{"Asset", "DEPOSIT XRP 1", ErrInvalidAsset, "asset"},
+		{"Amount", "DEPOSIT BTC abc", ErrInvalidAmount, "amount"},
+		{"NegativeAmount", "DEPOSIT BTC -1", ErrInvalidAmount, "amount"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseTransaction(tc.input)
+			if !errors.Is(err, tc.kind) {
+				t.Fatalf("Expected errors.Is(err, %s), got: %v", tc.kind.Code, err)
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected *ParseError, got %T", err)
+			}
+			if parseErr.Field != tc.field {
+				t.Errorf("Expected field %q, got %q", tc.field, parseErr.Field)
+			}
+			if ErrorCode(err) != tc.kind.Code {
+				t.Errorf("Expected code %s, got %s", tc.kind.Code, ErrorCode(err))
+			}
+		})
+	}
+}
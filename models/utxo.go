@@ -0,0 +1,262 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Errors reported for the UTXO set
+var (
+	ErrInvalidOutpoint = &Error{Code: "INVALID_OUTPOINT", Message: "invalid outpoint"}
+	ErrUnknownOutput   = &Error{Code: "UNKNOWN_OUTPUT", Message: "output is unknown or already spent"}
+	ErrDuplicateOutput = &Error{Code: "DUPLICATE_OUTPUT", Message: "output already exists"}
+	ErrUnbalancedCoins = &Error{Code: "UNBALANCED_COINS", Message: "inputs do not match the amount and change"}
+	ErrNotEnoughCoins  = &Error{Code: "NOT_ENOUGH_COINS", Message: "unspent outputs do not cover the amount"}
+	ErrUTXOMismatch    = &Error{Code: "UTXO_MISMATCH", Message: "UTXO set does not match the ledger"}
+)
+
+// ChangeVout is the output of a withdrawal's bitcoin transaction that
+// returns the change to the wallet; output 0 pays the destination
+const ChangeVout = 1
+
+// Outpoint identifies one output of a bitcoin transaction
+// It is written as "txid:vout"
+type Outpoint struct {
+	TxID string // 64 lowercase hex digits
+	Vout uint32
+}
+
+// ParseOutpoint parses an outpoint written as "txid:vout"
+func ParseOutpoint(s string) (Outpoint, error) {
+	txid, vout, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Outpoint{}, newParseError(ErrInvalidOutpoint, "outpoint", s, "invalid outpoint. Expected: <TXID>:<VOUT>")
+	}
+	txid = strings.ToLower(txid)
+	if !validTxID(txid) {
+		return Outpoint{}, newParseError(ErrInvalidOutpoint, "outpoint", s, "invalid outpoint: txid must be 64 hex digits")
+	}
+	n, err := strconv.ParseUint(vout, 10, 32)
+	if err != nil {
+		return Outpoint{}, newParseError(ErrInvalidOutpoint, "outpoint", s, "invalid outpoint: vout must be a non-negative integer")
+	}
+	return Outpoint{TxID: txid, Vout: uint32(n)}, nil
+}
+
+func (o Outpoint) String() string {
+	return o.TxID + ":" + strconv.FormatUint(uint64(o.Vout), 10)
+}
+
+// MarshalText encodes the outpoint as "txid:vout"
+func (o Outpoint) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an outpoint written as "txid:vout"
+func (o *Outpoint) UnmarshalText(text []byte) error {
+	parsed, err := ParseOutpoint(string(text))
+	if err != nil {
+		return err
+	}
+	*o = parsed
+	return nil
+}
+
+// validTxID reports whether s is a transaction ID: 32 bytes in lowercase hex
+func validTxID(s string) bool {
+	if len(s) != 2*sha256.Size || s != strings.ToLower(s) {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// EntryTxID returns the transaction ID the wallet uses for the bitcoin
+// transaction of a ledger entry that does not name one
+func EntryTxID(id string) string {
+	sum := sha256.Sum256([]byte("hedix-wallet entry " + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Coins records which outputs a BTC ledger entry creates and spends
+// A deposit creates output Vout of TxID; a withdrawal spends Inputs,
+// pays Fee to the network and creates the change output ChangeVout of
+// TxID when Change is positive
+type Coins struct {
+	TxID     string     `json:"txid"`
+	Vout     uint32     `json:"vout,omitempty"`     // output paying the wallet, for a deposit
+	Inputs   []Outpoint `json:"inputs,omitempty"`   // outputs spent by a withdrawal
+	Change   int64      `json:"change,omitempty"`   // value of the change output of a withdrawal, in satoshis
+	Fee      int64      `json:"fee,omitempty"`      // network fee of a withdrawal, in satoshis
+	Strategy string     `json:"strategy,omitempty"` // coin selection strategy that chose the inputs
+}
+
+// UTXO is an unspent output held by the wallet
+type UTXO struct {
+	Outpoint Outpoint `json:"outpoint"`
+	Value    int64    `json:"value"`             // satoshis
+	Address  string   `json:"address,omitempty"` // empty for change
+	Entry    string   `json:"entry"`             // ID of the ledger entry that created it
+}
+
+// UTXOSet is the set of unspent BTC outputs, built by applying BTC ledger
+// entries in order
+type UTXOSet struct {
+	unspent []UTXO            // oldest first
+	created map[Outpoint]bool // every output ever created, spent or not
+}
+
+// NewUTXOSet creates an empty UTXO set
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{created: make(map[Outpoint]bool)}
+}
+
+// Clone returns an independent copy of the set
+func (s *UTXOSet) Clone() *UTXOSet {
+	clone := &UTXOSet{
+		unspent: slices.Clone(s.unspent),
+		created: make(map[Outpoint]bool, len(s.created)),
+	}
+	for out := range s.created {
+		clone.created[out] = true
+	}
+	return clone
+}
+
+// Unspent returns the unspent outputs, oldest first
+func (s *UTXOSet) Unspent() []UTXO {
+	return slices.Clone(s.unspent)
+}
+
+// Total returns the value of all unspent outputs in satoshis
+func (s *UTXOSet) Total() int64 {
+	var total int64
+	for _, utxo := range s.unspent {
+		total += utxo.Value
+	}
+	return total
+}
+
+// Get looks up an unspent output
+func (s *UTXOSet) Get(out Outpoint) (UTXO, bool) {
+	i := s.find(out)
+	if i < 0 {
+		return UTXO{}, false
+	}
+	return s.unspent[i], true
+}
+
+// find returns the index of an unspent output, or -1
+func (s *UTXOSet) find(out Outpoint) int {
+	return slices.IndexFunc(s.unspent, func(utxo UTXO) bool { return utxo.Outpoint == out })
+}
+
+// Coins returns the coins a BTC entry moves: its own when it names them,
+// otherwise a new output for a deposit, or the oldest outputs that cover
+// a withdrawal with the rest returned as change. The outputs are under
+// EntryTxID of the entry's ID
+func (s *UTXOSet) Coins(tx Transaction) (*Coins, error) {
+	if tx.Coins != nil {
+		return tx.Coins, nil
+	}
+	coins := &Coins{TxID: EntryTxID(tx.ID)}
+	if tx.Type != Withdraw {
+		return coins, nil
+	}
+
+	var total int64
+	for _, utxo := range s.unspent {
+		if total >= tx.Amount {
+			break
+		}
+		coins.Inputs = append(coins.Inputs, utxo.Outpoint)
+		total += utxo.Value
+	}
+	if total < tx.Amount {
+		return nil, fmt.Errorf("%w: outputs hold %s, withdrawal needs %s", ErrNotEnoughCoins, BTC.Format(total), tx.FormatAmount())
+	}
+	coins.Change = total - tx.Amount
+	return coins, nil
+}
+
+// Apply records the outputs a BTC entry creates and spends, choosing
+// them with Coins when the entry does not name its own. Entries of other
+// assets are ignored. On error the set is left unchanged
+func (s *UTXOSet) Apply(tx Transaction) error {
+	if tx.Asset != BTC {
+		return nil
+	}
+	coins, err := s.Coins(tx)
+	if err != nil {
+		return err
+	}
+	remaining, err := s.spend(tx, coins)
+	if err != nil {
+		return err
+	}
+
+	s.unspent = remaining
+	switch tx.Type {
+	case Deposit:
+		s.add(UTXO{Outpoint: Outpoint{TxID: coins.TxID, Vout: coins.Vout}, Value: tx.Amount, Address: tx.Address, Entry: tx.ID})
+	case Withdraw:
+		if coins.Change > 0 {
+			s.add(UTXO{Outpoint: Outpoint{TxID: coins.TxID, Vout: ChangeVout}, Value: coins.Change, Entry: tx.ID})
+		}
+	}
+	return nil
+}
+
+// spend validates coins for tx and returns the unspent outputs left once
+// the entry is applied, before it adds any
+func (s *UTXOSet) spend(tx Transaction, coins *Coins) ([]UTXO, error) {
+	if coins == nil {
+		return s.unspent, nil
+	}
+	if !validTxID(coins.TxID) {
+		return nil, fmt.Errorf("%w: txid %q must be 64 lowercase hex digits", ErrInvalidOutpoint, coins.TxID)
+	}
+
+	switch tx.Type {
+	case Deposit:
+		out := Outpoint{TxID: coins.TxID, Vout: coins.Vout}
+		if s.created[out] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateOutput, out)
+		}
+		if len(coins.Inputs) > 0 || coins.Change != 0 || coins.Fee != 0 {
+			return nil, fmt.Errorf("%w: a deposit spends no inputs", ErrUnbalancedCoins)
+		}
+		return s.unspent, nil
+	case Withdraw:
+		remaining := slices.Clone(s.unspent)
+		var total int64
+		for _, out := range coins.Inputs {
+			i := slices.IndexFunc(remaining, func(utxo UTXO) bool { return utxo.Outpoint == out })
+			if i < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownOutput, out)
+			}
+			total += remaining[i].Value
+			remaining = slices.Delete(remaining, i, i+1)
+		}
+		if coins.Change < 0 || coins.Fee < 0 || total != tx.Amount+coins.Change+coins.Fee {
+			return nil, fmt.Errorf("%w: inputs hold %s for %s, %s change and %s fee", ErrUnbalancedCoins,
+				BTC.Format(total), tx.FormatAmount(), BTC.Format(coins.Change), BTC.Format(coins.Fee))
+		}
+		if out := (Outpoint{TxID: coins.TxID, Vout: ChangeVout}); coins.Change > 0 && s.created[out] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateOutput, out)
+		}
+		return remaining, nil
+	default:
+		return s.unspent, nil
+	}
+}
+
+// add records a new unspent output
+func (s *UTXOSet) add(utxo UTXO) {
+	s.unspent = append(s.unspent, utxo)
+	s.created[utxo.Outpoint] = true
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseOutpoint(t *testing.T) {
+	txid := strings.Repeat("ab", 32)
+	tests := []struct {
+		name  string
+		input string
+		want  Outpoint
+		err   bool
+	}{
+		{"Valid", txid + ":1", Outpoint{TxID: txid, Vout: 1}, false},
+		{"UpperCase", strings.ToUpper(txid) + ":0", Outpoint{TxID: txid}, false},
+		{"NoVout", txid, Outpoint{}, true},
+		{"ShortTxID", "abcd:0", Outpoint{}, true},
+		{"NotHex", strings.Repeat("zz", 32) + ":0", Outpoint{}, true},
+		{"NegativeVout", txid + ":-1", Outpoint{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOutpoint(tt.input)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidOutpoint) {
+					t.Errorf("Expected ErrInvalidOutpoint, got %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %v, got %v (%v)", tt.want, got, err)
+			}
+			if got.String() != strings.ToLower(tt.input) {
+				t.Errorf("Expected %s to round-trip, got %s", tt.input, got)
+			}
+		})
+	}
+}
+
+func TestUTXOSet_Apply(t *testing.T) {
+	utxos := NewUTXOSet()
+	deposit := func(id string, amount int64) Transaction {
+		return Transaction{ID: id, Type: Deposit, Asset: BTC, Amount: amount}
+	}
+	for _, tx := range []Transaction{deposit("1", 50), deposit("2", 30), deposit("3", 40)} {
+		if err := utxos.Apply(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Oldest outputs first, the rest returned as change
+	withdrawal := Transaction{ID: "4", Type: Withdraw, Asset: BTC, Amount: 60}
+	if err := utxos.Apply(withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	unspent := utxos.Unspent()
+	if len(unspent) != 2 || unspent[0].Entry != "3" || unspent[1].Value != 20 || unspent[1].Outpoint.Vout != ChangeVout {
+		t.Errorf("Expected output 3 and 20 of change, got %+v", unspent)
+	}
+	if utxos.Total() != 60 {
+		t.Errorf("Expected 60 unspent, got %d", utxos.Total())
+	}
+
+	spent := Outpoint{TxID: EntryTxID("1")}
+	tests := []struct {
+		name string
+		tx   Transaction
+		err  error
+	}{
+		{"SpentInput", Transaction{ID: "5", Type: Withdraw, Asset: BTC, Amount: 50,
+			Coins: &Coins{TxID: EntryTxID("5"), Inputs: []Outpoint{spent}}}, ErrUnknownOutput},
+		{"Unbalanced", Transaction{ID: "5", Type: Withdraw, Asset: BTC, Amount: 30,
+			Coins: &Coins{TxID: EntryTxID("5"), Inputs: []Outpoint{unspent[0].Outpoint}, Change: 5}}, ErrUnbalancedCoins},
+		{"DuplicateOutput", Transaction{ID: "5", Type: Deposit, Asset: BTC, Amount: 10,
+			Coins: &Coins{TxID: EntryTxID("1")}}, ErrDuplicateOutput},
+		{"InvalidTxID", Transaction{ID: "5", Type: Deposit, Asset: BTC, Amount: 10,
+			Coins: &Coins{TxID: "abc"}}, ErrInvalidOutpoint},
+		{"NotEnough", Transaction{ID: "5", Type: Withdraw, Asset: BTC, Amount: 61}, ErrNotEnoughCoins},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := utxos.Apply(tt.tx); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+			if utxos.Total() != 60 {
+				t.Errorf("Expected a failed entry to leave the set unchanged, got %d unspent", utxos.Total())
+			}
+		})
+	}
+}
+
+func TestLedger_CheckUTXOs(t *testing.T) {
+	ledger := NewLedger()
+	ledger.AddTransaction(Transaction{ID: "1", Type: Deposit, Asset: BTC, Amount: 100})
+	ledger.AddTransaction(Transaction{ID: "2", Type: Deposit, Asset: ETH, Amount: 7})
+	ledger.AddTransaction(Transaction{ID: "3", Type: Withdraw, Asset: BTC, Amount: 40})
+	if err := ledger.CheckUTXOs(); err != nil {
+		t.Errorf("Expected a consistent UTXO set, got %v", err)
+	}
+	if total := ledger.UTXOs().Total(); total != ledger.CalculateBalance(BTC) {
+		t.Errorf("Expected the outputs to hold the BTC balance, got %d", total)
+	}
+
+	// A clone keeps its own outputs
+	clone := ledger.Clone()
+	clone.AddTransaction(Transaction{ID: "4", Type: Deposit, Asset: BTC, Amount: 5})
+	if ledger.UTXOs().Total() != 60 || clone.UTXOs().Total() != 65 {
+		t.Errorf("Expected independent UTXO sets, got %d and %d", ledger.UTXOs().Total(), clone.UTXOs().Total())
+	}
+
+	// An entry spending an output that does not exist breaks the agreement
+	ledger.AddTransaction(Transaction{ID: "5", Type: Withdraw, Asset: BTC, Amount: 10,
+		Coins: &Coins{TxID: EntryTxID("5"), Inputs: []Outpoint{{TxID: EntryTxID("9")}}}})
+	if err := ledger.CheckUTXOs(); !errors.Is(err, ErrUTXOMismatch) || !errors.Is(err, ErrUnknownOutput) {
+		t.Errorf("Expected ErrUTXOMismatch for an unknown input, got %v", err)
+	}
+}
+
+func TestLedger_WithdrawalFee(t *testing.T) {
+	ledger := NewLedger()
+	ledger.AddTransaction(Transaction{ID: "1", Type: Deposit, Asset: BTC, Amount: 1000})
+	ledger.AddTransaction(Transaction{ID: "2", Type: Withdraw, Asset: BTC, Amount: 600,
+		Coins: &Coins{TxID: EntryTxID("2"), Inputs: []Outpoint{{TxID: EntryTxID("1")}}, Change: 250, Fee: 150}})
+
+	if balance := ledger.CalculateBalance(BTC); balance != 250 {
+		t.Errorf("Expected the fee to be paid from the balance, got %d", balance)
+	}
+	if err := ledger.CheckUTXOs(); err != nil {
+		t.Errorf("Expected the change to match the balance, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/api"
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// supportedAssets lists every asset in display order
+var supportedAssets = []models.Asset{models.BTC, models.ETH, models.USD}
+
+// parseAsset validates an asset symbol typed by the user
+func parseAsset(symbol string) (models.Asset, error) {
+	asset := models.Asset(strings.ToUpper(symbol))
+	for _, supported := range supportedAssets {
+		if asset == supported {
+			return asset, nil
+		}
+	}
+	return "", fmt.Errorf("invalid asset %q. Must be BTC, ETH, or USD", symbol)
+}
+
+// formatBalances renders every balance in its main unit
+func formatBalances(amounts map[models.Asset]int64) map[models.Asset]string {
+	balances := make(map[models.Asset]string)
+	for asset, amount := range amounts {
+		balances[asset] = asset.Format(amount)
+	}
+	return balances
+}
+
+// writeBalance prints the balance of a single asset
+func writeBalance(out io.Writer, wallet *services.Wallet, asset models.Asset) {
+	fmt.Fprintf(out, "%s: %s\n", asset, asset.Format(wallet.GetBalance(asset)))
+}
+
+// recentHistory returns the last limit ledger entries, optionally only
+// those of one asset (an empty asset matches all)
+func recentHistory(wallet *services.Wallet, asset models.Asset, limit int) []models.Transaction {
+	entries := make([]models.Transaction, 0)
+	for _, tx := range wallet.GetTransactionHistory() {
+		if asset == "" || tx.Asset == asset {
+			entries = append(entries, tx)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// writeHistory prints ledger entries one per line
+func writeHistory(out io.Writer, entries []models.Transaction) {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No transactions")
+		return
+	}
+	for _, tx := range entries {
+		fmt.Fprintf(out, "%-6s %s  %-8s %s %s", tx.ID, tx.Timestamp.Format("2006-01-02 15:04:05"), tx.Type, tx.Asset, tx.FormatAmount())
+		switch {
+		case tx.Address == "":
+		case tx.Type == models.Withdraw:
+			fmt.Fprintf(out, "  to %s", tx.Address)
+		default:
+			fmt.Fprintf(out, "  at %s", tx.Address)
+		}
+		if tx.Memo != "" {
+			fmt.Fprintf(out, "  (%s)", tx.Memo)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// writePending prints approval requests one per line
+func writePending(out io.Writer, requests []services.ApprovalRequest) {
+	if len(requests) == 0 {
+		fmt.Fprintln(out, "No pending approvals")
+		return
+	}
+	for _, request := range requests {
+		tx := request.Transaction
+		fmt.Fprintf(out, "%-6s %s  %-8s %s %s  %d/%d approvals", request.ID, request.Created.Format("2006-01-02 15:04:05"),
+			tx.Type, tx.Asset, tx.FormatAmount(), request.Approvals(), request.Required)
+		if !request.Expires.IsZero() {
+			fmt.Fprintf(out, "  expires %s", request.Expires.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Fprintf(out, "  (%s)\n", request.Reason)
+	}
+}
+
+// writeDecision prints the state of a request after a decision
+func writeDecision(out io.Writer, request services.ApprovalRequest) {
+	switch request.Status {
+	case services.ApprovalApproved:
+		fmt.Fprintf(out, "Request %s approved: committed as entry %s\n", request.ID, request.EntryID)
+	case services.ApprovalRejected:
+		fmt.Fprintf(out, "Request %s rejected\n", request.ID)
+	default:
+		fmt.Fprintf(out, "Request %s: %d of %d approvals\n", request.ID, request.Approvals(), request.Required)
+	}
+}
+
+// writeKeys prints every API key with its scope and state at now
+func writeKeys(out io.Writer, keys []api.APIKey, now time.Time) {
+	if len(keys) == 0 {
+		fmt.Fprintln(out, "No API keys")
+		return
+	}
+	for _, key := range keys {
+		state := "active"
+		switch {
+		case !key.Revoked.IsZero():
+			state = "revoked"
+		case !key.Active(now):
+			state = "expired"
+		}
+		user, accounts := key.User, "all accounts"
+		if user == "" {
+			user = "-"
+		}
+		if len(key.Accounts) > 0 {
+			names := make([]string, len(key.Accounts))
+			for i, asset := range key.Accounts {
+				names[i] = string(asset)
+			}
+			accounts = strings.Join(names, ",")
+		}
+		operations := make([]string, len(key.Operations))
+		for i, op := range key.Operations {
+			operations[i] = string(op)
+		}
+		fmt.Fprintf(out, "%-10s %-8s user %-10s %-14s %s", key.ID, state, user, accounts, strings.Join(operations, ","))
+		if !key.Expires.IsZero() {
+			fmt.Fprintf(out, "  expires %s", key.Expires.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// writeAddresses prints receive addresses with the deposits each received
+func writeAddresses(out io.Writer, addresses []services.ReceiveAddress, received [][]models.Transaction) {
+	if len(addresses) == 0 {
+		fmt.Fprintln(out, "No addresses")
+		return
+	}
+	for i, address := range addresses {
+		var total int64
+		for _, tx := range received[i] {
+			total += tx.Amount
+		}
+		fmt.Fprintf(out, "%s %-18s %s  received %s in %d deposits\n", address.Asset, address.Path, address.Address,
+			address.Asset.Format(total), len(received[i]))
+	}
+}
+
+// writeAllowlist prints allowlisted addresses with their state at now
+func writeAllowlist(out io.Writer, allowed []services.AllowedAddress, now time.Time) {
+	if len(allowed) == 0 {
+		fmt.Fprintln(out, "No allowlisted addresses")
+		return
+	}
+	for _, entry := range allowed {
+		state := "active"
+		if now.Before(entry.Active) {
+			state = "cooling off until " + entry.Active.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(out, "%s %s  %s", entry.Asset, entry.Address, state)
+		if entry.Label != "" {
+			fmt.Fprintf(out, "  (%s)", entry.Label)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// writeCoins prints the inputs, fee and change of a BTC withdrawal
+func writeCoins(out io.Writer, prefix string, tx models.Transaction) {
+	if tx.Type != models.Withdraw || tx.Coins == nil {
+		return
+	}
+	fmt.Fprintf(out, "%sSpent %d input(s): fee %s, change %s", prefix, len(tx.Coins.Inputs),
+		models.BTC.Format(tx.Coins.Fee), models.BTC.Format(tx.Coins.Change))
+	if tx.Coins.Strategy != "" {
+		fmt.Fprintf(out, " (%s)", tx.Coins.Strategy)
+	}
+	fmt.Fprintln(out)
+}
+
+// writeUTXOs prints unspent outputs one per line, then their total
+func writeUTXOs(out io.Writer, utxos []models.UTXO) {
+	if len(utxos) == 0 {
+		fmt.Fprintln(out, "No unspent outputs")
+		return
+	}
+	var total int64
+	for _, utxo := range utxos {
+		total += utxo.Value
+		fmt.Fprintf(out, "%s  %s  entry %-6s", utxo.Outpoint, models.BTC.Format(utxo.Value), utxo.Entry)
+		if utxo.Address != "" {
+			fmt.Fprintf(out, " %s", utxo.Address)
+		} else {
+			fmt.Fprint(out, " change")
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "Total: %s BTC in %d outputs\n", models.BTC.Format(total), len(utxos))
+}
+
+// writeJSON prints v as indented JSON for the json output format
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// replCommands lists the interactive commands for help and tab completion
+var replCommands = []struct {
+	name  string
+	usage string
+	help  string
+}{
+	{"balance", "balance [ASSET]", "show all balances, or the balance of one asset"},
+	{"history", "history [n] [--asset ASSET]", "show the last n transactions (default 10)"},
+	{"undo", "undo", "compensate the most recent transaction with an opposite entry"},
+	{"assets", "assets", "list the supported assets and their precision"},
+	{"export", "export <file>", "write the full ledger to a CSV file"},
+	{"help", "help", "show this help"},
+	{"exit", "exit", "leave interactive mode (also Ctrl+C or Ctrl+D)"},
+}
+
+// maxHistoryEntries bounds the persistent command history
+const maxHistoryEntries = 1000
+
+func runInteractive(wallet *services.Wallet) {
+	var (
+		out      io.Writer = os.Stdout
+		readLine func() (string, error)
+	)
+
+	// On a terminal use raw mode for line editing, history and completion;
+	// anything else (pipes, files) is read line by line with a plain prompt
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		if state, err := term.MakeRaw(fd); err == nil {
+			defer term.Restore(fd, state)
+
+			terminal := term.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{os.Stdin, os.Stdout}, "> ")
+			terminal.History = loadHistory(historyPath())
+			terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+				if key != '\t' {
+					return "", 0, false
+				}
+				return complete(line, pos)
+			}
+
+			out = terminal
+			readLine = terminal.ReadLine
+		}
+	}
+	if readLine == nil {
+		reader := bufio.NewReader(os.Stdin)
+		readLine = func() (string, error) {
+			fmt.Print("> ")
+			line, err := reader.ReadString('\n')
+			if err == io.EOF && line != "" {
+				return line, nil
+			}
+			return line, err
+		}
+	}
+
+	fmt.Fprintln(out, "Interactive Mode - Enter transactions or commands")
+	fmt.Fprintln(out, "Format: <DEPOSIT|WITHDRAW> <BTC|ETH|USD> <amount>")
+	fmt.Fprintln(out, "Example: DEPOSIT BTC 1.5")
+	fmt.Fprintln(out, "Type help for the list of commands")
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Current State: %s\n", wallet)
+	fmt.Fprintln(out)
+
+	r := &repl{wallet: wallet, out: out}
+	for {
+		input, err := readLine()
+		if err != nil {
+			break
+		}
+		if r.execute(input) {
+			break
+		}
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Final Balance: %s\n", wallet)
+}
+
+// repl executes interactive commands and transactions against a wallet
+type repl struct {
+	wallet *services.Wallet
+	out    io.Writer
+}
+
+// execute runs one line of input and reports whether the session should end
+func (r *repl) execute(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+
+	var err error
+	switch command, args := strings.ToLower(fields[0]), fields[1:]; command {
+	case "exit", "quit":
+		return true
+	case "help":
+		r.help()
+	case "assets":
+		r.assets()
+	case "balance":
+		err = r.balance(args)
+	case "history":
+		err = r.history(args)
+	case "undo":
+		err = r.undo()
+	case "export":
+		err = r.export(args)
+	case "deposit", "withdraw":
+		r.transaction(input)
+	default:
+		err = fmt.Errorf("unknown command %q. Type help for the list of commands", fields[0])
+	}
+
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %s\n", err)
+	}
+	return false
+}
+
+func (r *repl) transaction(input string) {
+	tx, err := models.ParseTransaction(input)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %s\n", err)
+		return
+	}
+
+	entry, err := r.wallet.Apply(tx)
+	var pending *services.PendingApprovalError
+	switch {
+	case errors.As(err, &pending):
+		fmt.Fprintf(r.out, "Transaction held for approval as request %s (%s)\n", pending.Request.ID, pending.Request.Reason)
+	case err != nil:
+		fmt.Fprintf(r.out, "Transaction failed: %s\n", err)
+	default:
+		fmt.Fprintln(r.out, "Transaction successful")
+		writeCoins(r.out, "", entry)
+	}
+
+	fmt.Fprintf(r.out, "Current State: %s\n", r.wallet)
+}
+
+func (r *repl) help() {
+	fmt.Fprintln(r.out, "Transactions:")
+	fmt.Fprintln(r.out, "  <DEPOSIT|WITHDRAW> <ASSET> <amount>")
+	fmt.Fprintln(r.out, "Commands:")
+	for _, command := range replCommands {
+		fmt.Fprintf(r.out, "  %-28s %s\n", command.usage, command.help)
+	}
+}
+
+func (r *repl) assets() {
+	for _, asset := range supportedAssets {
+		fmt.Fprintf(r.out, "%s  %d decimals\n", asset, asset.GetDecimals())
+	}
+}
+
+func (r *repl) balance(args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(r.out, "Current State: %s\n", r.wallet)
+		return nil
+	case 1:
+		asset, err := parseAsset(args[0])
+		if err != nil {
+			return err
+		}
+		writeBalance(r.out, r.wallet, asset)
+		return nil
+	default:
+		return errors.New("usage: balance [ASSET]")
+	}
+}
+
+func (r *repl) history(args []string) error {
+	limit := 10
+	var asset models.Asset
+
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--asset" && i+1 < len(args):
+			var err error
+			if asset, err = parseAsset(args[i+1]); err != nil {
+				return err
+			}
+			i++
+		default:
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return errors.New("usage: history [n] [--asset ASSET]")
+			}
+			limit = n
+		}
+	}
+
+	writeHistory(r.out, recentHistory(r.wallet, asset, limit))
+	return nil
+}
+
+func (r *repl) undo() error {
+	compensation, err := r.wallet.Undo()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.out, "Undid transaction %s with %s %s %s\n",
+		compensation.Reverses, compensation.Type, compensation.Asset, compensation.FormatAmount())
+	fmt.Fprintf(r.out, "Current State: %s\n", r.wallet)
+	return nil
+}
+
+func (r *repl) export(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: export <file>")
+	}
+	if err := exportCSV(r.wallet, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.out, "Exported %d transactions to %s\n", len(r.wallet.GetTransactionHistory()), args[0])
+	return nil
+}
+
+// complete implements tab completion of commands and asset symbols for
+// the word under the cursor. A unique match is completed with a trailing
+// space; several matches are completed to their common prefix
+func complete(line string, pos int) (string, int, bool) {
+	prefix := line[:pos]
+	start := strings.LastIndex(prefix, " ") + 1
+	word := prefix[start:]
+	previous := strings.Fields(prefix[:start])
+
+	var candidates []string
+	switch {
+	case len(previous) == 0:
+		for _, command := range replCommands {
+			candidates = append(candidates, command.name)
+		}
+		candidates = append(candidates, string(models.Deposit), string(models.Withdraw))
+	case len(previous) == 1 && isOneOf(previous[0], "balance", "deposit", "withdraw"),
+		strings.ToLower(previous[0]) == "history" && previous[len(previous)-1] == "--asset":
+		for _, asset := range supportedAssets {
+			candidates = append(candidates, string(asset))
+		}
+	case strings.ToLower(previous[0]) == "history" && strings.HasPrefix(word, "-"):
+		candidates = []string{"--asset"}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(word)) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	var completion string
+	switch len(matches) {
+	case 0:
+		return "", 0, false
+	case 1:
+		completion = matches[0] + " "
+	default:
+		completion = commonPrefix(matches)
+		if len(completion) <= len(word) {
+			return "", 0, false
+		}
+	}
+
+	newLine := line[:start] + completion + line[pos:]
+	return newLine, start + len(completion), true
+}
+
+// isOneOf reports whether word case-insensitively equals one of options
+func isOneOf(word string, options ...string) bool {
+	for _, option := range options {
+		if strings.EqualFold(word, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// commonPrefix returns the longest prefix shared by all words
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// historyPath returns where the command history is kept: $HEDIX_HISTORY,
+// or ~/.hedix_history. An empty path disables persistence
+func historyPath() string {
+	if path := os.Getenv("HEDIX_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hedix_history")
+}
+
+// fileHistory is a term.History that appends every entry to a file so it
+// survives across sessions. Persistence is best-effort: a history file
+// that cannot be read or written never interrupts the session
+type fileHistory struct {
+	path    string
+	entries []string // oldest first
+}
+
+// loadHistory reads up to maxHistoryEntries entries from path
+func loadHistory(path string) *fileHistory {
+	h := &fileHistory{path: path}
+	if path == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	// Compact the file once it outgrows the bound so it cannot grow forever
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+		os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+	}
+	return h
+}
+
+func (h *fileHistory) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, entry)
+}
+
+func (h *fileHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns the entry idx steps back, 0 being the most recent
+func (h *fileHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestRepl_Commands(t *testing.T) {
+	wallet := services.NewWallet()
+	var out bytes.Buffer
+	r := &repl{wallet: wallet, out: &out}
+
+	steps := []struct {
+		input string
+		want  string
+	}{
+		{"DEPOSIT BTC 1.5", "Transaction successful"},
+		{"deposit usd 20", "Transaction successful"},
+		{"balance btc", "BTC: 1.50000000"},
+		{"balance XRP", `Error: invalid asset "XRP"`},
+		{"history 1", "DEPOSIT  USD 20.00"},
+		{"history --asset BTC", "DEPOSIT  BTC 1.50000000"},
+		{"undo", "Undid transaction 2 with WITHDRAW USD 20.00"},
+		{"assets", "ETH  18 decimals"},
+		{"frobnicate", `Error: unknown command "frobnicate"`},
+		{"help", "undo"},
+	}
+
+	for _, step := range steps {
+		out.Reset()
+		if r.execute(step.input) {
+			t.Fatalf("Expected %q not to end the session", step.input)
+		}
+		if !strings.Contains(out.String(), step.want) {
+			t.Errorf("%q: expected output to contain %q, got:\n%s", step.input, step.want, out.String())
+		}
+	}
+
+	if wallet.GetBalance(models.USD) != 0 {
+		t.Errorf("Expected undo to restore USD balance 0, got %d", wallet.GetBalance(models.USD))
+	}
+	if !r.execute("exit") {
+		t.Error("Expected exit to end the session")
+	}
+}
+
+func TestRepl_Export(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1})
+	path := filepath.Join(t.TempDir(), "ledger.csv")
+	var out bytes.Buffer
+
+	(&repl{wallet: wallet, out: &out}).execute("export " + path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected export file, got: %v", err)
+	}
+	defer file.Close()
+	transactions, err := models.ReadCSV(file, models.DefaultCSVMapping())
+	if err != nil || len(transactions) != 1 || transactions[0].Amount != 1 {
+		t.Errorf("Expected exported ledger to import back, got %v (err: %v)", transactions, err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	testCases := []struct {
+		name    string
+		line    string
+		want    string
+		wantPos int
+		ok      bool
+	}{
+		{"UniqueCommand", "bal", "balance ", 8, true},
+		{"TransactionKeyword", "wi", "WITHDRAW ", 9, true},
+		{"CommonPrefix", "e", "ex", 2, true},
+		{"AssetAfterDeposit", "DEPOSIT e", "DEPOSIT ETH ", 12, true},
+		{"AssetAfterBalance", "balance u", "balance USD ", 12, true},
+		{"HistoryFlag", "history 5 --a", "history 5 --asset ", 18, true},
+		{"HistoryAsset", "history --asset b", "history --asset BTC ", 20, true},
+		{"NoMatch", "zzz", "", 0, false},
+		{"AmbiguousWithoutProgress", "DEPOSIT ", "", 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			line, pos, ok := complete(tc.line, len(tc.line))
+			if ok != tc.ok || line != tc.want || pos != tc.wantPos {
+				t.Errorf("Expected (%q, %d, %v), got (%q, %d, %v)", tc.want, tc.wantPos, tc.ok, line, pos, ok)
+			}
+		})
+	}
+}
+
+func TestFileHistory_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := loadHistory(path)
+	h.Add("DEPOSIT BTC 1")
+	h.Add("   ")
+	h.Add("balance")
+
+	reloaded := loadHistory(path)
+	if reloaded.Len() != 2 {
+		t.Fatalf("Expected 2 persisted entries, got %d", reloaded.Len())
+	}
+	if reloaded.At(0) != "balance" || reloaded.At(1) != "DEPOSIT BTC 1" {
+		t.Errorf("Expected most recent entry first, got %q then %q", reloaded.At(0), reloaded.At(1))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// errAssertionFailed is reported when a script directive does not hold
+var errAssertionFailed = &models.Error{Code: "ASSERTION_FAILED", Message: "assertion failed"}
+
+// Directive kinds understood in text scripts
+const (
+	directiveAssertBalance = "ASSERT BALANCE" // ASSERT BALANCE <ASSET> <AMOUNT>
+	directiveExpectFail    = "EXPECT FAIL"    // EXPECT FAIL [CODE] <TYPE> <ASSET> <AMOUNT> [ADDRESS]
+	directiveCheckpoint    = "CHECKPOINT"     // CHECKPOINT <name>
+)
+
+// directive is a script statement that checks or marks the wallet state
+// EXPECT FAIL also carries a transaction, stored in the record itself
+type directive struct {
+	kind   string
+	text   string       // the statement as written, for reports
+	asset  models.Asset // ASSERT BALANCE
+	amount int64        // ASSERT BALANCE, in smallest units
+	code   string       // EXPECT FAIL: required error code, "" for any failure
+	name   string       // CHECKPOINT
+}
+
+// parseScriptLine parses one non-empty, comment-stripped line of a text
+// script: either a plain transaction or a directive
+func parseScriptLine(line int, input string) record {
+	fields := strings.Fields(input)
+	keyword := strings.ToUpper(fields[0])
+	if keyword != "ASSERT" && keyword != "EXPECT" && keyword != "CHECKPOINT" {
+		tx, err := models.ParseTransaction(input)
+		return record{line: line, tx: tx, err: err}
+	}
+
+	d, tx, err := parseDirective(fields)
+	if err != nil {
+		return record{line: line, err: err}
+	}
+	d.text = strings.Join(fields, " ")
+	return record{line: line, tx: tx, directive: d}
+}
+
+// parseDirective parses the fields of an ASSERT, EXPECT or CHECKPOINT line
+func parseDirective(fields []string) (*directive, models.Transaction, error) {
+	invalid := func(usage string) error {
+		return &models.ParseError{
+			Kind:   models.ErrInvalidFormat,
+			Input:  strings.Join(fields, " "),
+			Reason: "invalid directive. Expected: " + usage,
+		}
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "CHECKPOINT":
+		if len(fields) != 2 {
+			return nil, models.Transaction{}, invalid("CHECKPOINT <name>")
+		}
+		return &directive{kind: directiveCheckpoint, name: fields[1]}, models.Transaction{}, nil
+
+	case "ASSERT":
+		if len(fields) != 4 || strings.ToUpper(fields[1]) != "BALANCE" {
+			return nil, models.Transaction{}, invalid("ASSERT BALANCE <ASSET> <AMOUNT>")
+		}
+		// Reuse the transaction parser to validate the asset and amount
+		tx, err := models.ParseTransaction(fmt.Sprintf("%s %s %s", models.Deposit, fields[2], fields[3]))
+		if err != nil {
+			return nil, models.Transaction{}, err
+		}
+		return &directive{kind: directiveAssertBalance, asset: tx.Asset, amount: tx.Amount}, models.Transaction{}, nil
+
+	default: // EXPECT
+		if len(fields) < 5 || strings.ToUpper(fields[1]) != "FAIL" {
+			return nil, models.Transaction{}, invalid("EXPECT FAIL [CODE] <TYPE> <ASSET> <AMOUNT> [ADDRESS]")
+		}
+		d := &directive{kind: directiveExpectFail}
+		rest := fields[2:]
+		// The code is optional, so anything before the type is the code
+		if txType := models.TransactionType(strings.ToUpper(rest[0])); txType != models.Deposit && txType != models.Withdraw {
+			d.code = strings.ToUpper(rest[0])
+			rest = rest[1:]
+		}
+		if len(rest) != 3 && len(rest) != 4 {
+			return nil, models.Transaction{}, invalid("EXPECT FAIL [CODE] <TYPE> <ASSET> <AMOUNT> [ADDRESS]")
+		}
+		tx, err := models.ParseTransaction(strings.Join(rest, " "))
+		if err != nil {
+			return nil, models.Transaction{}, err
+		}
+		return d, tx, nil
+	}
+}
+
+// runDirective evaluates a directive against the wallet
+// The returned error wraps errAssertionFailed when the directive does not
+// hold; outcome describes what happened for reports
+func runDirective(wallet *services.Wallet, rec record) (outcome string, err error) {
+	d := rec.directive
+
+	switch d.kind {
+	case directiveCheckpoint:
+		return fmt.Sprintf("Checkpoint %s: %s", d.name, wallet), nil
+
+	case directiveAssertBalance:
+		actual := wallet.GetBalance(d.asset)
+		if actual != d.amount {
+			return "", fmt.Errorf("%w: %s: expected %s, got %s (diff %s)", errAssertionFailed, d.text,
+				d.asset.Format(d.amount), d.asset.Format(actual), signed(d.asset, actual-d.amount))
+		}
+		return fmt.Sprintf("Assertion passed: %s", d.text), nil
+
+	default: // EXPECT FAIL
+		// Tried on a fork, so a transaction that unexpectedly succeeds is
+		// never committed
+		txErr := wallet.Fork().ProcessTransaction(rec.tx)
+		switch {
+		case txErr == nil:
+			return "", fmt.Errorf("%w: %s: expected the transaction to fail, but it succeeded", errAssertionFailed, d.text)
+		case d.code != "" && models.ErrorCode(txErr) != d.code:
+			return "", fmt.Errorf("%w: %s: expected %s, got %s: %s", errAssertionFailed, d.text, d.code, models.ErrorCode(txErr), txErr)
+		default:
+			return fmt.Sprintf("Failed as expected: %s", txErr), nil
+		}
+	}
+}
+
+// signed formats a balance difference with an explicit sign
+func signed(asset models.Asset, amount int64) string {
+	if amount >= 0 {
+		return "+" + asset.Format(amount)
+	}
+	return asset.Format(amount)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestParseScriptLine(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		kind   string
+		code   string
+		txType models.TransactionType
+	}{
+		{"Transaction", "DEPOSIT BTC 1", "", "", models.Deposit},
+		{"AssertBalance", "assert balance btc 1.5", directiveAssertBalance, "", ""},
+		{"ExpectFail", "EXPECT FAIL WITHDRAW BTC 5", directiveExpectFail, "", models.Withdraw},
+		{"ExpectFailWithCode", "EXPECT FAIL insufficient_funds WITHDRAW BTC 5", directiveExpectFail, "INSUFFICIENT_FUNDS", models.Withdraw},
+		{"ExpectFailWithAddress", "EXPECT FAIL unknown_address DEPOSIT BTC 1 bc1qnowhere", directiveExpectFail, "UNKNOWN_ADDRESS", models.Deposit},
+		{"Checkpoint", "CHECKPOINT funded", directiveCheckpoint, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := parseScriptLine(1, tc.input)
+			if rec.err != nil {
+				t.Fatalf("Expected no error, got: %v", rec.err)
+			}
+
+			kind := ""
+			if rec.directive != nil {
+				kind = rec.directive.kind
+				if rec.directive.code != tc.code {
+					t.Errorf("Expected code %q, got %q", tc.code, rec.directive.code)
+				}
+			}
+			if kind != tc.kind {
+				t.Errorf("Expected directive %q, got %q", tc.kind, kind)
+			}
+			if rec.tx.Type != tc.txType {
+				t.Errorf("Expected transaction type %q, got %q", tc.txType, rec.tx.Type)
+			}
+		})
+	}
+}
+
+func TestParseScriptLine_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"ASSERT BALANCE BTC",
+		"ASSERT EQUITY BTC 1",
+		"ASSERT BALANCE XRP 1",
+		"EXPECT SUCCESS DEPOSIT BTC 1",
+		"EXPECT FAIL WITHDRAW BTC",
+		"CHECKPOINT",
+	} {
+		if rec := parseScriptLine(1, input); rec.err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestRunDirective_AssertBalanceDiff(t *testing.T) {
+	wallet := services.NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 50000000})
+
+	_, err := runDirective(wallet, parseScriptLine(1, "ASSERT BALANCE BTC 1.0"))
+	if !errors.Is(err, errAssertionFailed) {
+		t.Fatalf("Expected errAssertionFailed, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "expected 1.00000000, got 0.50000000 (diff -0.50000000)") {
+		t.Errorf("Expected a clear diff, got: %s", err)
+	}
+}
+
+func TestRunDirective_ExpectFail(t *testing.T) {
+	wallet := services.NewWallet()
+
+	if _, err := runDirective(wallet, parseScriptLine(1, "EXPECT FAIL WITHDRAW BTC 5")); err != nil {
+		t.Errorf("Expected withdrawal from an empty wallet to fail as expected, got: %v", err)
+	}
+	if _, err := runDirective(wallet, parseScriptLine(2, "EXPECT FAIL DEPOSIT BTC 5")); !errors.Is(err, errAssertionFailed) {
+		t.Errorf("Expected a successful deposit to fail the assertion, got: %v", err)
+	}
+	if balance := wallet.GetBalance(models.BTC); balance != 0 || len(wallet.GetTransactionHistory()) != 0 {
+		t.Errorf("Expected the assertion to leave the ledger alone, got BTC %d", balance)
+	}
+	if _, err := runDirective(wallet, parseScriptLine(3, "EXPECT FAIL DUPLICATE_ID WITHDRAW BTC 50")); !errors.Is(err, errAssertionFailed) {
+		t.Errorf("Expected a failure with the wrong code to fail the assertion, got: %v", err)
+	}
+}
+
+func TestRunFile_ScriptFailFast(t *testing.T) {
+	input := "DEPOSIT USD 10\nASSERT BALANCE USD 11\nDEPOSIT USD 1\n"
+	wallet := services.NewWallet()
+	var out bytes.Buffer
+
+	summary, err := runFile(wallet, strings.NewReader(input), &out, fileOptions{name: "spec.txt", format: "text", output: "text", failFast: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if summary.processed != 2 || summary.byCode["ASSERTION_FAILED"] != 1 {
+		t.Errorf("Expected the run to stop after the failed assertion, got %+v", summary)
+	}
+	if wallet.GetBalance(models.USD) != 1000 {
+		t.Errorf("Expected the line after the assertion not to run, got USD %d", wallet.GetBalance(models.USD))
+	}
+	if !strings.Contains(out.String(), "spec.txt:2: assertion failed: ASSERT BALANCE USD 11: expected 11.00, got 10.00 (diff -1.00)") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,325 @@
+package seed
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Errors reported for addresses
+var (
+	ErrInvalidAddress = &models.Error{Code: "INVALID_ADDRESS", Message: "invalid address"}
+)
+
+// BTCHRP is the human-readable part of mainnet SegWit addresses
+const BTCHRP = "bc"
+
+// ReceiveChain is the BIP44 change index of receive addresses; 1 is for
+// change
+const ReceiveChain = 0
+
+// AddressPath returns the BIP44 path of the receive address at index of
+// an asset's account, m/44'/coin type'/0'/0/index
+func AddressPath(asset models.Asset, index uint32) ([]uint32, error) {
+	path, err := AccountPath(asset)
+	if err != nil {
+		return nil, err
+	}
+	return append(path, ReceiveChain, index), nil
+}
+
+// ReceiveAddress derives the receive address at index from the account
+// key of asset, which may be an xpub
+func ReceiveAddress(account *ExtendedKey, asset models.Asset, index uint32) (string, error) {
+	if index >= Hardened {
+		return "", fmt.Errorf("%w: address index %d", ErrInvalidPath, index)
+	}
+	key, err := account.Derive([]uint32{ReceiveChain, index})
+	if err != nil {
+		return "", err
+	}
+	return Address(key, asset)
+}
+
+// Address encodes the public key of k as an address of asset: native
+// SegWit (P2WPKH) for BTC, EIP-55 checksummed hex for ETH
+func Address(k *ExtendedKey, asset models.Asset) (string, error) {
+	switch asset {
+	case models.BTC:
+		return SegWitAddress(BTCHRP, 0, Hash160(k.PublicKey()))
+	case models.ETH:
+		return ETHAddress(k.UncompressedPublicKey()), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrNoCoinType, asset)
+	}
+}
+
+// Version bytes of mainnet base58check addresses
+const (
+	p2pkhVersion = 0x00
+	p2shVersion  = 0x05
+)
+
+// NormalizeAddress checks that address is a mainnet address of asset with
+// a valid checksum and returns its canonical form. BTC takes SegWit
+// addresses, returned in lower case, and legacy base58check P2PKH and
+// P2SH ones. ETH takes 0x and 40 hex digits, returned with the EIP-55
+// checksum; mixed case must already carry it, while all lower or all
+// upper case carries none
+func NormalizeAddress(asset models.Asset, address string) (string, error) {
+	switch asset {
+	case models.BTC:
+		if prefix := strings.ToLower(address); strings.HasPrefix(prefix, BTCHRP+"1") {
+			if _, _, err := DecodeSegWitAddress(BTCHRP, address); err != nil {
+				return "", err
+			}
+			return prefix, nil
+		}
+		data, ok := DecodeBase58Check(address)
+		if !ok || len(data) != 21 || data[0] != p2pkhVersion && data[0] != p2shVersion {
+			return "", fmt.Errorf("%w: %q is not a bitcoin address", ErrInvalidAddress, address)
+		}
+		return address, nil
+	case models.ETH:
+		digits, ok := strings.CutPrefix(address, "0x")
+		raw, err := hex.DecodeString(digits)
+		if !ok || err != nil || len(raw) != 20 {
+			return "", fmt.Errorf("%w: %q is not 0x and 40 hex digits", ErrInvalidAddress, address)
+		}
+		checksummed := ChecksumETHAddress(raw)
+		if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && address != checksummed {
+			return "", fmt.Errorf("%w: bad EIP-55 checksum in %s", ErrInvalidAddress, address)
+		}
+		return checksummed, nil
+	default:
+		return "", fmt.Errorf("%w: the %s account has no addresses", ErrInvalidAddress, asset)
+	}
+}
+
+// ScriptSize returns the size in bytes of the output script that pays a
+// BTC address: OP_n and a push of the witness program for SegWit, 25
+// bytes for P2PKH and 23 for P2SH
+func ScriptSize(address string) (int, error) {
+	if strings.HasPrefix(strings.ToLower(address), BTCHRP+"1") {
+		_, program, err := DecodeSegWitAddress(BTCHRP, address)
+		if err != nil {
+			return 0, err
+		}
+		return 2 + len(program), nil
+	}
+	data, ok := DecodeBase58Check(address)
+	switch {
+	case ok && len(data) == 21 && data[0] == p2pkhVersion:
+		return 25, nil
+	case ok && len(data) == 21 && data[0] == p2shVersion:
+		return 23, nil
+	default:
+		return 0, fmt.Errorf("%w: %q is not a bitcoin address", ErrInvalidAddress, address)
+	}
+}
+
+// ETHAddress returns the EIP-55 address of a 65-byte uncompressed public
+// key: the last 20 bytes of the Keccak-256 of its coordinates
+func ETHAddress(uncompressed []byte) string {
+	return ChecksumETHAddress(keccak256(uncompressed[1:])[12:])
+}
+
+// ChecksumETHAddress formats 20 bytes as an EIP-55 address, where a hex
+// letter is upper case when the matching nibble of the Keccak-256 of the
+// lower-case hex is 8 or more
+func ChecksumETHAddress(address []byte) string {
+	lower := hex.EncodeToString(address)
+	hash := keccak256([]byte(lower))
+
+	out := []byte(lower)
+	for i, c := range out {
+		nibble := hash[i/2] >> (4 * (1 - i%2)) & 0xf
+		if c >= 'a' && nibble >= 8 {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// SegWitAddress encodes a witness program as a SegWit address: bech32
+// (BIP173) for version 0, bech32m (BIP350) for the later versions
+func SegWitAddress(hrp string, version byte, program []byte) (string, error) {
+	if err := checkWitness(version, program); err != nil {
+		return "", err
+	}
+	data := append([]byte{version}, convertBits(program, 8, 5, true)...)
+	return bech32Encode(hrp, data, bech32Variant(version)), nil
+}
+
+// DecodeSegWitAddress decodes a SegWit address of the network of hrp,
+// checking its checksum variant and its witness program
+func DecodeSegWitAddress(hrp, address string) (version byte, program []byte, err error) {
+	decodedHRP, data, variant, err := bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if decodedHRP != hrp {
+		return 0, nil, fmt.Errorf("%w: %q is not a %s address", ErrInvalidAddress, address, hrp)
+	}
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("%w: %q has no witness version", ErrInvalidAddress, address)
+	}
+
+	version = data[0]
+	if version > 16 {
+		return 0, nil, fmt.Errorf("%w: witness version %d", ErrInvalidAddress, version)
+	}
+	if variant != bech32Variant(version) {
+		return 0, nil, fmt.Errorf("%w: wrong checksum variant for witness version %d", ErrInvalidAddress, version)
+	}
+	program = convertBits(data[1:], 5, 8, false)
+	if program == nil {
+		return 0, nil, fmt.Errorf("%w: bad padding in %q", ErrInvalidAddress, address)
+	}
+	if err := checkWitness(version, program); err != nil {
+		return 0, nil, err
+	}
+	return version, program, nil
+}
+
+// checkWitness enforces the program sizes of BIP141: 2 to 40 bytes, and
+// 20 or 32 for version 0
+func checkWitness(version byte, program []byte) error {
+	if version > 16 || len(program) < 2 || len(program) > 40 || version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("%w: witness version %d with a %d-byte program", ErrInvalidAddress, version, len(program))
+	}
+	return nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants of bech32 and bech32m
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Variant(version byte) uint32 {
+	if version == 0 {
+		return bech32Const
+	}
+	return bech32mConst
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range generator {
+			if top>>i&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// hrpExpand returns the high bits of every character of hrp, a zero, then
+// the low bits, as the checksum covers them
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Encode(hrp string, data []byte, variant uint32) string {
+	values := append(hrpExpand(hrp), data...)
+	mod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ variant
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[mod>>(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// bech32Decode decodes a bech32 or bech32m string into its hrp and 5-bit
+// data, without the checksum, and reports which checksum it carries
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("%w: longer than 90 characters", ErrInvalidAddress)
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("%w: %q mixes upper and lower case", ErrInvalidAddress, s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return "", nil, 0, fmt.Errorf("%w: invalid character %q", ErrInvalidAddress, s[i])
+		}
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("%w: %q has no separator, hrp or checksum", ErrInvalidAddress, s)
+	}
+
+	hrp := s[:sep]
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, 0, fmt.Errorf("%w: invalid character %q", ErrInvalidAddress, s[i])
+		}
+		data = append(data, byte(d))
+	}
+
+	variant := bech32Polymod(append(hrpExpand(hrp), data...))
+	if variant != bech32Const && variant != bech32mConst {
+		return "", nil, 0, fmt.Errorf("%w: bad checksum in %q", ErrInvalidAddress, s)
+	}
+	return hrp, data[:len(data)-6], variant, nil
+}
+
+// convertBits regroups data from groups of from bits into groups of to
+// bits. Without pad, leftover bits must be zero padding shorter than a
+// group; it returns nil otherwise
+func convertBits(data []byte, from, to uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	maxValue := uint32(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, value := range data {
+		acc = acc<<from | uint32(value)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxValue))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxValue != 0 {
+		return nil
+	}
+	return out
+}
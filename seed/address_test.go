@@ -0,0 +1,219 @@
+package seed
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// witnessScript is the scriptPubKey of a witness program: OP_n then a push
+func witnessScript(version byte, program []byte) string {
+	op := version
+	if version > 0 {
+		op += 0x50
+	}
+	return hex.EncodeToString(append([]byte{op, byte(len(program))}, program...))
+}
+
+// TestSegWitAddress checks the valid addresses of BIP173 and BIP350 with
+// their scriptPubKeys
+func TestSegWitAddress(t *testing.T) {
+	tests := []struct {
+		hrp     string
+		address string
+		script  string
+	}{
+		{"bc", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc", "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"tb", "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc", "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bc", "BC1SW50QGDZ25J", "6002751e"},
+		{"bc", "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "5210751e76e8199196d454941c45d1b3a323"},
+		{"tb", "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"bc", "bc1paardr2nczq0rx5rqpfwnvpzm497zvux64y0f7wjgcs7xuuuh2nnqwr2d5c", "5120ef46d1aa78101e3350600a5d36045ba97c2670daa91e9f3a48c43c6e739754e6"},
+	}
+
+	for _, tt := range tests {
+		version, program, err := DecodeSegWitAddress(tt.hrp, tt.address)
+		if err != nil {
+			t.Errorf("%s: %v", tt.address, err)
+			continue
+		}
+		if script := witnessScript(version, program); script != tt.script {
+			t.Errorf("%s: expected script %s, got %s", tt.address, tt.script, script)
+		}
+		encoded, err := SegWitAddress(tt.hrp, version, program)
+		if err != nil || encoded != strings.ToLower(tt.address) {
+			t.Errorf("%s: expected to encode back, got %s, %v", tt.address, encoded, err)
+		}
+	}
+}
+
+// TestSegWitAddress_Invalid checks the invalid addresses of BIP173 and
+// BIP350
+func TestSegWitAddress_Invalid(t *testing.T) {
+	tests := []struct {
+		hrp     string
+		address string
+	}{
+		{"tb", "tc1qw508d6qejxtdg4y5r3zarvary0c5xw7kg3g4ty"},                                   // invalid hrp
+		{"bc", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5"},                                   // invalid checksum
+		{"bc", "BC13W508D6QEJXTDG4Y5R3ZARVARY0C5XW7KN40WF2"},                                   // invalid witness version
+		{"bc", "bc1rw5uspcuh"},                                                                 // program too short
+		{"bc", "bc10w508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kw5rljs90"}, // program too long
+		{"bc", "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P"},                                         // 16 bytes for version 0
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sL5k7"},               // mixed case
+		{"tb", "tb1pw508d6qejxtdg4y5r3zarqfsj6c3"},                                             // more than 4 bits of padding
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3pjxtptv"},               // non-zero padding
+		{"bc", "bc1gmk9yu"}, // empty data
+		{"bc", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd"}, // bech32 for version 1
+		{"tb", "tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf"}, // bech32 for version 2
+		{"bc", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh"},                     // bech32m for version 0
+		{"bc", "BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R"}, // version 17
+		{"bc", "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4"}, // invalid character in checksum
+		{"bc", "bc1pw5dgrnzv"}, // 1-byte program
+	}
+
+	for _, tt := range tests {
+		if _, _, err := DecodeSegWitAddress(tt.hrp, tt.address); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%s: expected ErrInvalidAddress, got %v", tt.address, err)
+		}
+	}
+}
+
+// TestChecksumETHAddress checks the examples of EIP-55
+func TestChecksumETHAddress(t *testing.T) {
+	for _, address := range []string{
+		"0x52908400098527886E0F7030069857D2E4169EE7",
+		"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+		"0xde709f2102306220921060314715629080e2fb77",
+		"0x27b1fdb04752bbc536007a920d24acb045561c26",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		raw, _ := hex.DecodeString(address[2:])
+		if got := ChecksumETHAddress(raw); got != address {
+			t.Errorf("Expected %s, got %s", address, got)
+		}
+	}
+}
+
+func TestAddress_PublicKeys(t *testing.T) {
+	// The generator point is the public key of the private key 1
+	one := &ExtendedKey{key: make([]byte, 32), private: true}
+	one.key[31] = 1
+
+	if got, _ := Address(one, models.BTC); got != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Errorf("Expected the P2WPKH address of G, got %s", got)
+	}
+	if got, _ := Address(one, models.ETH); got != "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf" {
+		t.Errorf("Expected the Ethereum address of G, got %s", got)
+	}
+	if _, err := Address(one, models.USD); !errors.Is(err, ErrNoCoinType) {
+		t.Errorf("Expected ErrNoCoinType, got %v", err)
+	}
+}
+
+// TestReceiveAddress derives the first addresses of the "abandon ...
+// about" mnemonic, which wallets publish for checking compatibility
+func TestReceiveAddress(t *testing.T) {
+	seed, err := Seed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _ := NewMaster(seed)
+
+	// BIP84 gives the SegWit account the purpose 84'; the encoding is
+	// the same one this wallet uses on its BIP44 paths
+	bip84, _ := master.Derive([]uint32{84 + Hardened, Hardened, Hardened})
+	if got, _ := ReceiveAddress(bip84, models.BTC, 0); got != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" {
+		t.Errorf("Expected the first BIP84 address, got %s", got)
+	}
+
+	eth, _ := AccountKey(seed, models.ETH)
+	if got, _ := ReceiveAddress(eth.Neuter(), models.ETH, 0); got != "0x9858EfFD232B4033E47d90003D41EC34EcaEda94" {
+		t.Errorf("Expected the first Ethereum address, got %s", got)
+	}
+
+	btc, _ := AccountKey(seed, models.BTC)
+	private, _ := ReceiveAddress(btc, models.BTC, 5)
+	public, _ := ReceiveAddress(btc.Neuter(), models.BTC, 5)
+	if private != public {
+		t.Errorf("Expected the xpub to derive the same address, got %s and %s", private, public)
+	}
+	if path, _ := AddressPath(models.BTC, 5); FormatPath(path) != "m/44'/0'/0'/0/5" {
+		t.Errorf("Expected m/44'/0'/0'/0/5, got %s", FormatPath(path))
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		asset    models.Asset
+		address  string
+		expected string // "" when invalid
+	}{
+		{models.BTC, "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{models.BTC, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+		{models.BTC, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{models.BTC, "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"},
+		{models.BTC, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", ""},         // bad checksum
+		{models.BTC, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", ""}, // testnet
+		{models.BTC, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", ""}, // bad checksum
+		{models.BTC, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ""},
+		{models.ETH, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{models.ETH, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{models.ETH, "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{models.ETH, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", ""}, // bad checksum
+		{models.ETH, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA", ""},   // too short
+		{models.ETH, "5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ""},   // no 0x
+		{models.USD, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ""},
+	}
+
+	for _, tt := range tests {
+		normalized, err := NormalizeAddress(tt.asset, tt.address)
+		if tt.expected == "" {
+			if !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("%s %s: expected ErrInvalidAddress, got %q, %v", tt.asset, tt.address, normalized, err)
+			}
+			continue
+		}
+		if err != nil || normalized != tt.expected {
+			t.Errorf("%s %s: expected %s, got %q, %v", tt.asset, tt.address, tt.expected, normalized, err)
+		}
+	}
+}
+
+func TestScriptSize(t *testing.T) {
+	tests := []struct {
+		address string
+		size    int // 0 when invalid
+	}{
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", 22},                     // P2WPKH
+		{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", 34}, // P2WSH
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", 34}, // P2TR
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", 25},                             // P2PKH
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", 23},                             // P2SH
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", 0},                      // testnet
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", 0},
+	}
+
+	for _, tt := range tests {
+		size, err := ScriptSize(tt.address)
+		if tt.size == 0 {
+			if !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("%s: expected ErrInvalidAddress, got %d, %v", tt.address, size, err)
+			}
+			continue
+		}
+		if err != nil || size != tt.size {
+			t.Errorf("%s: expected %d, got %d, %v", tt.address, tt.size, size, err)
+		}
+	}
+}
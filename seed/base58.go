@@ -0,0 +1,69 @@
+package seed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Base58Check encodes data followed by the first 4 bytes of its double
+// SHA-256, as Bitcoin does for extended keys and legacy addresses
+func Base58Check(data []byte) string {
+	sum := doubleSHA256(data)
+	return base58Encode(append(append([]byte{}, data...), sum[:4]...))
+}
+
+// DecodeBase58Check decodes a Base58Check string and verifies its checksum
+func DecodeBase58Check(s string) ([]byte, bool) {
+	decoded, ok := base58Decode(s)
+	if !ok || len(decoded) < 4 {
+		return nil, false
+	}
+	data, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	sum := doubleSHA256(data)
+	return data, bytes.Equal(checksum, sum[:4])
+}
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// Every leading zero byte is a leading 1
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, bool) {
+	n, radix := new(big.Int), big.NewInt(58)
+	zeros := 0
+	for i := 0; i < len(s); i++ {
+		digit := bytes.IndexByte([]byte(base58Alphabet), s[i])
+		if digit < 0 {
+			return nil, false
+		}
+		if digit == 0 && zeros == i {
+			zeros++
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
+
+func doubleSHA256(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
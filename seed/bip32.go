@@ -0,0 +1,298 @@
+package seed
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Errors reported for extended keys
+var (
+	ErrInvalidKey  = &models.Error{Code: "INVALID_KEY", Message: "invalid extended key"}
+	ErrInvalidPath = &models.Error{Code: "INVALID_PATH", Message: "invalid derivation path"}
+	ErrHardened    = &models.Error{Code: "HARDENED_FROM_PUBLIC", Message: "hardened child of a public key"}
+	ErrNoCoinType  = &models.Error{Code: "NO_COIN_TYPE", Message: "asset has no keys"}
+)
+
+// Hardened is added to a child index to derive a hardened child, which
+// needs the parent's private key
+const Hardened uint32 = 1 << 31
+
+// Version bytes of serialized mainnet extended keys
+var (
+	xprvVersion = []byte{0x04, 0x88, 0xad, 0xe4}
+	xpubVersion = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+// ExtendedKey is a BIP32 node: a private or public key with the chain code
+// that derives its children
+type ExtendedKey struct {
+	key         []byte // 32-byte private scalar, or 33-byte compressed point
+	chainCode   []byte
+	depth       byte
+	fingerprint []byte // first 4 bytes of the parent's key identifier
+	index       uint32
+	private     bool
+}
+
+// NewMaster returns the master private key of a seed of 16 to 64 bytes
+func NewMaster(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("%w: seed of %d bytes. Must be 16 to 64", ErrInvalidKey, len(seed))
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	k := new(big.Int).SetBytes(sum[:32])
+	if k.Sign() == 0 || k.Cmp(secp256k1.n) >= 0 {
+		return nil, fmt.Errorf("%w: master key out of range", ErrInvalidKey)
+	}
+	return &ExtendedKey{key: sum[:32], chainCode: sum[32:], fingerprint: make([]byte, 4), private: true}, nil
+}
+
+// IsPrivate reports whether k holds a private key
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.private
+}
+
+// Depth returns the number of derivations from the master key to k
+func (k *ExtendedKey) Depth() int {
+	return int(k.depth)
+}
+
+// PublicKey returns the 33-byte compressed public key of k
+func (k *ExtendedKey) PublicKey() []byte {
+	if !k.private {
+		return append([]byte{}, k.key...)
+	}
+	return compress(publicPoint(new(big.Int).SetBytes(k.key)))
+}
+
+// UncompressedPublicKey returns the 65-byte uncompressed public key of k,
+// as Ethereum addresses hash it
+func (k *ExtendedKey) UncompressedPublicKey() []byte {
+	if k.private {
+		return uncompress(publicPoint(new(big.Int).SetBytes(k.key)))
+	}
+	pt, _ := decompress(k.key)
+	return uncompress(pt)
+}
+
+// PrivateKey returns the 32-byte private key of k, or nil for a public key
+func (k *ExtendedKey) PrivateKey() []byte {
+	if !k.private {
+		return nil
+	}
+	return append([]byte{}, k.key...)
+}
+
+// Child derives the child of k at index; indexes from Hardened up are
+// hardened and need a private key
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if index >= Hardened && !k.private {
+		return nil, ErrHardened
+	}
+	if k.depth == 255 {
+		return nil, fmt.Errorf("%w: depth over 255", ErrInvalidKey)
+	}
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	if index >= Hardened {
+		mac.Write([]byte{0})
+		mac.Write(k.key)
+	} else {
+		mac.Write(k.PublicKey())
+	}
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	sum := mac.Sum(nil)
+
+	// An out of range tweak or a zero child has a probability below 2^-127;
+	// BIP32 has the caller move on to the next index
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(secp256k1.n) >= 0 {
+		return nil, fmt.Errorf("%w: child %d out of range", ErrInvalidKey, index)
+	}
+
+	child := &ExtendedKey{
+		chainCode:   sum[32:],
+		depth:       k.depth + 1,
+		fingerprint: Hash160(k.PublicKey())[:4],
+		index:       index,
+		private:     k.private,
+	}
+	if k.private {
+		scalar := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+		scalar.Mod(scalar, secp256k1.n)
+		if scalar.Sign() == 0 {
+			return nil, fmt.Errorf("%w: child %d out of range", ErrInvalidKey, index)
+		}
+		child.key = scalar.FillBytes(make([]byte, 32))
+	} else {
+		parent, _ := decompress(k.key)
+		pt := add(publicPoint(tweak), parent)
+		if pt.infinity() {
+			return nil, fmt.Errorf("%w: child %d out of range", ErrInvalidKey, index)
+		}
+		child.key = compress(pt)
+	}
+	return child, nil
+}
+
+// Derive follows path from k, one child per index
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	for _, index := range path {
+		var err error
+		if k, err = k.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Neuter returns the public key of k, which derives the same non-hardened
+// children without being able to spend them
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.private {
+		return k
+	}
+	public := *k
+	public.key = k.PublicKey()
+	public.private = false
+	return &public
+}
+
+// String serializes k as an xprv or xpub
+func (k *ExtendedKey) String() string {
+	data := make([]byte, 0, 78)
+	if k.private {
+		data = append(data, xprvVersion...)
+	} else {
+		data = append(data, xpubVersion...)
+	}
+	data = append(data, k.depth)
+	data = append(data, k.fingerprint...)
+	data = binary.BigEndian.AppendUint32(data, k.index)
+	data = append(data, k.chainCode...)
+	if k.private {
+		data = append(data, 0)
+	}
+	data = append(data, k.key...)
+	return Base58Check(data)
+}
+
+// ParseExtendedKey parses an xprv or xpub, checking that its key is valid
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	data, ok := DecodeBase58Check(s)
+	if !ok || len(data) != 78 {
+		return nil, fmt.Errorf("%w: bad encoding or checksum", ErrInvalidKey)
+	}
+
+	k := &ExtendedKey{
+		depth:       data[4],
+		fingerprint: data[5:9],
+		index:       binary.BigEndian.Uint32(data[9:13]),
+		chainCode:   data[13:45],
+	}
+	switch version, key := data[:4], data[45:]; {
+	case bytes.Equal(version, xprvVersion):
+		scalar := new(big.Int).SetBytes(key[1:])
+		if key[0] != 0 || scalar.Sign() == 0 || scalar.Cmp(secp256k1.n) >= 0 {
+			return nil, fmt.Errorf("%w: private key out of range", ErrInvalidKey)
+		}
+		k.key, k.private = key[1:], true
+	case bytes.Equal(version, xpubVersion):
+		if _, ok := decompress(key); !ok {
+			return nil, fmt.Errorf("%w: public key not on the curve", ErrInvalidKey)
+		}
+		k.key = key
+	default:
+		return nil, fmt.Errorf("%w: unknown version %x", ErrInvalidKey, version)
+	}
+	if k.depth == 0 && (k.index != 0 || !bytes.Equal(k.fingerprint, make([]byte, 4))) {
+		return nil, fmt.Errorf("%w: master key with a parent", ErrInvalidKey)
+	}
+	return k, nil
+}
+
+// ParsePath parses a derivation path such as m/44'/0'/0', where ' or h
+// marks a hardened index
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q. Must start with m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil || part == "" || part[0] == '+' {
+			return nil, fmt.Errorf("%w: %q: bad index %q", ErrInvalidPath, path, part)
+		}
+		if hardened {
+			index += uint64(Hardened)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// FormatPath is the inverse of ParsePath
+func FormatPath(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range path {
+		if index >= Hardened {
+			fmt.Fprintf(&b, "/%d'", index-Hardened)
+		} else {
+			fmt.Fprintf(&b, "/%d", index)
+		}
+	}
+	return b.String()
+}
+
+// AccountPath returns the BIP44 path of an asset's account,
+// m/44'/coin type'/0'. The wallet keeps one account per asset
+func AccountPath(asset models.Asset) ([]uint32, error) {
+	coinType, ok := asset.CoinType()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoCoinType, asset)
+	}
+	return []uint32{44 + Hardened, coinType + Hardened, Hardened}, nil
+}
+
+// AccountKey derives the private account key of asset from a seed
+func AccountKey(seed []byte, asset models.Asset) (*ExtendedKey, error) {
+	path, err := AccountPath(asset)
+	if err != nil {
+		return nil, err
+	}
+	master, err := NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	return master.Derive(path)
+}
+
+// Hash160 is RIPEMD-160 of SHA-256, the key identifier of BIP32 and the
+// hash in Bitcoin addresses
+func Hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
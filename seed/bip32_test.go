@@ -0,0 +1,145 @@
+package seed
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// TestBIP32Vectors checks test vectors 1 to 3 of BIP32: seed, path, and the
+// xpub and xprv at that path
+func TestBIP32Vectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/bip32.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		BIP32 [][]string `json:"bip32"`
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vector := range vectors.BIP32 {
+		seed, _ := hex.DecodeString(vector[0])
+		path, err := ParsePath(vector[1])
+		if err != nil {
+			t.Fatalf("%s: %v", vector[1], err)
+		}
+		master, err := NewMaster(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			t.Errorf("%s %s: %v", vector[0], vector[1], err)
+			continue
+		}
+		if got := key.Neuter().String(); got != vector[2] {
+			t.Errorf("%s %s: expected %s, got %s", vector[0], vector[1], vector[2], got)
+		}
+		if got := key.String(); got != vector[3] {
+			t.Errorf("%s %s: expected %s, got %s", vector[0], vector[1], vector[3], got)
+		}
+
+		for _, serialized := range vector[2:] {
+			parsed, err := ParseExtendedKey(serialized)
+			if err != nil || parsed.String() != serialized {
+				t.Errorf("Expected %s to round trip, got %v, %v", serialized, parsed, err)
+			}
+		}
+	}
+}
+
+func TestChild_WatchOnly(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	account, err := AccountKey(seed, models.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := ParseExtendedKey(account.Neuter().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public parent derives the public keys of the private children
+	for _, path := range [][]uint32{{0, 0}, {0, 7}, {1, 3}} {
+		private, _ := account.Derive(path)
+		public, err := xpub.Derive(path)
+		if err != nil || public.String() != private.Neuter().String() {
+			t.Errorf("%v: expected %s, got %v, %v", path, private.Neuter(), public, err)
+		}
+		if public.IsPrivate() || public.PrivateKey() != nil {
+			t.Errorf("%v: expected a public key only", path)
+		}
+	}
+
+	if _, err := xpub.Child(Hardened); !errors.Is(err, ErrHardened) {
+		t.Errorf("Expected ErrHardened, got %v", err)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"m", true},
+		{"m/44'/0'/0'/0/1", true},
+		{"m/44h/60h/0h", true},
+		{"m/2147483647'", true},
+		{"", false},
+		{"44'/0'", false},
+		{"m/", false},
+		{"m/x", false},
+		{"m/-1", false},
+		{"m/+1", false},
+		{"m/2147483648", false},
+	}
+
+	for _, tt := range tests {
+		path, err := ParsePath(tt.path)
+		if tt.valid != (err == nil) {
+			t.Errorf("%q: expected valid %v, got %v", tt.path, tt.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: expected ErrInvalidPath, got %v", tt.path, err)
+		}
+		if err == nil && tt.path != "m/44h/60h/0h" && FormatPath(path) != tt.path {
+			t.Errorf("%q: expected to format back, got %q", tt.path, FormatPath(path))
+		}
+	}
+}
+
+func TestAccountPath(t *testing.T) {
+	tests := []struct {
+		asset models.Asset
+		path  string
+	}{
+		{models.BTC, "m/44'/0'/0'"},
+		{models.ETH, "m/44'/60'/0'"},
+	}
+
+	for _, tt := range tests {
+		path, err := AccountPath(tt.asset)
+		if err != nil || FormatPath(path) != tt.path {
+			t.Errorf("%s: expected %s, got %s, %v", tt.asset, tt.path, FormatPath(path), err)
+		}
+	}
+	if _, err := AccountPath(models.USD); !errors.Is(err, ErrNoCoinType) {
+		t.Errorf("Expected ErrNoCoinType for USD, got %v", err)
+	}
+}
+
+func TestParseExtendedKey_Invalid(t *testing.T) {
+	xpub := "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	for _, s := range []string{"", "xpub", xpub[:len(xpub)-1] + "9", "0OIl"} {
+		if _, err := ParseExtendedKey(s); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package seed generates and restores the key material of a wallet
+//
+// A wallet's keys all derive from one seed, which a user backs up as a
+// BIP39 mnemonic: 12 to 24 English words whose last bits are a checksum
+package seed
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Errors reported for mnemonics
+var (
+	ErrInvalidMnemonic = &models.Error{Code: "INVALID_MNEMONIC", Message: "invalid mnemonic"}
+	ErrInvalidEntropy  = &models.Error{Code: "INVALID_ENTROPY", Message: "invalid entropy"}
+)
+
+// english is the BIP39 English wordlist, one word per line in index order
+//
+//go:embed english.txt
+var english string
+
+var (
+	wordlist    = strings.Fields(english)
+	wordIndexes = indexWords(wordlist)
+)
+
+func indexWords(words []string) map[string]int {
+	indexes := make(map[string]int, len(words))
+	for i, word := range words {
+		indexes[word] = i
+	}
+	return indexes
+}
+
+// seedIterations is the PBKDF2-HMAC-SHA512 cost fixed by BIP39
+const seedIterations = 2048
+
+// NewMnemonic returns a mnemonic of words words (12, 15, 18, 21 or 24)
+// drawn from the system's secure random source
+func NewMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", fmt.Errorf("%w: %d words. Must be 12, 15, 18, 21 or 24", ErrInvalidMnemonic, words)
+	}
+	entropy := make([]byte, words/3*4)
+	rand.Read(entropy)
+	return MnemonicFromEntropy(entropy)
+}
+
+// MnemonicFromEntropy encodes 16 to 32 bytes of entropy (a multiple of 4)
+// as a mnemonic: every 11 bits of the entropy followed by its checksum,
+// the first len(entropy)/4 bits of its SHA-256, select a word
+func MnemonicFromEntropy(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("%w: %d bytes. Must be 16 to 32, a multiple of 4", ErrInvalidEntropy, len(entropy))
+	}
+
+	checksum := sha256.Sum256(entropy)
+	bits := append(append([]byte{}, entropy...), checksum[0])
+	count := (len(entropy)*8 + len(entropy)/4) / 11
+	words := make([]string, count)
+	for i := range words {
+		words[i] = wordlist[readBits(bits, i*11, 11)]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// EntropyFromMnemonic decodes a mnemonic back into its entropy, checking
+// every word and the checksum
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: %d words. Must be 12, 15, 18, 21 or 24", ErrInvalidMnemonic, len(words))
+	}
+
+	bits := make([]byte, (len(words)*11+7)/8)
+	for i, word := range words {
+		index, ok := wordIndexes[strings.ToLower(word)]
+		if !ok {
+			return nil, fmt.Errorf("%w: word %d (%q) is not in the wordlist", ErrInvalidMnemonic, i+1, word)
+		}
+		writeBits(bits, i*11, 11, index)
+	}
+
+	size := len(words) * 11 * 32 / 33 / 8
+	entropy := bits[:size]
+	checksum := sha256.Sum256(entropy)
+	checksumBits := size / 4
+	if readBits(bits, size*8, checksumBits) != int(checksum[0]>>(8-checksumBits)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMnemonic)
+	}
+	return append([]byte{}, entropy...), nil
+}
+
+// ValidateMnemonic reports whether mnemonic is well formed with a valid
+// checksum
+func ValidateMnemonic(mnemonic string) error {
+	_, err := EntropyFromMnemonic(mnemonic)
+	return err
+}
+
+// Seed validates mnemonic and derives the 64-byte BIP39 seed from it and
+// passphrase, which may be empty. A different passphrase gives a
+// different, equally valid seed
+func Seed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(norm.NFKD.String(mnemonic))), " ")
+	salt := []byte(norm.NFKD.String("mnemonic" + passphrase))
+	return pbkdf2.Key(sha512.New, normalized, salt, seedIterations, 64)
+}
+
+// readBits returns the n bits of data starting at bit offset, most
+// significant first
+func readBits(data []byte, offset, n int) int {
+	value := 0
+	for i := offset; i < offset+n; i++ {
+		value = value<<1 | int(data[i/8]>>(7-i%8)&1)
+	}
+	return value
+}
+
+// writeBits stores the low n bits of value into data at bit offset
+func writeBits(data []byte, offset, n, value int) {
+	for i := 0; i < n; i++ {
+		if value>>(n-1-i)&1 == 1 {
+			bit := offset + i
+			data[bit/8] |= 1 << (7 - bit%8)
+		}
+	}
+}
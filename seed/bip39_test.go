@@ -0,0 +1,102 @@
+package seed
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// loadVectors reads the official BIP39 test vectors: entropy, mnemonic
+// and seed, with the passphrase "TREZOR"
+func loadVectors(t *testing.T) [][]string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/bip39.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		English [][]string `json:"english"`
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors.English
+}
+
+func TestWordlist(t *testing.T) {
+	if len(wordlist) != 2048 || wordlist[0] != "abandon" || wordlist[2047] != "zoo" {
+		t.Errorf("Expected the 2048 English words, got %d", len(wordlist))
+	}
+}
+
+func TestBIP39Vectors(t *testing.T) {
+	for _, vector := range loadVectors(t) {
+		entropy, _ := hex.DecodeString(vector[0])
+		mnemonic, err := MnemonicFromEntropy(entropy)
+		if err != nil || mnemonic != vector[1] {
+			t.Errorf("%s: expected %q, got %q, %v", vector[0], vector[1], mnemonic, err)
+			continue
+		}
+
+		decoded, err := EntropyFromMnemonic(mnemonic)
+		if err != nil || hex.EncodeToString(decoded) != vector[0] {
+			t.Errorf("%s: expected the entropy back, got %x, %v", vector[0], decoded, err)
+		}
+
+		seed, err := Seed(mnemonic, "TREZOR")
+		if err != nil || hex.EncodeToString(seed) != vector[2] {
+			t.Errorf("%s: expected seed %s, got %x, %v", vector[0], vector[2], seed, err)
+		}
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	for _, words := range []int{12, 24} {
+		mnemonic, err := NewMnemonic(words)
+		if err != nil || len(strings.Fields(mnemonic)) != words {
+			t.Errorf("Expected %d words, got %q, %v", words, mnemonic, err)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("Expected a valid mnemonic, got %v", err)
+		}
+	}
+	if _, err := NewMnemonic(13); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Errorf("Expected 13 words to be refused, got %v", err)
+	}
+}
+
+func TestValidateMnemonic_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		mnemonic string
+	}{
+		{"bad checksum", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"},
+		{"unknown word", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon hedix"},
+		{"wrong length", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		if err := ValidateMnemonic(tt.mnemonic); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("%s: expected ErrInvalidMnemonic, got %v", tt.name, err)
+		}
+		if _, err := Seed(tt.mnemonic, ""); err == nil {
+			t.Errorf("%s: expected no seed", tt.name)
+		}
+	}
+}
+
+func TestSeed_Restore(t *testing.T) {
+	mnemonic, _ := NewMnemonic(24)
+	first, _ := Seed(mnemonic, "extra")
+	restored, err := Seed("  "+strings.ToUpper(mnemonic)+"\n", "extra")
+	if err != nil || hex.EncodeToString(first) != hex.EncodeToString(restored) {
+		t.Errorf("Expected the same seed from the same words, got %v", err)
+	}
+	other, _ := Seed(mnemonic, "")
+	if hex.EncodeToString(first) == hex.EncodeToString(other) {
+		t.Errorf("Expected the passphrase to change the seed")
+	}
+}
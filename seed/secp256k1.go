@@ -0,0 +1,142 @@
+package seed
+
+import (
+	"math/big"
+)
+
+// secp256k1 is the elliptic curve y² = x³ + 7 over the field of p, with
+// generator (gx, gy) of prime order n, used by Bitcoin and Ethereum keys
+//
+// The arithmetic here uses math/big and is not constant time; it derives
+// keys and never signs
+var secp256k1 = struct {
+	p, n, gx, gy *big.Int
+}{
+	p:  hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+	n:  hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	gx: hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+	gy: hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+}
+
+func hexInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+// point is an affine point of the curve; nil coordinates are the point at
+// infinity
+type point struct {
+	x, y *big.Int
+}
+
+func (pt point) infinity() bool {
+	return pt.x == nil
+}
+
+// add returns a + b
+func add(a, b point) point {
+	p := secp256k1.p
+	switch {
+	case a.infinity():
+		return b
+	case b.infinity():
+		return a
+	case a.x.Cmp(b.x) == 0:
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return point{}
+		}
+		return double(a)
+	}
+
+	// λ = (y2 - y1) / (x2 - x1)
+	num := new(big.Int).Sub(b.y, a.y)
+	den := new(big.Int).Sub(b.x, a.x)
+	lambda := num.Mul(num, den.ModInverse(den.Mod(den, p), p))
+	return chord(a, b.x, lambda.Mod(lambda, p))
+}
+
+// double returns a + a
+func double(a point) point {
+	p := secp256k1.p
+	if a.infinity() || a.y.Sign() == 0 {
+		return point{}
+	}
+
+	// λ = 3x² / 2y
+	num := new(big.Int).Mul(a.x, a.x)
+	num.Mul(num, big.NewInt(3))
+	den := new(big.Int).Lsh(a.y, 1)
+	lambda := num.Mul(num, den.ModInverse(den.Mod(den, p), p))
+	return chord(a, a.x, lambda.Mod(lambda, p))
+}
+
+// chord returns the sum of a and the point with abscissa x2 on the line
+// of slope lambda through a
+func chord(a point, x2, lambda *big.Int) point {
+	p := secp256k1.p
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x).Sub(x, x2).Mod(x, p)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda).Sub(y, a.y).Mod(y, p)
+	return point{x, y}
+}
+
+// multiply returns k·pt by double-and-add
+func multiply(pt point, k *big.Int) point {
+	result := point{}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = double(result)
+		if k.Bit(i) == 1 {
+			result = add(result, pt)
+		}
+	}
+	return result
+}
+
+// publicPoint returns the public point of a private scalar
+func publicPoint(k *big.Int) point {
+	return multiply(point{secp256k1.gx, secp256k1.gy}, k)
+}
+
+// compress serializes a point as its x coordinate prefixed by the parity
+// of y: 33 bytes starting with 02 or 03
+func compress(pt point) []byte {
+	out := make([]byte, 33)
+	out[0] = 2 + byte(pt.y.Bit(0))
+	pt.x.FillBytes(out[1:])
+	return out
+}
+
+// uncompress serializes a point as 04, x and y: 65 bytes
+func uncompress(pt point) []byte {
+	out := make([]byte, 65)
+	out[0] = 4
+	pt.x.FillBytes(out[1:33])
+	pt.y.FillBytes(out[33:])
+	return out
+}
+
+// decompress parses a compressed point and checks that it is on the curve
+func decompress(data []byte) (point, bool) {
+	p := secp256k1.p
+	if len(data) != 33 || data[0] != 2 && data[0] != 3 {
+		return point{}, false
+	}
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(p) >= 0 {
+		return point{}, false
+	}
+
+	// y = sqrt(x³ + 7), which is (x³ + 7)^((p+1)/4) as p ≡ 3 mod 4
+	rhs := new(big.Int).Exp(x, big.NewInt(3), p)
+	rhs.Add(rhs, big.NewInt(7)).Mod(rhs, p)
+	exp := new(big.Int).Add(p, big.NewInt(1))
+	y := new(big.Int).Exp(rhs, exp.Rsh(exp, 2), p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(rhs) != 0 {
+		return point{}, false
+	}
+	if y.Bit(0) != uint(data[0]&1) {
+		y.Sub(p, y)
+	}
+	return point{x, y}, true
+}
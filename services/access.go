@@ -0,0 +1,247 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Role is a set of permissions granted to a user
+// Each role includes every permission of the roles before it
+type Role string
+
+const (
+	RoleViewer     Role = "viewer"     // see balances, history and approvals
+	RoleDepositor  Role = "depositor"  // and deposit
+	RoleWithdrawer Role = "withdrawer" // and withdraw
+	RoleAdmin      Role = "admin"      // and undo, and configure the wallet
+)
+
+// Permission is what an operation requires
+type Permission int
+
+const (
+	PermView Permission = iota
+	PermDeposit
+	PermWithdraw
+	PermAdmin
+	// PermApprove decides on approval requests. Every role grants it; the
+	// approval configuration names who may actually decide
+	PermApprove
+)
+
+var permissionNames = [...]string{"view", "deposit", "withdraw", "admin", "approve"}
+
+func (p Permission) String() string {
+	return permissionNames[p]
+}
+
+// roleLevels orders the roles by the highest permission they grant
+var roleLevels = map[Role]Permission{
+	RoleViewer:     PermView,
+	RoleDepositor:  PermDeposit,
+	RoleWithdrawer: PermWithdraw,
+	RoleAdmin:      PermAdmin,
+}
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("%w: unknown role %q. Must be viewer, depositor, withdrawer or admin", ErrInvalidAccess, name)
+	}
+	return role, nil
+}
+
+// User is someone who may act on the wallet
+// The wallet holds one account per asset; Accounts limits the user's role
+// to some of them, and is empty for every account. Admin is always
+// granted on every account
+type User struct {
+	Name     string
+	Role     Role
+	Accounts []models.Asset
+}
+
+// can reports whether the user has perm on the account of asset; an
+// empty asset asks for every account
+func (u User) can(perm Permission, asset models.Asset) bool {
+	level := perm
+	if perm == PermApprove {
+		level = PermView
+	}
+	if roleLevels[u.Role] < level {
+		return false
+	}
+	if u.Role == RoleAdmin || len(u.Accounts) == 0 {
+		return true
+	}
+	return asset != "" && slices.Contains(u.Accounts, asset)
+}
+
+// AccessControl is the set of users allowed to act on a wallet
+type AccessControl struct {
+	users map[string]User
+}
+
+// NewAccessControl checks users and returns the access control for them
+func NewAccessControl(users ...User) (*AccessControl, error) {
+	ac := &AccessControl{users: make(map[string]User, len(users))}
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("%w: a user has no name", ErrInvalidAccess)
+		}
+		if _, exists := ac.users[user.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate user %q", ErrInvalidAccess, user.Name)
+		}
+		if _, err := ParseRole(string(user.Role)); err != nil {
+			return nil, err
+		}
+		ac.users[user.Name] = user
+	}
+	return ac, nil
+}
+
+// clone returns a copy of ac, nil for none
+func (ac *AccessControl) clone() *AccessControl {
+	if ac == nil {
+		return nil
+	}
+	return &AccessControl{users: maps.Clone(ac.users)}
+}
+
+// EnableAccessControl makes every handle returned by As check the user's
+// permissions on each operation. The owner's handle is not checked
+func (w *Wallet) EnableAccessControl(ac *AccessControl) error {
+	if err := w.Authorize(PermAdmin, ""); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.access = ac
+	return nil
+}
+
+// As returns a handle to the same wallet acting on behalf of user
+// Every entry it records names the user as its Principal. Only the owner
+// and admins may act as another user; the handle keeps any Restrict scope
+func (w *Wallet) As(user string) (*Wallet, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.access == nil {
+		return nil, fmt.Errorf("%w: access control is not enabled", ErrUnknownUser)
+	}
+	if _, ok := w.access.users[user]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownUser, user)
+	}
+	if user != w.principal {
+		if err := w.authorize(PermAdmin, ""); err != nil {
+			return nil, err
+		}
+	}
+	return &Wallet{state: w.state, principal: user, scope: w.scope}, nil
+}
+
+// Scope narrows what a handle may do, whatever its user may
+type Scope struct {
+	Name        string         // who the scope is for, in error messages
+	Permissions []Permission   // the permissions kept; empty for none
+	Accounts    []models.Asset // the accounts kept; empty for every account
+}
+
+// allows reports whether the scope keeps perm on the account of asset; an
+// empty asset asks for every account
+func (s *Scope) allows(perm Permission, asset models.Asset) bool {
+	if !slices.Contains(s.Permissions, perm) {
+		return false
+	}
+	return len(s.Accounts) == 0 || asset != "" && slices.Contains(s.Accounts, asset)
+}
+
+// Restrict returns a handle to the same wallet, acting for the same user,
+// that may only do what scope keeps. Reads leave out the accounts outside
+// it, as they do for the accounts a user may not view
+func (w *Wallet) Restrict(scope Scope) *Wallet {
+	if w.scope != nil {
+		// Narrowing an already restricted handle keeps the intersection
+		narrowed := scope
+		narrowed.Permissions = nil
+		for _, perm := range scope.Permissions {
+			if slices.Contains(w.scope.Permissions, perm) {
+				narrowed.Permissions = append(narrowed.Permissions, perm)
+			}
+		}
+		if len(w.scope.Accounts) > 0 {
+			narrowed.Accounts = nil
+			for _, asset := range w.scope.Accounts {
+				if len(scope.Accounts) == 0 || slices.Contains(scope.Accounts, asset) {
+					narrowed.Accounts = append(narrowed.Accounts, asset)
+				}
+			}
+			if len(narrowed.Accounts) == 0 {
+				narrowed.Permissions = nil
+			}
+		}
+		scope = narrowed
+	}
+	return &Wallet{state: w.state, principal: w.principal, scope: &scope}
+}
+
+// Principal returns the user the handle acts for, or "" for the owner
+func (w *Wallet) Principal() string {
+	return w.principal
+}
+
+// Authorize reports whether the handle may perform an operation requiring
+// perm on the account of asset (every account when asset is empty)
+func (w *Wallet) Authorize(perm Permission, asset models.Asset) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.authorize(perm, asset)
+}
+
+// authorize implements Authorize; the caller holds w.mu
+func (w *Wallet) authorize(perm Permission, asset models.Asset) error {
+	account := "every account"
+	if asset != "" {
+		account = "the " + string(asset) + " account"
+	}
+	if w.scope != nil && !w.scope.allows(perm, asset) {
+		return fmt.Errorf("%w: %s may not %s on %s", ErrForbidden, w.scope.Name, perm, account)
+	}
+	if w.principal == "" {
+		return nil
+	}
+	if user, ok := w.access.users[w.principal]; ok && user.can(perm, asset) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s may not %s on %s", ErrForbidden, w.principal, perm, account)
+}
+
+// unrestricted reports whether the handle may do everything, so reads
+// need not be filtered
+func (w *Wallet) unrestricted() bool {
+	return w.principal == "" && w.scope == nil
+}
+
+// authorizeTx checks the permission a transaction needs; the caller
+// holds w.mu
+func (w *Wallet) authorizeTx(tx models.Transaction) error {
+	perm := PermDeposit
+	if tx.Type == models.Withdraw {
+		perm = PermWithdraw
+	}
+	return w.authorize(perm, tx.Asset)
+}
+
+// canView reports whether the handle may see the account of asset; reads
+// leave out the accounts it may not. The caller holds w.mu
+func (w *Wallet) canView(asset models.Asset) bool {
+	return w.authorize(PermView, asset) == nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func accessWallet(t *testing.T) *Wallet {
+	t.Helper()
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 10000})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000000})
+	ac, err := NewAccessControl(
+		User{Name: "vic", Role: RoleViewer},
+		User{Name: "dora", Role: RoleDepositor, Accounts: []models.Asset{models.USD}},
+		User{Name: "will", Role: RoleWithdrawer},
+		User{Name: "ada", Role: RoleAdmin},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.EnableAccessControl(ac); err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+func as(t *testing.T, wallet *Wallet, user string) *Wallet {
+	t.Helper()
+	handle, err := wallet.As(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handle
+}
+
+func TestAccess_RolesGrantPermissions(t *testing.T) {
+	wallet := accessWallet(t)
+	deposit := models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100}
+	withdraw := models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 100}
+
+	tests := []struct {
+		user     string
+		tx       models.Transaction
+		expected error
+	}{
+		{"vic", deposit, ErrForbidden},
+		{"dora", deposit, nil},
+		{"dora", withdraw, ErrForbidden},
+		{"dora", models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1}, ErrForbidden},
+		{"will", withdraw, nil},
+		{"ada", withdraw, nil},
+	}
+	for _, tt := range tests {
+		err := as(t, wallet, tt.user).ProcessTransaction(tt.tx)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s %s %s: expected %v, got %v", tt.user, tt.tx.Type, tt.tx.Asset, tt.expected, err)
+		}
+	}
+
+	if _, err := as(t, wallet, "will").Undo(); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected undo to require admin, got %v", err)
+	}
+	if _, err := as(t, wallet, "ada").Undo(); err != nil {
+		t.Errorf("Expected an admin to undo, got %v", err)
+	}
+	if _, err := wallet.As("mallory"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("Expected an unknown user to be refused, got %v", err)
+	}
+}
+
+func TestAccess_RecordsPrincipal(t *testing.T) {
+	wallet := accessWallet(t)
+	tx, err := as(t, wallet, "dora").Apply(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Principal != "dora" {
+		t.Errorf("Expected the entry to name dora, got %q", tx.Principal)
+	}
+
+	err = as(t, wallet, "will").ProcessBatch([]models.Transaction{{Type: models.Withdraw, Asset: models.BTC, Amount: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := wallet.GetTransactionHistory()
+	if last := history[len(history)-1]; last.Principal != "will" {
+		t.Errorf("Expected the batch entry to name will, got %q", last.Principal)
+	}
+	if history[0].Principal != "" {
+		t.Errorf("Expected the owner's entries to name no one, got %q", history[0].Principal)
+	}
+
+	// No one can pass an entry off as someone else's
+	if _, err := as(t, wallet, "dora").Apply(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100, Principal: "ada"}); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected a named principal to be refused, got %v", err)
+	}
+	if _, err := wallet.Apply(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100, Principal: "will"}); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected the owner to be refused a named principal, got %v", err)
+	}
+}
+
+func TestAccess_BatchRejectsForbiddenEntries(t *testing.T) {
+	wallet := accessWallet(t)
+	err := as(t, wallet, "dora").ProcessBatch([]models.Transaction{
+		{Type: models.Deposit, Asset: models.USD, Amount: 100},
+		{Type: models.Deposit, Asset: models.ETH, Amount: 100},
+	})
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected the ETH deposit to fail the batch, got %v", err)
+	}
+	if len(wallet.GetTransactionHistory()) != 2 {
+		t.Errorf("Expected nothing committed")
+	}
+}
+
+func TestAccess_ReadsHideOtherAccounts(t *testing.T) {
+	wallet := accessWallet(t)
+	dora := as(t, wallet, "dora")
+
+	if dora.GetBalance(models.BTC) != 0 || dora.GetBalance(models.USD) != 10000 {
+		t.Errorf("Expected dora to see only USD, got BTC %d and USD %d", dora.GetBalance(models.BTC), dora.GetBalance(models.USD))
+	}
+	if balances := dora.GetAllBalances(); len(balances) != 1 || balances[models.USD] != 10000 {
+		t.Errorf("Expected only the USD balance, got %v", balances)
+	}
+	if history := dora.GetTransactionHistory(); len(history) != 1 || history[0].Asset != models.USD {
+		t.Errorf("Expected only the USD entry, got %v", history)
+	}
+	if _, ok := dora.GetTransaction("2"); ok {
+		t.Errorf("Expected the BTC entry to be hidden")
+	}
+
+	if balances, ok := dora.BalancesAfter("1"); !ok || len(balances) != 1 || balances[models.USD] != 10000 {
+		t.Errorf("Expected only the USD balance after the USD entry, got %v", balances)
+	}
+	if _, ok := dora.BalancesAfter("2"); ok {
+		t.Errorf("Expected no balances after the hidden BTC entry")
+	}
+
+	replay, sub := dora.Subscribe(0)
+	defer sub.Close()
+	if len(replay) != 1 {
+		t.Fatalf("Expected only the USD entry replayed, got %d events", len(replay))
+	}
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1})
+	event := (<-sub.C).(TransactionAccepted)
+	if event.Transaction.Asset != models.USD || len(event.Balances) != 1 {
+		t.Errorf("Expected only the USD deposit and balance, got %+v", event)
+	}
+}
+
+func TestAccess_ApproversDecideAsThemselves(t *testing.T) {
+	wallet := accessWallet(t)
+	err := wallet.EnableApprovals(ApprovalConfig{
+		Approvers:  []string{"vic", "ada"},
+		Required:   1,
+		Thresholds: map[models.Asset]int64{models.USD: 1000},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending *PendingApprovalError
+	if err := as(t, wallet, "will").ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 5000}); !errors.As(err, &pending) {
+		t.Fatalf("Expected the withdrawal to be held, got %v", err)
+	}
+
+	if _, err := wallet.Approve(pending.Request.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected the owner not to decide, got %v", err)
+	}
+	viewOnly := as(t, wallet, "vic").Restrict(Scope{Name: "key", Permissions: []Permission{PermView}})
+	if _, err := viewOnly.Approve(pending.Request.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a scope without approve to be refused, got %v", err)
+	}
+	request, err := as(t, wallet, "vic").Approve(pending.Request.ID)
+	if err != nil || request.Status != ApprovalApproved {
+		t.Fatalf("Expected vic's approval to commit the withdrawal, got %v", err)
+	}
+	if tx, _ := wallet.GetTransaction(request.EntryID); tx.Principal != "will" {
+		t.Errorf("Expected the entry to name its submitter, got %q", tx.Principal)
+	}
+}
+
+func TestNewAccessControl_Invalid(t *testing.T) {
+	for _, users := range [][]User{
+		{{Name: "", Role: RoleViewer}},
+		{{Name: "a", Role: "root"}},
+		{{Name: "a", Role: RoleViewer}, {Name: "a", Role: RoleAdmin}},
+	} {
+		if _, err := NewAccessControl(users...); !errors.Is(err, ErrInvalidAccess) {
+			t.Errorf("%v: expected ErrInvalidAccess, got %v", users, err)
+		}
+	}
+}
+
+func TestRestrict_NarrowsHandle(t *testing.T) {
+	wallet := accessWallet(t)
+	scoped := as(t, wallet, "will").Restrict(Scope{Name: "key k1", Permissions: []Permission{PermView, PermDeposit}, Accounts: []models.Asset{models.BTC}})
+
+	if err := scoped.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 1}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected the scope to forbid withdrawals, got %v", err)
+	}
+	tx, err := scoped.Apply(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1})
+	if err != nil || tx.Principal != "will" {
+		t.Errorf("Expected a deposit as will, got %+v, %v", tx, err)
+	}
+	if balances := scoped.GetAllBalances(); len(balances) != 1 {
+		t.Errorf("Expected only the BTC balance, got %v", balances)
+	}
+
+	narrower := scoped.Restrict(Scope{Name: "key k2", Permissions: []Permission{PermView, PermWithdraw}})
+	if err := narrower.Authorize(PermView, models.USD); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected restricting again not to widen the accounts, got %v", err)
+	}
+	if err := narrower.Authorize(PermDeposit, models.BTC); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected restricting again to keep only common permissions, got %v", err)
+	}
+	if _, err := as(t, wallet, "will").As("ada"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected only admins to act as another user, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
+)
+
+// AddressDeriver derives the receive address at index of an asset's
+// account and returns it with its derivation path
+type AddressDeriver func(asset models.Asset, index uint32) (address, path string, err error)
+
+// AddressStore durably records generated receive addresses so they
+// survive restarts
+type AddressStore interface {
+	// Load returns every address recorded so far
+	Load() ([]ReceiveAddress, error)
+	// Save replaces the recorded addresses
+	Save(addresses []ReceiveAddress) error
+}
+
+// ReceiveAddress is an address generated for deposits into an account
+type ReceiveAddress struct {
+	Asset   models.Asset `json:"asset"`
+	Address string       `json:"address"`
+	Index   uint32       `json:"index"` // position in the account, from 0
+	Path    string       `json:"path"`  // derivation path of the address
+	Created time.Time    `json:"created"`
+}
+
+// EnableAddresses lets the wallet generate receive addresses with derive
+// and loads the addresses already in store, which may be nil for a
+// wallet that lives in memory. A deposit that names an address must name
+// one of its own account
+func (w *Wallet) EnableAddresses(derive AddressDeriver, store AddressStore) error {
+	var addresses []ReceiveAddress
+	if store != nil {
+		var err error
+		if addresses, err = store.Load(); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.derive = derive
+	w.addressStore = store
+	w.addresses = nil
+	w.addressIndex = make(map[string]int, len(addresses))
+	for _, address := range addresses {
+		w.addAddress(address)
+	}
+	return nil
+}
+
+// NewAddress generates the next receive address of an asset's account
+// It requires the deposit permission on the account
+func (w *Wallet) NewAddress(asset models.Asset) (ReceiveAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.authorize(PermDeposit, asset); err != nil {
+		return ReceiveAddress{}, err
+	}
+	if w.derive == nil {
+		return ReceiveAddress{}, ErrNoAddresses
+	}
+
+	index := uint32(0)
+	for _, address := range w.addresses {
+		if address.Asset == asset {
+			index++
+		}
+	}
+	generated, path, err := w.derive(asset, index)
+	if err != nil {
+		return ReceiveAddress{}, err
+	}
+	if _, exists := w.addressIndex[addressKey(generated)]; exists {
+		return ReceiveAddress{}, fmt.Errorf("%w: %s was generated twice", ErrInvalidAddress, generated)
+	}
+
+	address := ReceiveAddress{Asset: asset, Address: generated, Index: index, Path: path, Created: w.now()}
+	w.addAddress(address)
+	if err := w.saveAddresses(); err != nil {
+		w.addresses = w.addresses[:len(w.addresses)-1]
+		delete(w.addressIndex, addressKey(generated))
+		return ReceiveAddress{}, err
+	}
+	return address, nil
+}
+
+// Addresses returns the receive addresses of asset, or of every account
+// when asset is empty, that the user may view, oldest first
+func (w *Wallet) Addresses(asset models.Asset) []ReceiveAddress {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var addresses []ReceiveAddress
+	for _, address := range w.addresses {
+		if (asset == "" || address.Asset == asset) && w.canView(address.Asset) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Received returns the deposits received at address, oldest first
+func (w *Wallet) Received(address string) []models.Transaction {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	i, ok := w.addressIndex[addressKey(address)]
+	if !ok || !w.canView(w.addresses[i].Asset) {
+		return nil
+	}
+	var deposits []models.Transaction
+	for _, tx := range w.ledger.GetTransactions() {
+		if tx.Type == models.Deposit && tx.Address == w.addresses[i].Address {
+			deposits = append(deposits, tx)
+		}
+	}
+	return deposits
+}
+
+// checkAddress enforces that a deposit names one of the receive addresses
+// of its own account, if any, and checks the destination of a withdrawal
+// The caller holds w.mu
+func (w *Wallet) checkAddress(tx models.Transaction) error {
+	if tx.Type == models.Withdraw {
+		return w.checkDestination(tx)
+	}
+	if tx.Address == "" {
+		return nil
+	}
+	i, ok := w.addressIndex[addressKey(tx.Address)]
+	if !ok || w.addresses[i].Asset != tx.Asset {
+		return fmt.Errorf("%w: %s is not a receive address of the %s account", ErrUnknownAddress, tx.Address, tx.Asset)
+	}
+	return nil
+}
+
+// canonicalAddress returns the address of tx as it was generated, or in
+// the canonical form of its asset, since a user may type an address in
+// another case. An invalid address is returned as is, for validation to
+// report. The caller holds w.mu
+func (w *Wallet) canonicalAddress(tx models.Transaction) string {
+	if i, ok := w.addressIndex[addressKey(tx.Address)]; ok && tx.Type == models.Deposit {
+		return w.addresses[i].Address
+	}
+	if normalized, err := seed.NormalizeAddress(tx.Asset, tx.Address); err == nil {
+		return normalized
+	}
+	return tx.Address
+}
+
+func (w *Wallet) addAddress(address ReceiveAddress) {
+	w.addressIndex[addressKey(address.Address)] = len(w.addresses)
+	w.addresses = append(w.addresses, address)
+}
+
+// saveAddresses writes the addresses to the store; the caller holds w.mu
+func (w *Wallet) saveAddresses() error {
+	if w.addressStore == nil {
+		return nil
+	}
+	if err := w.addressStore.Save(w.addresses); err != nil {
+		return fmt.Errorf("saving addresses: %w", err)
+	}
+	return nil
+}
+
+// addressKey is the lookup key of an address: bech32 and EIP-55
+// addresses are both case-insensitive
+func addressKey(address string) string {
+	return strings.ToLower(address)
+}
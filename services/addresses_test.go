@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// memoryAddresses is an AddressStore kept in memory
+type memoryAddresses struct {
+	saved []ReceiveAddress
+	err   error
+}
+
+func (m *memoryAddresses) Load() ([]ReceiveAddress, error) {
+	return m.saved, nil
+}
+
+func (m *memoryAddresses) Save(addresses []ReceiveAddress) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.saved = append([]ReceiveAddress(nil), addresses...)
+	return nil
+}
+
+// testDeriver derives made-up addresses, upper case for ETH like EIP-55
+func testDeriver(asset models.Asset, index uint32) (string, string, error) {
+	if asset == models.ETH {
+		return fmt.Sprintf("0xADDR%d", index), fmt.Sprintf("m/44'/60'/0'/0/%d", index), nil
+	}
+	return fmt.Sprintf("%s-addr%d", asset, index), fmt.Sprintf("m/0/%d", index), nil
+}
+
+func TestNewAddress(t *testing.T) {
+	store := &memoryAddresses{}
+	wallet := NewWallet()
+	if _, err := wallet.NewAddress(models.BTC); !errors.Is(err, ErrNoAddresses) {
+		t.Errorf("Expected ErrNoAddresses before EnableAddresses, got %v", err)
+	}
+	if err := wallet.EnableAddresses(testDeriver, store); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, asset := range []models.Asset{models.BTC, models.ETH, models.BTC} {
+		if _, err := wallet.NewAddress(asset); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	btc := wallet.Addresses(models.BTC)
+	if len(btc) != 2 || btc[1].Address != "BTC-addr1" || btc[1].Index != 1 || btc[1].Path != "m/0/1" {
+		t.Errorf("Expected a second BTC address at index 1, got %+v", btc)
+	}
+	if len(store.saved) != 3 {
+		t.Errorf("Expected 3 saved addresses, got %d", len(store.saved))
+	}
+
+	// A wallet reopened from the store continues the sequence
+	reopened := NewWallet()
+	if err := reopened.EnableAddresses(testDeriver, store); err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := reopened.NewAddress(models.ETH); next.Index != 1 {
+		t.Errorf("Expected index 1, got %+v", next)
+	}
+
+	store.err = errors.New("disk full")
+	if _, err := reopened.NewAddress(models.BTC); err == nil || len(reopened.Addresses("")) != 4 {
+		t.Errorf("Expected a failed save to drop the address, got %v and %d addresses", err, len(reopened.Addresses("")))
+	}
+}
+
+func TestDeposit_Address(t *testing.T) {
+	wallet := NewWallet()
+	wallet.EnableAddresses(testDeriver, nil)
+	eth, _ := wallet.NewAddress(models.ETH)
+	btc, _ := wallet.NewAddress(models.BTC)
+
+	tests := []struct {
+		name     string
+		tx       models.Transaction
+		expected error
+	}{
+		{"OwnAccount", models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1, Address: eth.Address}, nil},
+		{"OtherCase", models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 2, Address: "0xaddr0"}, nil},
+		{"NoAddress", models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 4}, nil},
+		{"OtherAccount", models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1, Address: btc.Address}, ErrUnknownAddress},
+		{"Unknown", models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1, Address: "bc1qnowhere"}, ErrUnknownAddress},
+		{"WithdrawalToInvalid", models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1, Address: eth.Address}, ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := wallet.ProcessTransaction(tt.tx); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	received := wallet.Received("0xaddr0")
+	if len(received) != 2 || received[1].Address != eth.Address || received[0].Amount+received[1].Amount != 3 {
+		t.Errorf("Expected both deposits at %s, recorded as generated, got %+v", eth.Address, received)
+	}
+	if err := wallet.ProcessBatch([]models.Transaction{{Type: models.Deposit, Asset: models.BTC, Amount: 1, Address: "bc1qnowhere"}}); !errors.Is(err, ErrUnknownAddress) {
+		t.Errorf("Expected a batch to check addresses, got %v", err)
+	}
+}
+
+func TestAddresses_Access(t *testing.T) {
+	wallet := accessWallet(t)
+	wallet.EnableAddresses(testDeriver, nil)
+	if _, err := wallet.NewAddress(models.BTC); err != nil {
+		t.Fatal(err)
+	}
+
+	dora := as(t, wallet, "dora")
+	if _, err := dora.NewAddress(models.BTC); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a USD depositor not to generate BTC addresses, got %v", err)
+	}
+	if _, err := dora.NewAddress(models.USD); err != nil {
+		t.Errorf("Expected a depositor to generate addresses of their account, got %v", err)
+	}
+	if got := dora.Addresses(""); len(got) != 1 || got[0].Asset != models.USD {
+		t.Errorf("Expected only the USD address to be visible, got %+v", got)
+	}
+	if got := as(t, wallet, "vic").Addresses(""); len(got) != 2 {
+		t.Errorf("Expected a viewer to see every address, got %+v", got)
+	}
+}
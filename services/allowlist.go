@@ -0,0 +1,222 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
+)
+
+// AllowlistConfig makes withdrawals from some accounts go only to
+// addresses an admin approved beforehand
+type AllowlistConfig struct {
+	Accounts   []models.Asset // accounts that opted in
+	CoolingOff time.Duration  // how long a new address waits before it receives withdrawals
+}
+
+// clone returns a copy of c, nil for none
+func (c *AllowlistConfig) clone() *AllowlistConfig {
+	if c == nil {
+		return nil
+	}
+	copied := *c
+	copied.Accounts = slices.Clone(c.Accounts)
+	return &copied
+}
+
+// AllowlistStore durably records allowlisted addresses so they survive
+// restarts
+type AllowlistStore interface {
+	// Load returns every address recorded so far
+	Load() ([]AllowedAddress, error)
+	// Save replaces the recorded addresses
+	Save(addresses []AllowedAddress) error
+}
+
+// AllowedAddress is a withdrawal destination on the allowlist of an
+// account
+type AllowedAddress struct {
+	Asset   models.Asset `json:"asset"`
+	Address string       `json:"address"` // in canonical form, see seed.NormalizeAddress
+	Label   string       `json:"label,omitempty"`
+	Added   time.Time    `json:"added"`
+	AddedBy string       `json:"added_by,omitempty"` // empty for the wallet's owner
+	Active  time.Time    `json:"-"`                  // end of the cooling-off period in force; set by the wallet, never stored
+}
+
+// EnableAllowlist requires allowlisted destinations for withdrawals from
+// the accounts of cfg and loads the addresses already in store, which
+// may be nil for a wallet that lives in memory. The allowlist of an
+// account can be filled before the account opts in
+func (w *Wallet) EnableAllowlist(cfg AllowlistConfig, store AllowlistStore) error {
+	if cfg.CoolingOff < 0 {
+		return fmt.Errorf("%w: negative cooling-off period", ErrInvalidAllowlist)
+	}
+	for _, asset := range cfg.Accounts {
+		if _, ok := asset.CoinType(); !ok {
+			return fmt.Errorf("%w: the %s account has no addresses", ErrInvalidAllowlist, asset)
+		}
+	}
+
+	var allowed []AllowedAddress
+	if store != nil {
+		var err error
+		if allowed, err = store.Load(); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.allowlistConfig = &cfg
+	w.allowlistStore = store
+	w.allowlist = allowed
+	return nil
+}
+
+// AllowAddress puts address on the allowlist of an asset's account; it
+// receives withdrawals once the cooling-off period in force has passed
+// since it was added. It requires the admin role on the account
+func (w *Wallet) AllowAddress(asset models.Asset, address, label string) (AllowedAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.authorize(PermAdmin, asset); err != nil {
+		return AllowedAddress{}, err
+	}
+	normalized, err := seed.NormalizeAddress(asset, address)
+	if err != nil {
+		return AllowedAddress{}, err
+	}
+	if w.findAllowed(asset, normalized) >= 0 {
+		return AllowedAddress{}, fmt.Errorf("%w: %s is already on the %s allowlist", ErrInvalidAllowlist, normalized, asset)
+	}
+
+	entry := AllowedAddress{Asset: asset, Address: normalized, Label: label, Added: w.now(), AddedBy: w.principal}
+	w.allowlist = append(w.allowlist, entry)
+	if err := w.saveAllowlist(); err != nil {
+		w.allowlist = w.allowlist[:len(w.allowlist)-1]
+		return AllowedAddress{}, err
+	}
+	entry.Active = w.activeFrom(entry)
+	return entry, nil
+}
+
+// RemoveAllowedAddress takes address off the allowlist of an asset's
+// account at once. It requires the admin role on the account
+func (w *Wallet) RemoveAllowedAddress(asset models.Asset, address string) (AllowedAddress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.authorize(PermAdmin, asset); err != nil {
+		return AllowedAddress{}, err
+	}
+	normalized, err := seed.NormalizeAddress(asset, address)
+	if err != nil {
+		return AllowedAddress{}, err
+	}
+	i := w.findAllowed(asset, normalized)
+	if i < 0 {
+		return AllowedAddress{}, fmt.Errorf("%w: %s is not on the %s allowlist", ErrNotAllowlisted, normalized, asset)
+	}
+
+	removed := w.allowlist[i]
+	previous := w.allowlist
+	w.allowlist = slices.Delete(slices.Clone(w.allowlist), i, i+1)
+	if err := w.saveAllowlist(); err != nil {
+		w.allowlist = previous
+		return AllowedAddress{}, err
+	}
+	return removed, nil
+}
+
+// AllowedAddresses returns the allowlist of asset, or of every account
+// when asset is empty, that the user may view, oldest first
+func (w *Wallet) AllowedAddresses(asset models.Asset) []AllowedAddress {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var allowed []AllowedAddress
+	for _, entry := range w.allowlist {
+		if (asset == "" || entry.Asset == asset) && w.canView(entry.Asset) {
+			entry.Active = w.activeFrom(entry)
+			allowed = append(allowed, entry)
+		}
+	}
+	return allowed
+}
+
+// AllowlistRequired reports whether withdrawals from an asset's account
+// must go to an allowlisted address
+func (w *Wallet) AllowlistRequired(asset models.Asset) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.allowlistRequired(asset)
+}
+
+func (w *Wallet) allowlistRequired(asset models.Asset) bool {
+	return w.allowlistConfig != nil && slices.Contains(w.allowlistConfig.Accounts, asset)
+}
+
+// checkDestination enforces that a withdrawal names a valid address of its
+// asset, if any, and an active allowlisted one when its account opted in
+// Compensations made by Undo move nothing out and are exempt; only stamp
+// sets Reverses, from Undo, since every submitted entry that carries it is
+// refused. The caller holds w.mu
+func (w *Wallet) checkDestination(tx models.Transaction) error {
+	normalized := tx.Address
+	if tx.Address != "" {
+		var err error
+		if normalized, err = seed.NormalizeAddress(tx.Asset, tx.Address); err != nil {
+			return err
+		}
+	}
+	if tx.Reverses != "" || !w.allowlistRequired(tx.Asset) {
+		return nil
+	}
+
+	if tx.Address == "" {
+		return fmt.Errorf("%w: withdrawals from the %s account must name an allowlisted destination", ErrNotAllowlisted, tx.Asset)
+	}
+	i := w.findAllowed(tx.Asset, normalized)
+	if i < 0 {
+		return fmt.Errorf("%w: %s is not on the %s allowlist", ErrNotAllowlisted, normalized, tx.Asset)
+	}
+	if active := w.activeFrom(w.allowlist[i]); w.now().Before(active) {
+		return fmt.Errorf("%w: %s receives withdrawals from %s", ErrCoolingOff, normalized, active.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// activeFrom returns when an allowlisted address starts receiving
+// withdrawals: the current cooling-off period after it was added, however
+// long the period was then. The caller holds w.mu
+func (w *Wallet) activeFrom(entry AllowedAddress) time.Time {
+	if w.allowlistConfig == nil {
+		return entry.Added
+	}
+	return entry.Added.Add(w.allowlistConfig.CoolingOff)
+}
+
+// findAllowed returns the index of a normalized address in the
+// allowlist, or -1. The caller holds w.mu
+func (w *Wallet) findAllowed(asset models.Asset, address string) int {
+	return slices.IndexFunc(w.allowlist, func(entry AllowedAddress) bool {
+		return entry.Asset == asset && entry.Address == address
+	})
+}
+
+// saveAllowlist writes the allowlist to the store; the caller holds w.mu
+func (w *Wallet) saveAllowlist() error {
+	if w.allowlistStore == nil {
+		return nil
+	}
+	if err := w.allowlistStore.Save(w.allowlist); err != nil {
+		return fmt.Errorf("saving allowlist: %w", err)
+	}
+	return nil
+}
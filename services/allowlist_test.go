@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+const (
+	allowedETH = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	allowedBTC = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+)
+
+func TestWithdraw_DestinationValidated(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1000})
+
+	tests := []struct {
+		name     string
+		address  string
+		expected error
+	}{
+		{"NoDestination", "", nil},
+		{"SegWit", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", nil},
+		{"Legacy", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", nil},
+		{"BadChecksum", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", ErrInvalidAddress},
+		{"OtherAsset", allowedETH, ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := wallet.Apply(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 1, Address: tt.address})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if err == nil && tt.name == "SegWit" && tx.Address != allowedBTC {
+				t.Errorf("Expected the address in lower case, got %s", tx.Address)
+			}
+		})
+	}
+}
+
+func TestAllowlist_CoolingOff(t *testing.T) {
+	now := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	wallet := NewWallet()
+	wallet.now = func() time.Time { return now }
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1000})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1000})
+	store := &memoryAllowlist{}
+	if err := wallet.EnableAllowlist(AllowlistConfig{Accounts: []models.Asset{models.ETH}, CoolingOff: 24 * time.Hour}, store); err != nil {
+		t.Fatal(err)
+	}
+
+	withdraw := func(address string) error {
+		return wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1, Address: address})
+	}
+	if err := withdraw(""); !errors.Is(err, ErrNotAllowlisted) {
+		t.Errorf("Expected a destination to be required, got %v", err)
+	}
+	if err := withdraw(allowedETH); !errors.Is(err, ErrNotAllowlisted) {
+		t.Errorf("Expected an unknown destination to be refused, got %v", err)
+	}
+
+	entry, err := wallet.AllowAddress(models.ETH, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "cold storage")
+	if err != nil || entry.Address != allowedETH || !entry.Active.Equal(now.Add(24*time.Hour)) {
+		t.Fatalf("Expected the checksummed address active in 24h, got %+v, %v", entry, err)
+	}
+	if _, err := wallet.AllowAddress(models.ETH, allowedETH, ""); !errors.Is(err, ErrInvalidAllowlist) {
+		t.Errorf("Expected a duplicate to be refused, got %v", err)
+	}
+	if err := withdraw(allowedETH); !errors.Is(err, ErrCoolingOff) {
+		t.Errorf("Expected the new address to cool off, got %v", err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if err := withdraw(allowedETH); err != nil {
+		t.Errorf("Expected the address to receive withdrawals after cooling off, got %v", err)
+	}
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 1}); err != nil {
+		t.Errorf("Expected accounts that did not opt in to withdraw freely, got %v", err)
+	}
+
+	// Removal takes effect at once; compensations stay possible
+	if _, err := wallet.RemoveAllowedAddress(models.ETH, allowedETH); err != nil {
+		t.Fatal(err)
+	}
+	if err := withdraw(allowedETH); !errors.Is(err, ErrNotAllowlisted) {
+		t.Errorf("Expected a removed address to be refused, got %v", err)
+	}
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 5})
+	if _, err := wallet.Undo(); err != nil {
+		t.Errorf("Expected undoing a deposit to need no destination, got %v", err)
+	}
+	if len(store.saved) != 0 {
+		t.Errorf("Expected the removal to be saved, got %+v", store.saved)
+	}
+}
+
+func TestAllowlist_FilledBeforeOptingIn(t *testing.T) {
+	now := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	store := &memoryAllowlist{}
+
+	// A run without the account opted in, as when no config names it
+	before := NewWallet()
+	before.now = func() time.Time { return now }
+	before.EnableAllowlist(AllowlistConfig{}, store)
+	if _, err := before.AllowAddress(models.ETH, allowedETH, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	wallet := NewWallet()
+	wallet.now = func() time.Time { return now }
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1000})
+	if err := wallet.EnableAllowlist(AllowlistConfig{Accounts: []models.Asset{models.ETH}, CoolingOff: 24 * time.Hour}, store); err != nil {
+		t.Fatal(err)
+	}
+
+	withdraw := models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1, Address: allowedETH}
+	if err := wallet.ProcessTransaction(withdraw); !errors.Is(err, ErrCoolingOff) {
+		t.Errorf("Expected the address to cool off once the account opted in, got %v", err)
+	}
+	if allowed := wallet.AllowedAddresses(models.ETH); len(allowed) != 1 || !allowed[0].Active.Equal(store.saved[0].Added.Add(24*time.Hour)) {
+		t.Errorf("Expected the address active 24h after it was added, got %+v", allowed)
+	}
+
+	now = now.Add(23 * time.Hour)
+	if err := wallet.ProcessTransaction(withdraw); err != nil {
+		t.Errorf("Expected the address to receive withdrawals 24h after it was added, got %v", err)
+	}
+}
+
+func TestAllowlist_ForgedCompensation(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 5000})
+	if err := wallet.EnableAllowlist(AllowlistConfig{Accounts: []models.Asset{models.ETH}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 4000, Address: allowedETH, Reverses: "1"}
+	if err := wallet.ProcessTransaction(forged); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected a withdrawal claiming to compensate an entry to be refused, got %v", err)
+	}
+	if err := wallet.ProcessBatch([]models.Transaction{forged}); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected the batch to be refused, got %v", err)
+	}
+	if err := wallet.Fork().ProcessTransaction(forged); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected a fork to refuse it too, got %v", err)
+	}
+	if balance := wallet.GetBalance(models.ETH); balance != 5000 {
+		t.Errorf("Expected the ETH balance to stay 5000, got %d", balance)
+	}
+
+	// The wallet's own compensation is still exempt
+	compensation, err := wallet.Undo()
+	if err != nil || compensation.Reverses != "1" {
+		t.Errorf("Expected the deposit to be undone without a destination, got %+v, %v", compensation, err)
+	}
+}
+
+func TestAllowlist_AdminOnly(t *testing.T) {
+	wallet := accessWallet(t)
+	if _, err := as(t, wallet, "will").AllowAddress(models.BTC, allowedBTC, ""); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a withdrawer not to edit the allowlist, got %v", err)
+	}
+	if _, err := as(t, wallet, "ada").AllowAddress(models.BTC, allowedBTC, ""); err != nil {
+		t.Errorf("Expected an admin to edit the allowlist, got %v", err)
+	}
+	if err := wallet.EnableAllowlist(AllowlistConfig{Accounts: []models.Asset{models.USD}}, nil); !errors.Is(err, ErrInvalidAllowlist) {
+		t.Errorf("Expected USD, which has no addresses, not to opt in, got %v", err)
+	}
+}
+
+// memoryAllowlist is an AllowlistStore kept in memory
+type memoryAllowlist struct {
+	saved []AllowedAddress
+}
+
+func (m *memoryAllowlist) Load() ([]AllowedAddress, error) {
+	return m.saved, nil
+}
+
+func (m *memoryAllowlist) Save(addresses []AllowedAddress) error {
+	m.saved = append([]AllowedAddress(nil), addresses...)
+	return nil
+}
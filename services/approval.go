@@ -0,0 +1,383 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// ApprovalConfig makes the wallet hold large withdrawals for approval
+// A held withdrawal is committed once Required of the Approvers approve
+// it, and dropped once so many reject it that Required can no longer be
+// reached, or when it is not decided within Timeout
+type ApprovalConfig struct {
+	Approvers  []string               // names allowed to decide
+	Required   int                    // approvals needed, from 1 to len(Approvers)
+	Thresholds map[models.Asset]int64 // withdrawals above this amount (smallest units) are held
+	Timeout    time.Duration          // 0 for requests that never expire
+}
+
+// clone returns a copy of c, nil for none
+func (c *ApprovalConfig) clone() *ApprovalConfig {
+	if c == nil {
+		return nil
+	}
+	copied := *c
+	copied.Approvers = slices.Clone(c.Approvers)
+	copied.Thresholds = maps.Clone(c.Thresholds)
+	return &copied
+}
+
+// ApprovalStore durably records approval requests so they survive restarts
+type ApprovalStore interface {
+	// Load returns every request recorded so far
+	Load() ([]ApprovalRequest, error)
+	// Save replaces the recorded requests
+	Save(requests []ApprovalRequest) error
+}
+
+// ApprovalStatus is the state of an approval request
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved" // committed as EntryID
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalExpired  ApprovalStatus = "expired"
+)
+
+// ApprovalRequest is a transaction held until approvers decide on it
+// While it is pending, the amount of a held withdrawal is not available
+// to other withdrawals
+type ApprovalRequest struct {
+	ID          string                    `json:"id"`
+	Transaction models.Transaction        `json:"transaction"` // as submitted, timestamped on submission
+	Reason      string                    `json:"reason"`
+	Status      ApprovalStatus            `json:"status"`
+	Required    int                       `json:"required"`
+	Created     time.Time                 `json:"created"`
+	Expires     time.Time                 `json:"expires,omitzero"` // zero when it never expires
+	Decisions   []models.ApprovalDecision `json:"decisions"`
+	EntryID     string                    `json:"entry_id,omitempty"` // the ledger entry once approved
+}
+
+// Approvals counts the approving decisions
+func (r ApprovalRequest) Approvals() int {
+	count := 0
+	for _, decision := range r.Decisions {
+		if decision.Approved {
+			count++
+		}
+	}
+	return count
+}
+
+// EnableApprovals turns on the approval workflow and loads the requests
+// already in store, which may be nil for a wallet that lives in memory
+func (w *Wallet) EnableApprovals(cfg ApprovalConfig, store ApprovalStore) error {
+	if cfg.Required < 1 || cfg.Required > len(cfg.Approvers) {
+		return fmt.Errorf("%w: %d approvals required from %d approvers", ErrInvalidApproval, cfg.Required, len(cfg.Approvers))
+	}
+	for i, name := range cfg.Approvers {
+		if name == "" || slices.Contains(cfg.Approvers[:i], name) {
+			return fmt.Errorf("%w: approver names must be unique and not empty", ErrInvalidApproval)
+		}
+	}
+
+	var requests []ApprovalRequest
+	if store != nil {
+		var err error
+		if requests, err = store.Load(); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.approval = &cfg
+	w.approvalStore = store
+	w.requests = nil
+	for i := range requests {
+		w.requests = append(w.requests, &requests[i])
+	}
+
+	// An approved entry is committed before its request is saved; finish
+	// any request whose entry made it to the ledger before a crash
+	changed := false
+	for _, tx := range w.ledger.GetTransactions() {
+		if tx.Approval == nil {
+			continue
+		}
+		if request := w.findRequest(tx.Approval.Request); request != nil && request.Status == ApprovalPending {
+			request.Status = ApprovalApproved
+			request.Decisions = tx.Approval.Decisions
+			request.EntryID = tx.ID
+			changed = true
+		}
+	}
+	if changed {
+		return w.saveRequests()
+	}
+	return nil
+}
+
+// PendingApprovals returns the requests still waiting for a decision,
+// oldest first
+func (w *Wallet) PendingApprovals() []ApprovalRequest {
+	w.mu.Lock()
+	defer w.unlock()
+
+	w.expireRequests()
+	var pending []ApprovalRequest
+	for _, request := range w.requests {
+		if request.Status == ApprovalPending && w.canView(request.Transaction.Asset) {
+			pending = append(pending, copyRequest(request))
+		}
+	}
+	return pending
+}
+
+// GetApprovalRequest looks up a request by its ID, whatever its status
+func (w *Wallet) GetApprovalRequest(id string) (ApprovalRequest, bool) {
+	w.mu.Lock()
+	defer w.unlock()
+
+	w.expireRequests()
+	request := w.findRequest(id)
+	if request == nil || !w.canView(request.Transaction.Asset) {
+		return ApprovalRequest{}, false
+	}
+	return copyRequest(request), true
+}
+
+// Approve records the approval of a pending request by the handle's user,
+// who must be an approver other than the request's submitter. The approval
+// that reaches the required count commits the transaction, with the whole
+// trail in its Approval; the returned request then has its EntryID
+func (w *Wallet) Approve(id string) (ApprovalRequest, error) {
+	return w.decide(id, true)
+}
+
+// Reject records the rejection of a pending request by the handle's user.
+// Once so many approvers rejected it that the required approvals cannot
+// be reached, the request is rejected and its funds are released
+func (w *Wallet) Reject(id string) (ApprovalRequest, error) {
+	return w.decide(id, false)
+}
+
+func (w *Wallet) decide(id string, approve bool) (ApprovalRequest, error) {
+	w.mu.Lock()
+	defer w.unlock()
+
+	if w.approval == nil {
+		return ApprovalRequest{}, fmt.Errorf("%w: %s", ErrUnknownRequest, id)
+	}
+	w.expireRequests()
+	request := w.findRequest(id)
+	if request == nil {
+		return ApprovalRequest{}, fmt.Errorf("%w: %s", ErrUnknownRequest, id)
+	}
+	if err := w.authorize(PermApprove, request.Transaction.Asset); err != nil {
+		// A request on an account the user cannot see stays hidden
+		if !w.canView(request.Transaction.Asset) {
+			return ApprovalRequest{}, fmt.Errorf("%w: %s", ErrUnknownRequest, id)
+		}
+		return ApprovalRequest{}, err
+	}
+	approver := w.principal
+	switch {
+	case approver == "":
+		return ApprovalRequest{}, fmt.Errorf("%w: decisions must be made as a named user", ErrForbidden)
+	case request.Status != ApprovalPending:
+		return copyRequest(request), fmt.Errorf("%w: %s is %s", ErrRequestClosed, id, request.Status)
+	case !slices.Contains(w.approval.Approvers, approver):
+		return copyRequest(request), fmt.Errorf("%w: %q", ErrNotApprover, approver)
+	case approve && approver == request.Transaction.Principal:
+		return copyRequest(request), fmt.Errorf("%w: %q submitted %s", ErrSelfApproval, approver, id)
+	}
+	for _, decision := range request.Decisions {
+		if decision.Approver == approver {
+			return copyRequest(request), fmt.Errorf("%w: %q already decided on %s", ErrAlreadyDecided, approver, id)
+		}
+	}
+
+	before := copyRequest(request)
+	request.Decisions = append(request.Decisions, models.ApprovalDecision{Approver: approver, Approved: approve, At: w.now()})
+	rejections := len(request.Decisions) - request.Approvals()
+
+	switch {
+	case request.Approvals() >= request.Required:
+		// Release the hold first so the withdrawal is checked against
+		// the funds it reserved
+		request.Status = ApprovalApproved
+		entry, err := w.commitApproved(request)
+		if err != nil {
+			*request = before
+			return before, err
+		}
+		request.EntryID = entry.ID
+	case rejections > len(w.approval.Approvers)-request.Required:
+		request.Status = ApprovalRejected
+		w.publishRejected(request.Transaction, fmt.Errorf("%w: request %s", ErrApprovalRejected, request.ID))
+	}
+
+	if err := w.saveRequests(); err != nil {
+		if request.Status != ApprovalApproved {
+			*request = before
+		}
+		return copyRequest(request), err
+	}
+	return copyRequest(request), nil
+}
+
+// commitApproved validates and commits the transaction of an approved
+// request; the caller holds w.mu
+func (w *Wallet) commitApproved(request *ApprovalRequest) (models.Transaction, error) {
+	tx := request.Transaction
+	if err := w.validate(tx, w.available(tx.Asset)); err != nil {
+		return models.Transaction{}, err
+	}
+
+	committed, err := w.commitWith(&models.Approval{
+		Request:   request.ID,
+		Reason:    request.Reason,
+		Decisions: slices.Clone(request.Decisions),
+	}, tx)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	w.publishAccepted(committed)
+	return committed[0], nil
+}
+
+// approvalReason returns why tx must be held for approval, or "" when it
+// need not be. The caller holds w.mu
+func (w *Wallet) approvalReason(tx models.Transaction) string {
+	if w.approval == nil || tx.Type != models.Withdraw {
+		return ""
+	}
+	threshold, ok := w.approval.Thresholds[tx.Asset]
+	if !ok || tx.Amount <= threshold {
+		return ""
+	}
+	return fmt.Sprintf("withdrawal above %s %s", tx.Asset.Format(threshold), tx.Asset)
+}
+
+// hold records tx as a pending request and returns the error Apply
+// reports for it. The caller holds w.mu
+func (w *Wallet) hold(tx models.Transaction, reason string) error {
+	now := w.now()
+	if tx.Timestamp.IsZero() {
+		tx.Timestamp = now
+	}
+	request := &ApprovalRequest{
+		ID:          "A" + strconv.Itoa(len(w.requests)+1),
+		Transaction: tx,
+		Reason:      reason,
+		Status:      ApprovalPending,
+		Required:    w.approval.Required,
+		Created:     now,
+		Decisions:   []models.ApprovalDecision{},
+	}
+	if w.approval.Timeout > 0 {
+		request.Expires = now.Add(w.approval.Timeout)
+	}
+
+	w.requests = append(w.requests, request)
+	if err := w.saveRequests(); err != nil {
+		w.requests = w.requests[:len(w.requests)-1]
+		return err
+	}
+	w.publish(ApprovalRequested{Request: copyRequest(request)})
+	return &PendingApprovalError{Request: copyRequest(request)}
+}
+
+// held returns the amount of asset reserved by pending withdrawals
+// The caller holds w.mu (read or write)
+func (w *Wallet) held(asset models.Asset) int64 {
+	var total int64
+	now := w.now()
+	for _, request := range w.requests {
+		tx := request.Transaction
+		if request.Status == ApprovalPending && !request.expired(now) && tx.Type == models.Withdraw && tx.Asset == asset {
+			total += tx.Amount
+		}
+	}
+	return total
+}
+
+// available returns the balance of asset that is not held for approval
+// The caller holds w.mu
+func (w *Wallet) available(asset models.Asset) int64 {
+	return w.ledger.CalculateBalance(asset) - w.held(asset)
+}
+
+// GetAvailableBalance returns the balance of asset minus the withdrawals
+// held for approval (in smallest units)
+func (w *Wallet) GetAvailableBalance(asset models.Asset) int64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.canView(asset) {
+		return 0
+	}
+	return w.available(asset)
+}
+
+func (r *ApprovalRequest) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// expireRequests marks pending requests past their timeout as expired and
+// releases their funds. The caller holds w.mu
+func (w *Wallet) expireRequests() {
+	now := w.now()
+	changed := false
+	for _, request := range w.requests {
+		if request.Status == ApprovalPending && request.expired(now) {
+			request.Status = ApprovalExpired
+			w.publishRejected(request.Transaction, fmt.Errorf("%w: request %s", ErrApprovalExpired, request.ID))
+			changed = true
+		}
+	}
+	if changed {
+		// Expiry is derived from the clock, so a failed save is redone by
+		// the next call
+		w.saveRequests()
+	}
+}
+
+func (w *Wallet) findRequest(id string) *ApprovalRequest {
+	for _, request := range w.requests {
+		if request.ID == id {
+			return request
+		}
+	}
+	return nil
+}
+
+// saveRequests writes every request to the store; the caller holds w.mu
+func (w *Wallet) saveRequests() error {
+	if w.approvalStore == nil {
+		return nil
+	}
+	requests := make([]ApprovalRequest, len(w.requests))
+	for i, request := range w.requests {
+		requests[i] = *request
+	}
+	if err := w.approvalStore.Save(requests); err != nil {
+		return fmt.Errorf("saving approval requests: %w", err)
+	}
+	return nil
+}
+
+func copyRequest(request *ApprovalRequest) ApprovalRequest {
+	copied := *request
+	copied.Decisions = slices.Clone(request.Decisions)
+	return copied
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// memoryApprovals is an ApprovalStore that keeps the last save in memory
+type memoryApprovals struct {
+	saved []ApprovalRequest
+}
+
+func (m *memoryApprovals) Load() ([]ApprovalRequest, error) {
+	return append([]ApprovalRequest(nil), m.saved...), nil
+}
+
+func (m *memoryApprovals) Save(requests []ApprovalRequest) error {
+	m.saved = requests
+	return nil
+}
+
+func approvalWallet(t *testing.T, store ApprovalStore) *Wallet {
+	t.Helper()
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100000})
+	ac, err := NewAccessControl(
+		User{Name: "alice", Role: RoleWithdrawer},
+		User{Name: "bob", Role: RoleViewer},
+		User{Name: "carol", Role: RoleViewer},
+		User{Name: "mallory", Role: RoleViewer},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.EnableAccessControl(ac); err != nil {
+		t.Fatal(err)
+	}
+	err = wallet.EnableApprovals(ApprovalConfig{
+		Approvers:  []string{"alice", "bob", "carol"},
+		Required:   2,
+		Thresholds: map[models.Asset]int64{models.USD: 50000},
+		Timeout:    time.Hour,
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+func TestApproval_HoldsFundsUntilApproved(t *testing.T) {
+	store := &memoryApprovals{}
+	wallet := approvalWallet(t, store)
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 80000})
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) || pending.Request.ID != "A1" {
+		t.Fatalf("Expected the withdrawal to be held as A1, got %v", err)
+	}
+	if wallet.GetBalance(models.USD) != 100000 || wallet.GetAvailableBalance(models.USD) != 20000 {
+		t.Errorf("Expected 800.00 held, got balance %d and available %d", wallet.GetBalance(models.USD), wallet.GetAvailableBalance(models.USD))
+	}
+	err = wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 30000})
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected held funds not to be withdrawable, got %v", err)
+	}
+
+	if _, err := wallet.Approve("A1"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected the owner not to decide, got %v", err)
+	}
+	if _, err := as(t, wallet, "mallory").Approve("A1"); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("Expected an unknown approver to be refused, got %v", err)
+	}
+	as(t, wallet, "alice").Approve("A1")
+	if _, err := as(t, wallet, "alice").Approve("A1"); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("Expected a second vote to be refused, got %v", err)
+	}
+	request, err := as(t, wallet, "bob").Approve("A1")
+	if err != nil || request.Status != ApprovalApproved || request.EntryID != "2" {
+		t.Fatalf("Expected A1 committed as entry 2, got %+v, %v", request, err)
+	}
+
+	entry, _ := wallet.GetTransaction("2")
+	if entry.Approval == nil || entry.Approval.Request != "A1" || len(entry.Approval.Decisions) != 2 {
+		t.Errorf("Expected the approval trail on the entry, got %+v", entry.Approval)
+	}
+	if wallet.GetBalance(models.USD) != 20000 || len(wallet.PendingApprovals()) != 0 {
+		t.Errorf("Expected the withdrawal committed and nothing pending, got %d", wallet.GetBalance(models.USD))
+	}
+	if len(store.saved) != 1 || store.saved[0].Status != ApprovalApproved {
+		t.Errorf("Expected the decided request to be saved, got %+v", store.saved)
+	}
+}
+
+func TestApproval_RejectAndExpire(t *testing.T) {
+	wallet := approvalWallet(t, nil)
+	now := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	wallet.now = func() time.Time { return now }
+
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 60000})
+
+	as(t, wallet, "alice").Reject("A1")
+	request, _ := as(t, wallet, "bob").Reject("A1")
+	if request.Status != ApprovalRejected {
+		t.Errorf("Expected two of three rejections to reject A1, got %s", request.Status)
+	}
+	if _, err := as(t, wallet, "carol").Approve("A1"); !errors.Is(err, ErrRequestClosed) {
+		t.Errorf("Expected no decisions on a rejected request, got %v", err)
+	}
+
+	// The rejection released the funds, so they can be held again
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 90000})
+	if !errors.Is(err, ErrApprovalPending) {
+		t.Fatalf("Expected A2 to be held, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if pending := wallet.PendingApprovals(); len(pending) != 0 {
+		t.Errorf("Expected A2 to expire after the timeout, got %+v", pending)
+	}
+	if request, _ := wallet.GetApprovalRequest("A2"); request.Status != ApprovalExpired {
+		t.Errorf("Expected A2 expired, got %s", request.Status)
+	}
+	if available := wallet.GetAvailableBalance(models.USD); available != 100000 {
+		t.Errorf("Expected every hold released, got %d available", available)
+	}
+}
+
+func TestApproval_PolicyRuleAndReload(t *testing.T) {
+	store := &memoryApprovals{}
+	wallet := approvalWallet(t, store)
+	wallet.SetPolicy(&Policy{Rules: []PolicyRule{mustRule(t, "WITHDRAW USD > 10 requires approval")}})
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 2000})
+	var pending *PendingApprovalError
+	if !errors.As(err, &pending) || pending.Request.Reason != "policy: WITHDRAW USD > 10 requires approval" {
+		t.Fatalf("Expected the policy rule to hold the withdrawal, got %v", err)
+	}
+
+	// Another process sees the request and approves it
+	reopened := NewWallet()
+	reopened.ledger = wallet.ledger.Clone()
+	reopened.SetPolicy(wallet.policy)
+	if err := reopened.EnableAccessControl(wallet.access); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.EnableApprovals(*wallet.approval, store); err != nil {
+		t.Fatal(err)
+	}
+	as(t, reopened, "carol").Approve("A1")
+	if request, err := as(t, reopened, "alice").Approve("A1"); err != nil || request.Status != ApprovalApproved {
+		t.Errorf("Expected the approved withdrawal to pass the policy, got %+v, %v", request, err)
+	}
+}
+
+func TestApproval_SubmitterMayNotApprove(t *testing.T) {
+	wallet := approvalWallet(t, nil)
+	alice := as(t, wallet, "alice")
+
+	if err := alice.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 60000}); !errors.Is(err, ErrApprovalPending) {
+		t.Fatalf("Expected the withdrawal to be held, got %v", err)
+	}
+	if _, err := alice.Approve("A1"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("Expected the submitter's approval to be refused, got %v", err)
+	}
+	as(t, wallet, "bob").Approve("A1")
+	request, err := as(t, wallet, "carol").Approve("A1")
+	if err != nil || request.Status != ApprovalApproved || len(request.Decisions) != 2 {
+		t.Errorf("Expected two other approvers to commit it, got %+v, %v", request, err)
+	}
+}
+
+func mustRule(t *testing.T, text string) PolicyRule {
+	t.Helper()
+	rule, err := ParsePolicyRule(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
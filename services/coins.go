@@ -0,0 +1,315 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
+)
+
+// SelectionStrategy is an algorithm that chooses the outputs a BTC
+// withdrawal spends
+type SelectionStrategy string
+
+const (
+	// LargestFirst spends the largest outputs until they cover the amount
+	LargestFirst SelectionStrategy = "largest-first"
+	// BranchAndBound searches for outputs that cover the amount without
+	// change, and falls back to Knapsack when there are none
+	BranchAndBound SelectionStrategy = "branch-and-bound"
+	// Knapsack looks for the smallest total of small outputs over the
+	// amount, or else the smallest single output over it, like Bitcoin Core
+	Knapsack SelectionStrategy = "knapsack"
+)
+
+// ParseSelectionStrategy validates a strategy name
+func ParseSelectionStrategy(name string) (SelectionStrategy, error) {
+	switch strategy := SelectionStrategy(name); strategy {
+	case LargestFirst, BranchAndBound, Knapsack:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("%w: unknown strategy %q. Must be largest-first, branch-and-bound or knapsack", ErrInvalidCoinSelection, name)
+	}
+}
+
+// CoinSelection configures how BTC withdrawals choose their inputs and
+// the fee they pay
+type CoinSelection struct {
+	Strategy SelectionStrategy // BranchAndBound when empty
+	FeeRate  int64             // satoshis per virtual byte
+}
+
+// Virtual sizes of a SegWit transaction that spends P2WPKH outputs, the
+// kind of the wallet's receive addresses
+const (
+	txOverheadVBytes = 11 // version, locktime, input and output counts and the SegWit marker, rounded up
+	inputVBytes      = 68 // outpoint, empty script, sequence and a P2WPKH witness
+	outputVBytes     = 9  // value and script length; the script comes on top
+	changeScriptSize = 22 // change goes to a P2WPKH output
+)
+
+// DustLimit is the smallest output a withdrawal creates, in satoshis:
+// the smallest P2WPKH output Bitcoin Core relays
+const DustLimit = 294
+
+const (
+	minChange          = 1_000_000 // change Knapsack aims to leave, 0.01 BTC as in Bitcoin Core
+	maxTries           = 100_000   // steps of the BranchAndBound search
+	knapsackIterations = 1000      // random subsets Knapsack tries per target
+)
+
+// EnableCoinSelection makes BTC withdrawals choose their inputs with the
+// strategy of cfg and pay a fee at its rate. Without it they spend the
+// oldest outputs and pay no fee
+func (w *Wallet) EnableCoinSelection(cfg CoinSelection) error {
+	if cfg.Strategy == "" {
+		cfg.Strategy = BranchAndBound
+	}
+	if _, err := ParseSelectionStrategy(string(cfg.Strategy)); err != nil {
+		return err
+	}
+	if cfg.FeeRate < 0 {
+		return fmt.Errorf("%w: fee rate must not be negative", ErrInvalidCoinSelection)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.coinSelection = &cfg
+	return nil
+}
+
+// candidate is an unspent output with its effective value: what it adds
+// to a withdrawal once the fee for spending it is paid
+type candidate struct {
+	utxo      models.UTXO
+	effective int64
+}
+
+// byEffectiveValue orders candidates from the largest effective value
+func byEffectiveValue(a, b candidate) int {
+	return cmp.Compare(b.effective, a.effective)
+}
+
+// selectCoins chooses the inputs of a BTC withdrawal with the configured
+// strategy and works out its fee and change. Change that would be dust
+// once it pays for its own output is left to the fee instead
+// The caller holds w.mu
+func (w *Wallet) selectCoins(utxos *models.UTXOSet, tx models.Transaction) (*models.Coins, error) {
+	rate := w.coinSelection.FeeRate
+	payment := changeScriptSize // a withdrawal without a destination is assumed to pay P2WPKH
+	if tx.Address != "" {
+		var err error
+		if payment, err = seed.ScriptSize(tx.Address); err != nil {
+			return nil, err
+		}
+	}
+	inputFee := inputVBytes * rate
+	changeFee := (outputVBytes + changeScriptSize) * rate
+	target := tx.Amount + int64(txOverheadVBytes+outputVBytes+payment)*rate
+
+	var candidates []candidate
+	var available int64
+	for _, utxo := range utxos.Unspent() {
+		// An output worth less than the fee to spend it would only cost money
+		if effective := utxo.Value - inputFee; effective > 0 {
+			candidates = append(candidates, candidate{utxo: utxo, effective: effective})
+			available += effective
+		}
+	}
+	if available < target {
+		return nil, &InsufficientFundsError{Asset: models.BTC, Requested: target, Available: available}
+	}
+
+	strategy := w.coinSelection.Strategy
+	// Seeded by the withdrawal, so the same wallet state always selects alike
+	rng := rand.New(rand.NewPCG(uint64(tx.Amount), uint64(len(candidates))))
+	var selected []candidate
+	switch strategy {
+	case LargestFirst:
+		selected = largestFirst(candidates, target)
+	case BranchAndBound:
+		// Leaving out the change saves creating it now and spending it later
+		if selected = branchAndBound(candidates, target, changeFee+inputFee); selected == nil {
+			strategy = Knapsack
+			selected = knapsack(candidates, target, rng)
+		}
+	case Knapsack:
+		selected = knapsack(candidates, target, rng)
+	}
+
+	if selected == nil {
+		return nil, &InsufficientFundsError{Asset: models.BTC, Requested: target, Available: available}
+	}
+
+	coins := &models.Coins{TxID: models.EntryTxID(tx.ID), Strategy: string(strategy)}
+	var total, effective int64
+	for _, c := range selected {
+		coins.Inputs = append(coins.Inputs, c.utxo.Outpoint)
+		total += c.utxo.Value
+		effective += c.effective
+	}
+	if change := effective - target - changeFee; change >= DustLimit {
+		coins.Change = change
+	}
+	coins.Fee = total - tx.Amount - coins.Change
+	return coins, nil
+}
+
+// largestFirst takes the outputs from the largest until they reach target
+func largestFirst(candidates []candidate, target int64) []candidate {
+	sorted := slices.Clone(candidates)
+	slices.SortStableFunc(sorted, byEffectiveValue)
+
+	var value int64
+	for i, c := range sorted {
+		if value += c.effective; value >= target {
+			return sorted[:i+1]
+		}
+	}
+	return nil
+}
+
+// branchAndBound searches depth first, largest outputs first, for the
+// outputs worth between target and target+costOfChange with the least
+// excess; nil when there are none. It gives up after maxTries steps
+func branchAndBound(candidates []candidate, target, costOfChange int64) []candidate {
+	sorted := slices.Clone(candidates)
+	slices.SortStableFunc(sorted, byEffectiveValue)
+	remaining := make([]int64, len(sorted)+1) // effective value of sorted[i:]
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].effective
+	}
+
+	included := make([]bool, len(sorted))
+	var best []bool
+	bestExcess := int64(math.MaxInt64)
+	tries := 0
+
+	var search func(i int, value int64)
+	search = func(i int, value int64) {
+		tries++
+		switch {
+		case tries > maxTries || bestExcess == 0:
+			return
+		case value > target+costOfChange:
+			return
+		case value >= target:
+			if excess := value - target; excess < bestExcess {
+				bestExcess, best = excess, slices.Clone(included)
+			}
+			return
+		case i == len(sorted) || value+remaining[i] < target:
+			return
+		}
+
+		// After leaving out an output, one of the same value leads nowhere new
+		if i == 0 || included[i-1] || sorted[i].effective != sorted[i-1].effective {
+			included[i] = true
+			search(i+1, value+sorted[i].effective)
+			included[i] = false
+		}
+		search(i+1, value)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return nil
+	}
+	var selected []candidate
+	for i, in := range best {
+		if in {
+			selected = append(selected, sorted[i])
+		}
+	}
+	return selected
+}
+
+// knapsack picks an output worth exactly target, all the outputs smaller
+// than target+minChange when they add up to it, or else the better of the
+// smallest single output over that and the smallest random subset of the
+// smaller ones that reaches target, preferring one that leaves minChange
+func knapsack(candidates []candidate, target int64, rng *rand.Rand) []candidate {
+	var smaller []candidate
+	var lowestLarger *candidate
+	var totalLower int64
+	for i, c := range candidates {
+		switch {
+		case c.effective == target:
+			return []candidate{c}
+		case c.effective < target+minChange:
+			smaller = append(smaller, c)
+			totalLower += c.effective
+		case lowestLarger == nil || c.effective < lowestLarger.effective:
+			lowestLarger = &candidates[i]
+		}
+	}
+
+	switch {
+	case totalLower == target:
+		return smaller
+	case totalLower < target && lowestLarger == nil:
+		return nil
+	case totalLower < target:
+		return []candidate{*lowestLarger}
+	}
+
+	slices.SortStableFunc(smaller, byEffectiveValue)
+	best, bestValue := approximateBestSubset(smaller, totalLower, target, rng)
+	if bestValue != target && totalLower >= target+minChange {
+		best, bestValue = approximateBestSubset(smaller, totalLower, target+minChange, rng)
+	}
+	if lowestLarger != nil && (bestValue != target && bestValue < target+minChange || lowestLarger.effective <= bestValue) {
+		return []candidate{*lowestLarger}
+	}
+
+	var selected []candidate
+	for i, in := range best {
+		if in {
+			selected = append(selected, smaller[i])
+		}
+	}
+	return selected
+}
+
+// approximateBestSubset returns the subset of candidates, worth total
+// together, with the smallest value of at least target it finds in
+// knapsackIterations random tries, and that value
+func approximateBestSubset(candidates []candidate, total, target int64, rng *rand.Rand) ([]bool, int64) {
+	best := make([]bool, len(candidates))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	included := make([]bool, len(candidates))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		clear(included)
+		var value int64
+		reached := false
+		// The first pass includes outputs at random, the second the rest
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i, c := range candidates {
+				if pass == 0 && rng.IntN(2) == 0 || pass == 1 && included[i] {
+					continue
+				}
+				value += c.effective
+				included[i] = true
+				if value >= target {
+					reached = true
+					if value < bestValue {
+						bestValue = value
+						copy(best, included)
+					}
+					value -= c.effective
+					included[i] = false
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
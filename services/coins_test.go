@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// coinWallet holds outputs of 50000, 20000, 100000 and 30000 satoshis
+// and selects coins at 1 sat/vB, where an input costs 68 and change 31
+func coinWallet(t *testing.T, strategy SelectionStrategy) *Wallet {
+	t.Helper()
+	wallet := NewWallet()
+	for _, amount := range []int64{50000, 20000, 100000, 30000} {
+		if err := wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: amount}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wallet.EnableCoinSelection(CoinSelection{Strategy: strategy, FeeRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+func TestSelectCoins_Strategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy SelectionStrategy
+		amount   int64
+		address  string
+		inputs   []int64 // values of the spent outputs, in any order
+		fee      int64
+		change   int64
+		used     SelectionStrategy // strategy that made the selection
+	}{
+		{"LargestFirst", LargestFirst, 69822, "", []int64{100000}, 141, 30037, LargestFirst},
+		{"BranchAndBoundChangeless", BranchAndBound, 69822, "", []int64{50000, 20000}, 178, 0, BranchAndBound},
+		{"BranchAndBoundFallsBack", BranchAndBound, 120000, "", []int64{100000, 30000}, 209, 9791, Knapsack},
+		{"KnapsackExact", Knapsack, 69822, "", []int64{50000, 20000}, 178, 0, Knapsack},
+		{"DustChangeToFee", LargestFirst, 99600, "", []int64{100000}, 400, 0, LargestFirst},
+		// A taproot output script is 34 bytes against 22 for P2WPKH
+		{"TaprootDestination", LargestFirst, 50000, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", []int64{100000}, 153, 49847, LargestFirst},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet := coinWallet(t, tt.strategy)
+			entry, err := wallet.Apply(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: tt.amount, Address: tt.address})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var inputs []int64
+			for _, out := range entry.Coins.Inputs {
+				for _, tx := range wallet.GetTransactionHistory() {
+					if tx.Coins != nil && tx.Coins.TxID == out.TxID {
+						inputs = append(inputs, tx.Amount)
+					}
+				}
+			}
+			slices.Sort(inputs)
+			slices.Sort(tt.inputs)
+			if !slices.Equal(inputs, tt.inputs) {
+				t.Errorf("Expected inputs %v, got %v", tt.inputs, inputs)
+			}
+			if entry.Coins.Fee != tt.fee || entry.Coins.Change != tt.change || entry.Coins.Strategy != string(tt.used) {
+				t.Errorf("Expected fee %d, change %d by %s, got %+v", tt.fee, tt.change, tt.used, entry.Coins)
+			}
+			if balance := wallet.GetBalance(models.BTC); balance != 200000-tt.amount-tt.fee {
+				t.Errorf("Expected the fee to leave the balance, got %d", balance)
+			}
+			if err := wallet.CheckUTXOs(); err != nil {
+				t.Errorf("Expected the UTXO set to match the balance, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSelectCoins_Limits(t *testing.T) {
+	wallet := coinWallet(t, BranchAndBound)
+
+	// The balance covers it, but not once the inputs pay their fees
+	var insufficient *InsufficientFundsError
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 199700}); !errors.As(err, &insufficient) {
+		t.Errorf("Expected InsufficientFundsError for the fee, got %v", err)
+	}
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: DustLimit - 1}); !errors.Is(err, ErrDustOutput) {
+		t.Errorf("Expected ErrDustOutput, got %v", err)
+	}
+	if err := wallet.EnableCoinSelection(CoinSelection{Strategy: "random"}); !errors.Is(err, ErrInvalidCoinSelection) {
+		t.Errorf("Expected ErrInvalidCoinSelection, got %v", err)
+	}
+
+	// Undoing a withdrawal gives back the fee too
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 69822}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := wallet.GetBalance(models.BTC); balance != 200000 {
+		t.Errorf("Expected the balance before the withdrawal, got %d", balance)
+	}
+	if problems := Verify(wallet.GetTransactionHistory()); len(problems) != 0 {
+		t.Errorf("Expected the ledger to verify, got %v", problems)
+	}
+}
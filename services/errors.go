@@ -0,0 +1,141 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/seed"
+)
+
+// Sentinel errors returned (wrapped) by Wallet operations
+// Parse errors live in the models package next to the parsers
+var (
+	ErrInsufficientFunds    = &models.Error{Code: "INSUFFICIENT_FUNDS", Message: "insufficient funds"}
+	ErrUnknownType          = &models.Error{Code: "UNKNOWN_TYPE", Message: "unknown transaction type"}
+	ErrDuplicateID          = &models.Error{Code: "DUPLICATE_ID", Message: "duplicate transaction id"}
+	ErrBatchRejected        = &models.Error{Code: "BATCH_REJECTED", Message: "batch rejected"}
+	ErrNothingToUndo        = &models.Error{Code: "NOTHING_TO_UNDO", Message: "nothing to undo"}
+	ErrInvalidEntry         = &models.Error{Code: "INVALID_ENTRY", Message: "invalid ledger entry"}
+	ErrSubscriberLagged     = &models.Error{Code: "SUBSCRIBER_LAGGED", Message: "subscriber fell too far behind"}
+	ErrHookPanicked         = &models.Error{Code: "HOOK_PANICKED", Message: "event hook panicked"}
+	ErrRuleRejected         = &models.Error{Code: "RULE_REJECTED", Message: "rejected by rule"}
+	ErrPolicyDenied         = &models.Error{Code: "POLICY_DENIED", Message: "denied by policy"}
+	ErrApprovalRequired     = &models.Error{Code: "APPROVAL_REQUIRED", Message: "approval required"}
+	ErrInvalidPolicy        = &models.Error{Code: "INVALID_POLICY", Message: "invalid policy rule"}
+	ErrApprovalPending      = &models.Error{Code: "APPROVAL_PENDING", Message: "pending approval"}
+	ErrApprovalRejected     = &models.Error{Code: "APPROVAL_REJECTED", Message: "rejected by approvers"}
+	ErrApprovalExpired      = &models.Error{Code: "APPROVAL_EXPIRED", Message: "approval request expired"}
+	ErrInvalidApproval      = &models.Error{Code: "INVALID_APPROVAL", Message: "invalid approval configuration"}
+	ErrUnknownRequest       = &models.Error{Code: "UNKNOWN_REQUEST", Message: "unknown approval request"}
+	ErrRequestClosed        = &models.Error{Code: "REQUEST_CLOSED", Message: "approval request already decided"}
+	ErrNotApprover          = &models.Error{Code: "NOT_APPROVER", Message: "not an approver"}
+	ErrAlreadyDecided       = &models.Error{Code: "ALREADY_DECIDED", Message: "approver already decided"}
+	ErrSelfApproval         = &models.Error{Code: "SELF_APPROVAL", Message: "submitter may not approve their own request"}
+	ErrForbidden            = &models.Error{Code: "FORBIDDEN", Message: "permission denied"}
+	ErrUnknownUser          = &models.Error{Code: "UNKNOWN_USER", Message: "unknown user"}
+	ErrInvalidAccess        = &models.Error{Code: "INVALID_ACCESS", Message: "invalid access control"}
+	ErrNoAddresses          = &models.Error{Code: "NO_ADDRESSES", Message: "the wallet cannot generate addresses"}
+	ErrUnknownAddress       = &models.Error{Code: "UNKNOWN_ADDRESS", Message: "unknown address"}
+	ErrInvalidAddress       = seed.ErrInvalidAddress
+	ErrNotAllowlisted       = &models.Error{Code: "NOT_ALLOWLISTED", Message: "destination not allowlisted"}
+	ErrCoolingOff           = &models.Error{Code: "COOLING_OFF", Message: "allowlisted address still cooling off"}
+	ErrInvalidAllowlist     = &models.Error{Code: "INVALID_ALLOWLIST", Message: "invalid allowlist"}
+	ErrInvalidCoinSelection = &models.Error{Code: "INVALID_COIN_SELECTION", Message: "invalid coin selection"}
+	ErrDustOutput           = &models.Error{Code: "DUST_OUTPUT", Message: "output below the dust limit"}
+)
+
+// InsufficientFundsError is returned when a withdrawal exceeds the balance
+// Amounts are in the asset's smallest unit
+type InsufficientFundsError struct {
+	Asset     models.Asset
+	Requested int64
+	Available int64
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds for withdrawal: requested %s, available %s %s",
+		formatAmount(e.Requested, e.Asset),
+		formatAmount(e.Available, e.Asset),
+		e.Asset)
+}
+
+// Unwrap makes errors.Is(err, ErrInsufficientFunds) match
+func (e *InsufficientFundsError) Unwrap() error {
+	return ErrInsufficientFunds
+}
+
+// BatchFailure is one transaction of a batch that failed validation
+type BatchFailure struct {
+	Index       int // position in the batch, starting at 0
+	Transaction models.Transaction
+	Err         error
+}
+
+// BatchError is returned when an atomic batch is rejected
+// It lists every failing transaction, not just the first one
+type BatchError struct {
+	Total    int
+	Failures []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch rejected: %d of %d transactions failed, first at index %d: %s",
+		len(e.Failures), e.Total, e.Failures[0].Index, e.Failures[0].Err)
+}
+
+// Unwrap exposes ErrBatchRejected and every failure cause to errors.Is/As
+func (e *BatchError) Unwrap() []error {
+	errs := []error{ErrBatchRejected}
+	for _, failure := range e.Failures {
+		errs = append(errs, failure.Err)
+	}
+	return errs
+}
+
+// HookPanicError reports an event hook that panicked
+// The panic was recovered; the event was already committed or rejected
+type HookPanicError struct {
+	Event Event
+	Value any // the value passed to panic
+}
+
+func (e *HookPanicError) Error() string {
+	return fmt.Sprintf("event hook panicked on %T: %v", e.Event, e.Value)
+}
+
+// Unwrap makes errors.Is(err, ErrHookPanicked) match
+func (e *HookPanicError) Unwrap() error {
+	return ErrHookPanicked
+}
+
+// RuleError is returned when a registered validator or interceptor
+// rejects a transaction
+type RuleError struct {
+	Rule string // the validator's or interceptor's name
+	Err  error  // what the rule returned
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rejected by rule %s: %s", e.Rule, e.Err)
+}
+
+// Unwrap exposes ErrRuleRejected and the rule's own error to errors.Is/As
+func (e *RuleError) Unwrap() []error {
+	return []error{ErrRuleRejected, e.Err}
+}
+
+// PendingApprovalError is returned for a transaction held for approval
+// instead of being committed
+type PendingApprovalError struct {
+	Request ApprovalRequest
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("pending approval as request %s (%s): needs %d approval(s)",
+		e.Request.ID, e.Request.Reason, e.Request.Required)
+}
+
+// Unwrap makes errors.Is(err, ErrApprovalPending) match
+func (e *PendingApprovalError) Unwrap() error {
+	return ErrApprovalPending
+}
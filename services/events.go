@@ -0,0 +1,256 @@
+package services
+
+import (
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Event is something that happened in a wallet: TransactionAccepted,
+// TransactionRejected, BalanceBelowThreshold or ApprovalRequested
+type Event interface {
+	isEvent()
+}
+
+// TransactionAccepted reports an entry committed to the ledger
+type TransactionAccepted struct {
+	Seq         int                    // ledger position of the entry, starting at 1
+	Transaction models.Transaction     // the entry, with its assigned ID and timestamp
+	Balances    map[models.Asset]int64 // balances right after the entry
+}
+
+// TransactionRejected reports a transaction the wallet refused
+// Rejections are not recorded in the ledger; Seq is the number of entries
+// at the time, so events stay ordered by Seq
+type TransactionRejected struct {
+	Seq         int
+	Transaction models.Transaction // the attempt as submitted
+	Err         error              // why it was rejected
+	Balances    map[models.Asset]int64
+}
+
+// BalanceBelowThreshold reports an entry that took the balance of an asset
+// from at or above its threshold (see SetThreshold) to below it
+type BalanceBelowThreshold struct {
+	Seq         int // ledger position of the entry that crossed the threshold
+	Asset       models.Asset
+	Balance     int64 // the new balance
+	Threshold   int64
+	Transaction models.Transaction
+}
+
+// ApprovalRequested reports a transaction held for approval (see
+// EnableApprovals). Its outcome is reported later: TransactionAccepted
+// once approved, TransactionRejected once rejected or expired
+type ApprovalRequested struct {
+	Request ApprovalRequest
+}
+
+func (TransactionAccepted) isEvent()   {}
+func (TransactionRejected) isEvent()   {}
+func (BalanceBelowThreshold) isEvent() {}
+func (ApprovalRequested) isEvent()     {}
+
+// SetThreshold makes the wallet publish BalanceBelowThreshold whenever
+// the balance of asset drops below amount (in smallest units)
+// A zero amount removes the threshold
+func (w *Wallet) SetThreshold(asset models.Asset, amount int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if amount == 0 {
+		delete(w.thresholds, asset)
+		return
+	}
+	if w.thresholds == nil {
+		w.thresholds = make(map[models.Asset]int64)
+	}
+	w.thresholds[asset] = amount
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// its subscription is ended
+const subscriberBuffer = 256
+
+// Subscription delivers wallet events in order on C
+// A subscriber that falls more than subscriberBuffer events behind is
+// dropped instead of slowing the wallet down: C is closed and Err returns
+// ErrSubscriberLagged. It can resubscribe from the last Seq it received
+type Subscription struct {
+	C <-chan Event
+
+	wallet *Wallet
+	ch     chan Event
+	err    error // guarded by wallet.mu
+	closed bool  // guarded by wallet.mu
+}
+
+// Subscribe delivers every event after the current state of the wallet
+// A user's handle only receives the events about accounts it may view
+// When since is not negative, it also returns a TransactionAccepted for
+// every entry after ledger position since, so a client that saw events up
+// to since can resume without a gap. Other events are not part of the
+// ledger and are never replayed
+func (w *Wallet) Subscribe(since int) ([]Event, *Subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var replay []Event
+	if since >= 0 {
+		transactions := w.ledger.GetTransactions()
+		balances := w.ledger.CalculateBalancesAt(since)
+		for i := since; i < len(transactions); i++ {
+			tx := transactions[i]
+			applyToBalances(balances, tx)
+			event := TransactionAccepted{Seq: i + 1, Transaction: tx, Balances: copyBalances(balances)}
+			if visible, ok := w.visibleEvent(event); ok {
+				replay = append(replay, visible)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, wallet: w, ch: ch}
+	if w.subscribers == nil {
+		w.subscribers = make(map[*Subscription]struct{})
+	}
+	w.subscribers[sub] = struct{}{}
+	return replay, sub
+}
+
+// Close ends the subscription and closes C
+func (s *Subscription) Close() {
+	s.wallet.mu.Lock()
+	defer s.wallet.mu.Unlock()
+
+	s.end(nil)
+}
+
+// Err returns why the subscription ended: ErrSubscriberLagged when it fell
+// behind, nil otherwise
+func (s *Subscription) Err() error {
+	s.wallet.mu.Lock()
+	defer s.wallet.mu.Unlock()
+
+	return s.err
+}
+
+// end unregisters the subscription; the caller holds wallet.mu
+func (s *Subscription) end(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	delete(s.wallet.subscribers, s)
+	close(s.ch)
+}
+
+// publish delivers events to every subscription without blocking and
+// queues them for the hooks, which run once w.mu is released (see unlock)
+// The caller holds w.mu
+func (w *Wallet) publish(events ...Event) {
+	if len(w.hooks) > 0 {
+		w.pending = append(w.pending, events...)
+	}
+
+	for sub := range w.subscribers {
+		for _, event := range events {
+			event, ok := sub.wallet.visibleEvent(event)
+			if !ok {
+				continue
+			}
+			select {
+			case sub.ch <- event:
+			default:
+				sub.end(ErrSubscriberLagged)
+			}
+			if sub.closed {
+				break
+			}
+		}
+	}
+}
+
+// publishAccepted publishes the entries just committed, and any threshold
+// they crossed. The caller holds w.mu
+func (w *Wallet) publishAccepted(committed []models.Transaction) {
+	if len(w.subscribers) == 0 && len(w.hooks) == 0 {
+		return
+	}
+
+	end := len(w.ledger.GetTransactions())
+	start := end - len(committed)
+	balances := w.ledger.CalculateBalancesAt(start)
+
+	var events []Event
+	for i, tx := range committed {
+		before := balances[tx.Asset]
+		applyToBalances(balances, tx)
+		events = append(events, TransactionAccepted{Seq: start + i + 1, Transaction: tx, Balances: copyBalances(balances)})
+
+		threshold, ok := w.thresholds[tx.Asset]
+		if after := balances[tx.Asset]; ok && before >= threshold && after < threshold {
+			events = append(events, BalanceBelowThreshold{
+				Seq:         start + i + 1,
+				Asset:       tx.Asset,
+				Balance:     after,
+				Threshold:   threshold,
+				Transaction: tx,
+			})
+		}
+	}
+	w.publish(events...)
+}
+
+// publishRejected publishes a rejected attempt; the caller holds w.mu
+func (w *Wallet) publishRejected(tx models.Transaction, err error) {
+	if len(w.subscribers) == 0 && len(w.hooks) == 0 {
+		return
+	}
+
+	w.publish(TransactionRejected{
+		Seq:         len(w.ledger.GetTransactions()),
+		Transaction: tx,
+		Err:         err,
+		Balances:    w.ledger.CalculateAllBalances(),
+	})
+}
+
+// applyToBalances adds the effect of one entry to balances
+func applyToBalances(balances map[models.Asset]int64, tx models.Transaction) {
+	switch tx.Type {
+	case models.Deposit:
+		balances[tx.Asset] += tx.Amount
+	case models.Withdraw:
+		balances[tx.Asset] -= tx.Amount + tx.Fee()
+	}
+}
+
+func copyBalances(balances map[models.Asset]int64) map[models.Asset]int64 {
+	copied := make(map[models.Asset]int64, len(balances))
+	for asset, amount := range balances {
+		copied[asset] = amount
+	}
+	return copied
+}
+
+// visibleEvent returns event as the handle may see it: events about an
+// account it may not view are left out, and so are the balances of those
+// accounts. The caller holds w.mu
+func (w *Wallet) visibleEvent(event Event) (Event, bool) {
+	if w.unrestricted() {
+		return event, true
+	}
+	switch e := event.(type) {
+	case TransactionAccepted:
+		e.Balances = w.visibleBalances(copyBalances(e.Balances))
+		return e, w.canView(e.Transaction.Asset)
+	case TransactionRejected:
+		e.Balances = w.visibleBalances(copyBalances(e.Balances))
+		return e, w.canView(e.Transaction.Asset)
+	case BalanceBelowThreshold:
+		return e, w.canView(e.Asset)
+	case ApprovalRequested:
+		return e, w.canView(e.Request.Transaction.Asset)
+	}
+	return event, true
+}
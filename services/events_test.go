@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func TestSubscribe_ReplayAndLive(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 50})
+
+	replay, sub := wallet.Subscribe(1)
+	defer sub.Close()
+	if len(replay) != 1 {
+		t.Fatalf("Expected entry 2 to be replayed, got %+v", replay)
+	}
+	if entry, ok := replay[0].(TransactionAccepted); !ok || entry.Seq != 2 || entry.Balances[models.BTC] != 150 {
+		t.Fatalf("Expected entry 2 to be replayed with balance 150, got %+v", replay)
+	}
+
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 500})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 30})
+
+	event := <-sub.C
+	if rejected, ok := event.(TransactionRejected); !ok || !errors.Is(rejected.Err, ErrInsufficientFunds) || rejected.Seq != 2 {
+		t.Errorf("Expected a rejection after entry 2, got %+v", event)
+	}
+	event = <-sub.C
+	if accepted, ok := event.(TransactionAccepted); !ok || accepted.Seq != 3 || accepted.Transaction.ID != "3" || accepted.Balances[models.BTC] != 120 {
+		t.Errorf("Expected entry 3 with balance 120, got %+v", event)
+	}
+}
+
+func TestSubscribe_NoReplayWhenSinceNegative(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1})
+
+	replay, sub := wallet.Subscribe(-1)
+	defer sub.Close()
+	if len(replay) != 0 {
+		t.Errorf("Expected no replay, got %d events", len(replay))
+	}
+}
+
+func TestSubscribe_DropsLaggingSubscriber(t *testing.T) {
+	wallet := NewWallet()
+	_, sub := wallet.Subscribe(-1)
+
+	for range subscriberBuffer + 1 {
+		wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	if received != subscriberBuffer || !errors.Is(sub.Err(), ErrSubscriberLagged) {
+		t.Errorf("Expected %d events then ErrSubscriberLagged, got %d and %v", subscriberBuffer, received, sub.Err())
+	}
+	if balance := wallet.GetBalance(models.USD); balance != subscriberBuffer+1 {
+		t.Errorf("Expected every deposit to be committed regardless, got balance %d", balance)
+	}
+}
+
+func TestOnEvent_ThresholdAndOrder(t *testing.T) {
+	wallet := NewWallet()
+	wallet.SetThreshold(models.USD, 1000)
+
+	var events []Event
+	remove := wallet.OnEvent(func(event Event) { events = append(events, event) })
+
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1500})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 800})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 100})
+	remove()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 5000})
+
+	if len(events) != 4 {
+		t.Fatalf("Expected 3 entries and one threshold crossing, got %+v", events)
+	}
+	below, ok := events[2].(BalanceBelowThreshold)
+	if !ok || below.Seq != 2 || below.Balance != 700 || below.Threshold != 1000 {
+		t.Errorf("Expected entry 2 to cross the threshold, got %+v", events[2])
+	}
+	if accepted, ok := events[3].(TransactionAccepted); !ok || accepted.Seq != 3 {
+		t.Errorf("Expected no second crossing while already below, got %+v", events[3])
+	}
+}
+
+func TestOnEvent_PanicIsIsolated(t *testing.T) {
+	wallet := NewWallet()
+	var reported error
+	wallet.OnHookPanic(func(err *HookPanicError) { reported = err })
+	wallet.OnEvent(func(Event) { panic("boom") })
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 10})
+	if err != nil {
+		t.Fatalf("Expected the hook panic not to fail the transaction, got %v", err)
+	}
+	if !errors.Is(reported, ErrHookPanicked) {
+		t.Errorf("Expected the panic to be reported, got %v", reported)
+	}
+	if balance := wallet.GetBalance(models.BTC); balance != 10 {
+		t.Errorf("Expected the deposit to be committed, got balance %d", balance)
+	}
+}
+
+func TestOnEventAsync_DropsWhenBehind(t *testing.T) {
+	wallet := NewWallet()
+	release := make(chan struct{})
+	received := 0
+	hook := wallet.OnEventAsync(func(Event) {
+		<-release
+		received++
+	})
+
+	// One event is taken by the blocked hook, hookBuffer more fill its queue
+	total := hookBuffer + 10
+	for range total {
+		wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1})
+	}
+	close(release)
+	hook.Close()
+
+	if int64(received)+hook.Dropped() != int64(total) || hook.Dropped() == 0 {
+		t.Errorf("Expected %d events handled or dropped with some dropped, got %d and %d", total, received, hook.Dropped())
+	}
+	if balance := wallet.GetBalance(models.ETH); balance != int64(total) {
+		t.Errorf("Expected every deposit to be committed regardless, got balance %d", balance)
+	}
+}
+
+// failingJournal refuses every append
+type failingJournal struct{}
+
+func (failingJournal) Load() ([]models.Transaction, error) { return nil, nil }
+
+func (failingJournal) Append(...models.Transaction) error { return errors.New("disk full") }
+
+func TestOnEvent_BatchCommitFailure(t *testing.T) {
+	wallet, err := OpenWallet(failingJournal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	wallet.OnEvent(func(event Event) { events = append(events, event) })
+
+	err = wallet.ProcessBatch([]models.Transaction{
+		{Type: models.Deposit, Asset: models.USD, Amount: 100},
+		{Type: models.Deposit, Asset: models.BTC, Amount: 200},
+	})
+	if err == nil {
+		t.Fatal("Expected the journal failure to fail the batch")
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected one rejection per transaction, got %+v", events)
+	}
+	for i, asset := range []models.Asset{models.USD, models.BTC} {
+		rejected, ok := events[i].(TransactionRejected)
+		if !ok || rejected.Transaction.Asset != asset || rejected.Err != err {
+			t.Errorf("Expected the %s deposit to be rejected with %v, got %+v", asset, err, events[i])
+		}
+	}
+}
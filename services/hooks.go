@@ -0,0 +1,181 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// hookBuffer is how many events an async hook may fall behind before new
+// events are dropped for it
+const hookBuffer = 256
+
+// hook is a registered observer; queue is nil for sync hooks
+type hook struct {
+	fn      func(Event)
+	queue   chan Event
+	dropped atomic.Int64
+	done    chan struct{} // closed when an async hook has drained its queue
+}
+
+// AsyncHook is an observer running on its own goroutine, see OnEventAsync
+type AsyncHook struct {
+	wallet *Wallet
+	hook   *hook
+	once   sync.Once
+}
+
+// OnEvent registers fn to be called with every event the wallet publishes
+// from now on, and returns a function that removes it
+//
+// fn runs on the goroutine that caused the event, after the wallet lock is
+// released and in publish order, so a slow hook slows that caller down but
+// never the ledger. Hooks observe the whole wallet, whichever handle
+// registered them. fn may read the wallet but must not record transactions
+// (that would wait on its own delivery); use OnEventAsync for that. A
+// panic in fn is recovered and reported to the OnHookPanic handler
+func (w *Wallet) OnEvent(fn func(Event)) (remove func()) {
+	h := &hook{fn: fn}
+	w.addHook(h)
+	return func() { w.removeHook(h) }
+}
+
+// OnEventAsync registers fn to be called with every event the wallet
+// publishes from now on, one at a time on a goroutine of its own
+// When fn falls more than hookBuffer events behind, new events are
+// dropped for it instead of blocking the wallet; Dropped counts them.
+// A panic in fn is recovered and reported to the OnHookPanic handler
+func (w *Wallet) OnEventAsync(fn func(Event)) *AsyncHook {
+	h := &hook{fn: fn, queue: make(chan Event, hookBuffer), done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		for event := range h.queue {
+			w.runHook(h, event)
+		}
+	}()
+	w.addHook(h)
+	return &AsyncHook{wallet: w, hook: h}
+}
+
+// Dropped returns how many events were not delivered because the hook fell
+// behind
+func (a *AsyncHook) Dropped() int64 {
+	return a.hook.dropped.Load()
+}
+
+// Close removes the hook and waits until it has handled every event
+// already queued for it
+func (a *AsyncHook) Close() {
+	a.once.Do(func() {
+		// Deliveries that took their ticket before the removal may still
+		// send to the queue; wait for them before closing it
+		ticket := a.wallet.removeHook(a.hook)
+		a.wallet.dispatchMu.Lock()
+		for a.wallet.dispatched < ticket {
+			a.wallet.dispatchCond.Wait()
+		}
+		a.wallet.dispatchMu.Unlock()
+		close(a.hook.queue)
+	})
+	<-a.hook.done
+}
+
+// OnHookPanic sets the function told about hooks that panicked; by default
+// the panic is recovered and ignored. Ledger state is never affected: the
+// events a hook sees are already committed
+func (w *Wallet) OnHookPanic(report func(*HookPanicError)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.panicReport = report
+}
+
+// addHook registers h; the hook list is copied on write so deliveries can
+// use a snapshot without holding w.mu
+func (w *Wallet) addHook(h *hook) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hooks := make([]*hook, len(w.hooks), len(w.hooks)+1)
+	copy(hooks, w.hooks)
+	w.hooks = append(hooks, h)
+}
+
+// removeHook unregisters h and returns the ticket of the first delivery
+// that no longer includes it
+func (w *Wallet) removeHook(h *hook) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hooks := make([]*hook, 0, len(w.hooks))
+	for _, other := range w.hooks {
+		if other != h {
+			hooks = append(hooks, other)
+		}
+	}
+	w.hooks = hooks
+
+	w.dispatchMu.Lock()
+	defer w.dispatchMu.Unlock()
+	return w.tickets
+}
+
+// unlock releases w.mu after an operation that may have published events
+// and delivers them to the hooks registered at the time. Each such
+// operation takes a ticket while it holds w.mu, and deliveries run in
+// ticket order, so hooks see events in the order they were published
+func (w *Wallet) unlock() {
+	events, hooks := w.pending, w.hooks
+	w.pending = nil
+	if len(events) == 0 || len(hooks) == 0 {
+		w.mu.Unlock()
+		return
+	}
+
+	w.dispatchMu.Lock()
+	ticket := w.tickets
+	w.tickets++
+	w.dispatchMu.Unlock()
+	w.mu.Unlock()
+
+	w.dispatchMu.Lock()
+	for w.dispatched != ticket {
+		w.dispatchCond.Wait()
+	}
+	w.dispatchMu.Unlock()
+
+	defer func() {
+		w.dispatchMu.Lock()
+		w.dispatched++
+		w.dispatchCond.Broadcast()
+		w.dispatchMu.Unlock()
+	}()
+
+	for _, event := range events {
+		for _, h := range hooks {
+			if h.queue == nil {
+				w.runHook(h, event)
+				continue
+			}
+			select {
+			case h.queue <- event:
+			default:
+				h.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// runHook calls a hook, recovering and reporting a panic
+func (w *Wallet) runHook(h *hook, event Event) {
+	defer func() {
+		if value := recover(); value != nil {
+			w.mu.RLock()
+			report := w.panicReport
+			w.mu.RUnlock()
+			if report != nil {
+				report(&HookPanicError{Event: event, Value: value})
+			}
+		}
+	}()
+	h.fn(event)
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// PolicyAction is what a matching policy rule does to a transaction
+type PolicyAction string
+
+const (
+	PolicyDeny            PolicyAction = "deny"             // reject the transaction
+	PolicyRequireApproval PolicyAction = "require-approval" // reject it until it is approved
+	PolicyFlag            PolicyAction = "flag"             // commit it, recording the hit
+)
+
+// PolicyRule is one rule of a Policy, parsed from text such as
+//
+//	WITHDRAW USD > 10000 requires approval
+//	no ETH withdrawals on weekends
+//	max 5 withdrawals per hour
+//
+// A rule names the transactions it applies to (a type, an asset, or both,
+// in either order; ANY or nothing matches everything), then conditions
+// that must all hold, then an action:
+//
+//	> AMOUNT, >= AMOUNT          amount in the asset's main unit
+//	balance < AMOUNT             balance of the asset after the transaction
+//	on weekends, on weekdays     day of the entry's timestamp
+//	more than N per UNIT         UNIT is minute, hour or day
+//	requires approval | is denied | is flagged
+//
+// "no X" is short for "X is denied" and "max N X per UNIT" for
+// "X more than N per UNIT is denied"
+type PolicyRule struct {
+	Text   string // the rule as written; it names the rule in errors and audit records
+	Action PolicyAction
+
+	txType  models.TransactionType // "" matches both types
+	asset   models.Asset           // "" matches every asset
+	above   int64                  // amount must be > above, or >= when incl
+	hasMin  bool
+	incl    bool
+	below   int64 // balance after the entry must be < below
+	hasBal  bool
+	weekend *bool         // nil: any day
+	limit   int           // at most limit earlier matching entries within window
+	window  time.Duration // 0: no rate condition
+}
+
+// Policy is an ordered list of rules evaluated on every committed entry
+// Deny and approval rules reject the entry with a *RuleError naming the
+// first one that matched; every matching flag rule is recorded in the
+// entry's PolicyHits
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// clone returns a copy of p, nil for none
+func (p *Policy) clone() *Policy {
+	if p == nil {
+		return nil
+	}
+	return &Policy{Rules: slices.Clone(p.Rules)}
+}
+
+// ParsePolicy parses one rule per element of lines
+func ParsePolicy(lines []string) (*Policy, error) {
+	policy := &Policy{}
+	for i, line := range lines {
+		rule, err := ParsePolicyRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// ParsePolicyRule parses a single rule; see PolicyRule for the syntax
+func ParsePolicyRule(text string) (PolicyRule, error) {
+	rule := PolicyRule{Text: strings.Join(strings.Fields(text), " ")}
+	words := strings.Fields(strings.ToLower(text))
+	fail := func(format string, args ...any) (PolicyRule, error) {
+		return PolicyRule{}, fmt.Errorf("%w: %q: %s", ErrInvalidPolicy, rule.Text, fmt.Sprintf(format, args...))
+	}
+	if len(words) == 0 {
+		return fail("empty rule")
+	}
+
+	// Shorthand prefixes imply the action, and for max a rate condition
+	isMax := false
+	switch words[0] {
+	case "no":
+		rule.Action = PolicyDeny
+		words = words[1:]
+	case "max":
+		if len(words) < 2 {
+			return fail("expected a count after max")
+		}
+		n, err := strconv.Atoi(words[1])
+		if err != nil || n < 0 {
+			return fail("invalid count %q", words[1])
+		}
+		rule.Action = PolicyDeny
+		rule.limit = n
+		isMax = true
+		words = words[2:]
+	}
+
+	// Subject: a type and/or an asset in either order
+	for len(words) > 0 {
+		if txType, ok := parsePolicyType(words[0]); ok && rule.txType == "" {
+			rule.txType = txType
+		} else if asset := models.Asset(strings.ToUpper(words[0])); isPolicyAsset(asset) && rule.asset == "" {
+			rule.asset = asset
+		} else if words[0] != "any" {
+			break
+		}
+		words = words[1:]
+	}
+
+	amount := func(word string) (int64, error) {
+		if rule.asset == "" {
+			return 0, fmt.Errorf("an amount needs an asset to be compared in")
+		}
+		return rule.asset.ParseAmount(word)
+	}
+
+	if isMax {
+		// "max N X per UNIT"
+		if len(words) < 2 || words[0] != "per" {
+			return fail("expected per minute, hour or day")
+		}
+		window, ok := policyWindows[words[1]]
+		if !ok {
+			return fail("unknown period %q, expected minute, hour or day", words[1])
+		}
+		rule.window = window
+		words = words[2:]
+	}
+
+	for len(words) > 0 {
+		switch {
+		case words[0] == ">" || words[0] == ">=":
+			if len(words) < 2 {
+				return fail("expected an amount after %s", words[0])
+			}
+			value, err := amount(words[1])
+			if err != nil {
+				return fail("%s", err)
+			}
+			rule.above, rule.hasMin, rule.incl = value, true, words[0] == ">="
+			words = words[2:]
+		case words[0] == "balance":
+			if len(words) < 3 || words[1] != "<" {
+				return fail("expected balance < AMOUNT")
+			}
+			value, err := amount(words[2])
+			if err != nil {
+				return fail("%s", err)
+			}
+			rule.below, rule.hasBal = value, true
+			words = words[3:]
+		case words[0] == "on" && len(words) > 1 && (words[1] == "weekends" || words[1] == "weekdays"):
+			weekend := words[1] == "weekends"
+			rule.weekend = &weekend
+			words = words[2:]
+		case words[0] == "more" && len(words) > 4 && words[1] == "than" && words[3] == "per":
+			n, err := strconv.Atoi(words[2])
+			if err != nil || n < 0 {
+				return fail("invalid count %q", words[2])
+			}
+			window, ok := policyWindows[words[4]]
+			if !ok {
+				return fail("unknown period %q, expected minute, hour or day", words[4])
+			}
+			rule.limit, rule.window = n, window
+			words = words[5:]
+		case strings.Join(words, " ") == "requires approval":
+			rule.Action = PolicyRequireApproval
+			words = nil
+		case strings.Join(words, " ") == "is denied":
+			rule.Action = PolicyDeny
+			words = nil
+		case strings.Join(words, " ") == "is flagged":
+			rule.Action = PolicyFlag
+			words = nil
+		default:
+			return fail("unexpected %q", strings.Join(words, " "))
+		}
+	}
+
+	if rule.Action == "" {
+		return fail("missing action: requires approval, is denied or is flagged")
+	}
+	return rule, nil
+}
+
+var policyWindows = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// parsePolicyType accepts DEPOSIT/WITHDRAW and their plural nouns
+func parsePolicyType(word string) (models.TransactionType, bool) {
+	switch word {
+	case "deposit", "deposits":
+		return models.Deposit, true
+	case "withdraw", "withdrawal", "withdrawals":
+		return models.Withdraw, true
+	}
+	return "", false
+}
+
+func isPolicyAsset(asset models.Asset) bool {
+	return asset == models.BTC || asset == models.ETH || asset == models.USD
+}
+
+// applies reports whether the rule names the entry's type and asset
+func (r PolicyRule) applies(entry models.Transaction) bool {
+	return (r.txType == "" || entry.Type == r.txType) && (r.asset == "" || entry.Asset == r.asset)
+}
+
+// matches reports whether every condition of the rule holds for entry
+// made at now; the entry's own timestamp is not trusted. balance is the
+// balance of its asset after the entry, and history the entries recorded
+// before it, oldest first
+func (r PolicyRule) matches(entry models.Transaction, balance int64, history []models.Transaction, now time.Time) bool {
+	if !r.applies(entry) {
+		return false
+	}
+	if r.hasMin && (entry.Amount < r.above || (!r.incl && entry.Amount == r.above)) {
+		return false
+	}
+	if r.hasBal && balance >= r.below {
+		return false
+	}
+	if r.weekend != nil {
+		day := now.Weekday()
+		if (day == time.Saturday || day == time.Sunday) != *r.weekend {
+			return false
+		}
+	}
+	if r.window > 0 {
+		since := now.Add(-r.window)
+		count := 0
+		for i := len(history) - 1; i >= 0; i-- {
+			// Entries dated in the future do not count until their time comes
+			if !history[i].Timestamp.After(since) || history[i].Timestamp.After(now) {
+				continue
+			}
+			if r.applies(history[i]) {
+				count++
+			}
+		}
+		if count < r.limit {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPolicy replaces the wallet's policy; nil removes it
+func (w *Wallet) SetPolicy(policy *Policy) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.policy = policy
+}
+
+// applyPolicy evaluates the policy on entries about to be committed, in
+// order, each one seeing the ones before it. It records flag hits in
+// PolicyHits and rejects all of them when a deny or approval rule matches;
+// approval rules are skipped for entries already approved
+// The caller holds w.mu
+func (w *Wallet) applyPolicy(entries []models.Transaction, approved bool) error {
+	if w.policy == nil {
+		return nil
+	}
+
+	now := w.now()
+	history := w.ledger.GetTransactions()
+	history = history[:len(history):len(history)]
+	balances := w.ledger.CalculateAllBalances()
+	for i := range entries {
+		entry := &entries[i]
+		applyToBalances(balances, *entry)
+		for _, rule := range w.policy.Rules {
+			if !rule.matches(*entry, balances[entry.Asset], history, now) {
+				continue
+			}
+			switch rule.Action {
+			case PolicyFlag:
+				entry.PolicyHits = append(entry.PolicyHits, rule.Text)
+			case PolicyRequireApproval:
+				if approved {
+					continue
+				}
+				return &RuleError{Rule: rule.Text, Err: ErrApprovalRequired}
+			default:
+				return &RuleError{Rule: rule.Text, Err: ErrPolicyDenied}
+			}
+		}
+		// The entries of this commit count as made now, whatever their dates
+		counted := *entry
+		counted.Timestamp = now
+		history = append(history, counted)
+	}
+	return nil
+}
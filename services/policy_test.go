@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func TestParsePolicyRule(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{"WITHDRAW USD > 10000 requires approval", false},
+		{"no ETH withdrawals on weekends", false},
+		{"max 5 withdrawals per hour", false},
+		{"deposits BTC >= 1 is flagged", false},
+		{"withdrawals USD balance < 50 is flagged", false},
+		{"ANY more than 3 per minute is denied", false},
+		{"WITHDRAW USD > 10000", true},
+		{"WITHDRAW > 10 is denied", true},
+		{"max 5 withdrawals per week", true},
+		{"WITHDRAW USD under 5 is denied", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		_, err := ParsePolicyRule(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePolicyRule(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("ParsePolicyRule(%q) error = %v, expected ErrInvalidPolicy", tt.text, err)
+		}
+	}
+}
+
+func policyWallet(t *testing.T, rules ...string) *Wallet {
+	t.Helper()
+	policy, err := ParsePolicy(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewWallet()
+	wallet.SetPolicy(policy)
+	return wallet
+}
+
+func TestPolicy_RequiresApprovalAndFlags(t *testing.T) {
+	wallet := policyWallet(t, "WITHDRAW USD > 100 requires approval", "USD balance < 450 is flagged")
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 50000})
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 20000})
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "WITHDRAW USD > 100 requires approval" || !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("Expected the withdrawal to require approval, got %v", err)
+	}
+
+	entry, err := wallet.Apply(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 9000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.PolicyHits) != 1 || entry.PolicyHits[0] != "USD balance < 450 is flagged" {
+		t.Errorf("Expected the low balance to be flagged on the entry, got %v", entry.PolicyHits)
+	}
+	if stored, _ := wallet.GetTransaction(entry.ID); len(stored.PolicyHits) != 1 {
+		t.Errorf("Expected the hit to be recorded in the ledger, got %+v", stored)
+	}
+}
+
+func TestPolicy_WeekendsAndRate(t *testing.T) {
+	wallet := policyWallet(t, "no ETH withdrawals on weekends", "max 2 withdrawals per hour")
+	now := time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC) // a Saturday
+	wallet.now = func() time.Time { return now }
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 100})
+
+	// A weekday timestamp does not make a weekend withdrawal pass
+	monday := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1, Timestamp: monday})
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected a weekend ETH withdrawal to be denied, got %v", err)
+	}
+
+	now = monday
+	for i := range 2 {
+		if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1}); err != nil {
+			t.Fatalf("Expected withdrawal %d to pass, got %v", i+1, err)
+		}
+		now = now.Add(time.Minute)
+	}
+	now = monday.Add(30 * time.Minute)
+	err = wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1, Timestamp: monday.Add(-time.Hour)})
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected a third withdrawal within the hour to be denied, whatever its date, got %v", err)
+	}
+	now = monday.Add(2 * time.Hour)
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 1}); err != nil {
+		t.Errorf("Expected a withdrawal an hour later to pass, got %v", err)
+	}
+}
+
+func TestPolicy_FutureTimestamps(t *testing.T) {
+	wallet := policyWallet(t, "max 1 withdrawals per hour")
+	now := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	wallet.now = func() time.Time { return now }
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100})
+
+	// Dating withdrawals a day ahead neither escapes the window now...
+	tomorrow := now.Add(24 * time.Hour)
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 1, Timestamp: tomorrow}); err != nil {
+		t.Fatal(err)
+	}
+	err := wallet.ProcessBatch([]models.Transaction{
+		{Type: models.Withdraw, Asset: models.USD, Amount: 1, Timestamp: tomorrow.Add(time.Hour)},
+		{Type: models.Withdraw, Asset: models.USD, Amount: 1, Timestamp: tomorrow.Add(2 * time.Hour)},
+	})
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected the second withdrawal of the batch to be denied, got %v", err)
+	}
+
+	// ...nor counts against honest withdrawals made before its date
+	now = tomorrow.Add(-time.Hour)
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 1}); err != nil {
+		t.Errorf("Expected a withdrawal before the future-dated one to pass, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Validator is a named check run on every transaction before it is
+// committed, after the wallet's own checks (unique ID, known type,
+// sufficient funds). balance is the balance of tx.Asset the transaction
+// would be applied to; in a batch it includes the transactions before it
+type Validator struct {
+	Name  string
+	Check func(tx models.Transaction, balance int64) error
+}
+
+// Interceptor runs around the commit of every entry
+// Before sees the entry about to be recorded, with its ID and timestamp
+// assigned, and rejects it by returning an error; in a batch one
+// rejection rejects the whole batch. After sees the entry once it is in
+// the ledger. Both run under the wallet lock and must not call the wallet
+type Interceptor struct {
+	Name   string
+	Before func(entry models.Transaction) error
+	After  func(entry models.Transaction)
+}
+
+// Use appends validators to the wallet's pipeline; they run in order and
+// the first rejection wins
+func (w *Wallet) Use(validators ...Validator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.validators = append(w.validators, validators...)
+}
+
+// Intercept appends interceptors to the wallet's pipeline; Before runs in
+// order and the first rejection wins, After runs in order for every entry
+func (w *Wallet) Intercept(interceptors ...Interceptor) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.interceptors = append(w.interceptors, interceptors...)
+}
+
+// checkRules runs the registered validators; the caller holds w.mu
+func (w *Wallet) checkRules(tx models.Transaction, balance int64) error {
+	for _, validator := range w.validators {
+		if err := validator.Check(tx, balance); err != nil {
+			return &RuleError{Rule: validator.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// beforeCommit runs every Before interceptor on the prepared entries
+// The caller holds w.mu
+func (w *Wallet) beforeCommit(entries []models.Transaction) error {
+	for _, entry := range entries {
+		for _, interceptor := range w.interceptors {
+			if interceptor.Before == nil {
+				continue
+			}
+			if err := interceptor.Before(entry); err != nil {
+				return &RuleError{Rule: interceptor.Name, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// afterCommit runs every After interceptor on the recorded entries
+// The caller holds w.mu
+func (w *Wallet) afterCommit(entries []models.Transaction) {
+	for _, entry := range entries {
+		for _, interceptor := range w.interceptors {
+			if interceptor.After != nil {
+				interceptor.After(entry)
+			}
+		}
+	}
+}
+
+// BlockedAsset rejects every transaction in asset
+func BlockedAsset(asset models.Asset) Validator {
+	return Validator{
+		Name: "blocked-asset",
+		Check: func(tx models.Transaction, _ int64) error {
+			if tx.Asset == asset {
+				return fmt.Errorf("%s is blocked", asset)
+			}
+			return nil
+		},
+	}
+}
+
+// MaxAmount rejects transactions in asset above limit (in smallest units)
+func MaxAmount(asset models.Asset, limit int64) Validator {
+	return Validator{
+		Name: "max-amount",
+		Check: func(tx models.Transaction, _ int64) error {
+			if tx.Asset == asset && tx.Amount > limit {
+				return fmt.Errorf("amount %s exceeds the limit of %s %s",
+					asset.Format(tx.Amount), asset.Format(limit), asset)
+			}
+			return nil
+		},
+	}
+}
+
+// BusinessHours rejects entries committed outside [from, to) hours of the
+// day in loc, or on a weekend, by the wallet's clock; the timestamp an
+// entry carries is not trusted
+func (w *Wallet) BusinessHours(from, to int, loc *time.Location) Interceptor {
+	return Interceptor{
+		Name: "business-hours",
+		Before: func(models.Transaction) error {
+			at := w.now().In(loc)
+			if weekday := at.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+				return fmt.Errorf("%s is not a business day", weekday)
+			}
+			if hour := at.Hour(); hour < from || hour >= to {
+				return fmt.Errorf("%s is outside business hours (%02d:00-%02d:00)", at.Format("15:04"), from, to)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func TestUse_RejectsWithRuleName(t *testing.T) {
+	wallet := NewWallet()
+	wallet.Use(BlockedAsset(models.ETH), MaxAmount(models.USD, 10000))
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 20000})
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "max-amount" || models.ErrorCode(err) != "RULE_REJECTED" {
+		t.Fatalf("Expected a max-amount rejection, got %v", err)
+	}
+
+	err = wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1})
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "blocked-asset" {
+		t.Errorf("Expected a blocked-asset rejection, got %v", err)
+	}
+
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 5000}); err != nil {
+		t.Errorf("Expected a deposit within the rules to succeed, got %v", err)
+	}
+}
+
+func TestUse_LedgerChecksRunFirst(t *testing.T) {
+	wallet := NewWallet()
+	wallet.Use(MaxAmount(models.BTC, 1))
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 5})
+	if !errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrRuleRejected) {
+		t.Errorf("Expected insufficient funds before any rule, got %v", err)
+	}
+}
+
+func TestIntercept_BusinessHoursAndAfter(t *testing.T) {
+	wallet := NewWallet()
+	wallet.now = func() time.Time { return time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC) } // a Saturday
+
+	var recorded []string
+	wallet.Intercept(wallet.BusinessHours(9, 17, time.UTC), Interceptor{
+		Name:  "audit",
+		After: func(entry models.Transaction) { recorded = append(recorded, entry.ID) },
+	})
+
+	err := wallet.ProcessBatch([]models.Transaction{
+		{Type: models.Deposit, Asset: models.USD, Amount: 100, Timestamp: time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)},
+		{Type: models.Deposit, Asset: models.USD, Amount: 100},
+	})
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "business-hours" {
+		t.Fatalf("Expected the weekend entry to reject the batch, got %v", err)
+	}
+	// A weekday timestamp does not get a weekend entry through
+	err = wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100, Timestamp: time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)})
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "business-hours" {
+		t.Errorf("Expected the wallet's clock to be used, got %v", err)
+	}
+	if len(wallet.GetTransactionHistory()) != 0 || len(recorded) != 0 {
+		t.Errorf("Expected nothing committed, got %d entries and %v", len(wallet.GetTransactionHistory()), recorded)
+	}
+
+	wallet.now = func() time.Time { return time.Date(2024, 1, 8, 16, 59, 0, 0, time.UTC) }
+	if err := wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100}); err != nil {
+		t.Fatalf("Expected a deposit on Monday afternoon to succeed, got %v", err)
+	}
+	if len(recorded) != 1 || recorded[0] != "1" {
+		t.Errorf("Expected After to see entry 1, got %v", recorded)
+	}
+}
+
+func TestFork_KeepsRulesWithoutAfter(t *testing.T) {
+	wallet := NewWallet()
+	calls := 0
+	wallet.Use(BlockedAsset(models.ETH))
+	wallet.Intercept(Interceptor{Name: "audit", After: func(models.Transaction) { calls++ }})
+
+	fork := wallet.Fork()
+	if err := fork.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 1}); !errors.Is(err, ErrRuleRejected) {
+		t.Errorf("Expected the fork to apply the validators, got %v", err)
+	}
+	fork.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 1})
+	if calls != 0 {
+		t.Errorf("Expected no After calls from the fork, got %d", calls)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// UTXOs returns the unspent BTC outputs, oldest first
+// It is empty for a user who may not view the BTC account
+func (w *Wallet) UTXOs() []models.UTXO {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.canView(models.BTC) {
+		return nil
+	}
+	return w.ledger.UTXOs().Unspent()
+}
+
+// CheckUTXOs reports whether the UTXO set agrees with the BTC balance of
+// the ledger; a mismatch is reported with models.ErrUTXOMismatch
+func (w *Wallet) CheckUTXOs() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.ledger.CheckUTXOs()
+}
+
+// checkCoins refuses a withdrawal that would pay out dust when coin
+// selection is enabled
+func (w *Wallet) checkCoins(tx models.Transaction) error {
+	if w.coinSelection != nil && tx.Asset == models.BTC && tx.Type == models.Withdraw && tx.Amount < DustLimit {
+		return fmt.Errorf("%w: %s BTC is less than %s", ErrDustOutput, tx.FormatAmount(), models.BTC.Format(DustLimit))
+	}
+	return nil
+}
+
+// assignCoins records on every BTC entry the outputs it creates and
+// spends, each entry seeing the outputs left by the ones before it
+// Withdrawals select them with selectCoins when coin selection is
+// enabled. The caller holds w.mu
+func (w *Wallet) assignCoins(txs []models.Transaction) error {
+	utxos := w.ledger.UTXOs().Clone()
+	for i, tx := range txs {
+		if tx.Asset != models.BTC {
+			continue
+		}
+		tx.Coins = nil
+		var coins *models.Coins
+		var err error
+		if w.coinSelection != nil && tx.Type == models.Withdraw {
+			coins, err = w.selectCoins(utxos, tx)
+		} else {
+			coins, err = utxos.Coins(tx)
+		}
+		if errors.Is(err, models.ErrNotEnoughCoins) {
+			return &InsufficientFundsError{Asset: tx.Asset, Requested: tx.Amount, Available: utxos.Total()}
+		}
+		if err != nil {
+			return err
+		}
+		tx.Coins = coins
+		if err := utxos.Apply(tx); err != nil {
+			return err
+		}
+		txs[i] = tx
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func TestWallet_UTXOs(t *testing.T) {
+	wallet := NewWallet()
+	for _, tx := range []models.Transaction{
+		{Type: models.Deposit, Asset: models.BTC, Amount: 50},
+		{Type: models.Deposit, Asset: models.BTC, Amount: 30},
+		{Type: models.Deposit, Asset: models.ETH, Amount: 10},
+	} {
+		if err := wallet.ProcessTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	withdrawal, err := wallet.Apply(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withdrawal.Coins == nil || len(withdrawal.Coins.Inputs) != 2 || withdrawal.Coins.Change != 20 {
+		t.Fatalf("Expected two inputs and 20 of change, got %+v", withdrawal.Coins)
+	}
+	if eth, _ := wallet.GetTransaction("3"); eth.Coins != nil {
+		t.Errorf("Expected ETH entries to move no coins, got %+v", eth.Coins)
+	}
+
+	utxos := wallet.UTXOs()
+	if len(utxos) != 1 || utxos[0].Value != 20 || utxos[0].Entry != withdrawal.ID {
+		t.Errorf("Expected only the change to be unspent, got %+v", utxos)
+	}
+	if err := wallet.CheckUTXOs(); err != nil {
+		t.Errorf("Expected the UTXO set to match the balance, got %v", err)
+	}
+
+	// Only the wallet chooses coins, even for a withdrawal that names an
+	// unspent output
+	named := models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 15,
+		Coins: &models.Coins{TxID: models.EntryTxID("spend"), Inputs: []models.Outpoint{utxos[0].Outpoint}, Change: 5}}
+	if err := wallet.ProcessTransaction(named); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected ErrInvalidEntry for named coins, got %v", err)
+	}
+	if err := wallet.ProcessBatch([]models.Transaction{named}); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("Expected ErrInvalidEntry for named coins in a batch, got %v", err)
+	}
+	named.Coins = nil
+	if err := wallet.ProcessTransaction(named); err != nil {
+		t.Fatal(err)
+	}
+	if wallet.GetBalance(models.BTC) != 5 || wallet.CheckUTXOs() != nil {
+		t.Errorf("Expected 5 in agreement with the outputs, got %d (%v)", wallet.GetBalance(models.BTC), wallet.CheckUTXOs())
+	}
+}
+
+func TestVerify_Coins(t *testing.T) {
+	deposit := models.Transaction{ID: "1", Type: models.Deposit, Asset: models.BTC, Amount: 100}
+	entries := []models.Transaction{
+		deposit,
+		{ID: "2", Type: models.Withdraw, Asset: models.BTC, Amount: 60,
+			Coins: &models.Coins{TxID: models.EntryTxID("2"), Inputs: []models.Outpoint{{TxID: models.EntryTxID("1")}}, Change: 30}},
+		{ID: "3", Type: models.Deposit, Asset: models.ETH, Amount: 1, Coins: &models.Coins{TxID: models.EntryTxID("3")}},
+	}
+
+	problems := Verify(entries)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if !errors.Is(problems[0], models.ErrUnbalancedCoins) || !errors.Is(problems[1], ErrInvalidEntry) {
+		t.Errorf("Expected unbalanced coins and ETH coins, got %v", problems)
+	}
+}
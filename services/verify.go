@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// VerifyError describes one ledger entry that fails verification
+type VerifyError struct {
+	Seq int    // position in the ledger, starting at 1
+	ID  string // the entry's ID, possibly empty
+	Err error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("entry %d (id %q): %s", e.Seq, e.ID, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify replays ledger entries from an empty wallet and reports every
+// entry the wallet would not have accepted: missing or duplicate IDs,
+// unknown types or assets, non-positive amounts, withdrawals exceeding the
+// balance at that point, compensations of entries that do not exist, and
+// BTC coins that do not fit the UTXO set at that point
+func Verify(entries []models.Transaction) []error {
+	var problems []error
+	report := func(seq int, tx models.Transaction, err error) {
+		problems = append(problems, &VerifyError{Seq: seq, ID: tx.ID, Err: err})
+	}
+
+	balances := make(map[models.Asset]int64)
+	utxos := models.NewUTXOSet()
+	seen := make(map[string]bool, len(entries))
+
+	for i, tx := range entries {
+		seq := i + 1
+		reported := len(problems)
+
+		switch {
+		case tx.ID == "":
+			report(seq, tx, fmt.Errorf("%w: missing id", ErrInvalidEntry))
+		case seen[tx.ID]:
+			report(seq, tx, fmt.Errorf("%w: %s", ErrDuplicateID, tx.ID))
+		}
+		if tx.Reverses != "" && !seen[tx.Reverses] {
+			report(seq, tx, fmt.Errorf("%w: compensates unknown entry %q", ErrInvalidEntry, tx.Reverses))
+		}
+		seen[tx.ID] = true
+
+		if tx.Asset.GetDecimals() == 0 {
+			report(seq, tx, fmt.Errorf("%w: %q", models.ErrInvalidAsset, tx.Asset))
+			continue
+		}
+		if tx.Amount <= 0 {
+			report(seq, tx, fmt.Errorf("%w: amount must be positive", models.ErrInvalidAmount))
+		}
+
+		switch tx.Type {
+		case models.Deposit:
+			balances[tx.Asset] += tx.Amount
+		case models.Withdraw:
+			if balances[tx.Asset] < tx.Amount+tx.Fee() {
+				report(seq, tx, &InsufficientFundsError{Asset: tx.Asset, Requested: tx.Amount + tx.Fee(), Available: balances[tx.Asset]})
+			}
+			balances[tx.Asset] -= tx.Amount + tx.Fee()
+		default:
+			report(seq, tx, fmt.Errorf("%w: %s", ErrUnknownType, tx.Type))
+		}
+
+		switch {
+		case tx.Coins != nil && tx.Asset != models.BTC:
+			report(seq, tx, fmt.Errorf("%w: only BTC entries move coins", ErrInvalidEntry))
+		case len(problems) > reported:
+			// An entry already found wrong would only fail here for the same reason
+		default:
+			if err := utxos.Apply(tx); err != nil {
+				report(seq, tx, err)
+			}
+		}
+	}
+
+	return problems
+}
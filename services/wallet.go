@@ -1,73 +1,553 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/fraidev/hedix-wallet/models"
 )
 
+// Journal durably records ledger entries so a wallet survives restarts
+type Journal interface {
+	// Load returns every entry recorded so far, oldest first
+	Load() ([]models.Transaction, error)
+	// Append records entries in order; either all of them are written or none
+	Append(txs ...models.Transaction) error
+}
+
 // Wallet represents an in-memory wallet with ledger-based storage
+// It is safe for concurrent use. The wallet returned by NewWallet or
+// OpenWallet acts as its owner; As returns a handle to the same wallet
+// that acts on behalf of a user (see EnableAccessControl)
 type Wallet struct {
-	ledger *models.Ledger
+	*state
+	principal string // "" for the owner
+	scope     *Scope // nil for no restriction, see Restrict
+}
+
+// state is everything the handles of one wallet share
+type state struct {
+	mu      sync.RWMutex // guards ledger
+	ledger  *models.Ledger
+	journal Journal          // nil for purely in-memory wallets
+	now     func() time.Time // clock used to timestamp transactions
+
+	subscribers map[*Subscription]struct{} // guarded by mu
+	thresholds  map[models.Asset]int64     // guarded by mu
+	hooks       []*hook                    // guarded by mu, copied on write
+	pending     []Event                    // published under mu, delivered to hooks by unlock
+	panicReport func(*HookPanicError)      // guarded by mu
+
+	validators   []Validator   // guarded by mu
+	interceptors []Interceptor // guarded by mu
+	policy       *Policy       // guarded by mu; nil for none
+
+	approval      *ApprovalConfig    // guarded by mu; nil when approvals are off
+	approvalStore ApprovalStore      // nil for purely in-memory wallets
+	requests      []*ApprovalRequest // guarded by mu, oldest first
+
+	access *AccessControl // guarded by mu; nil when access control is off
+
+	derive       AddressDeriver   // guarded by mu; nil when addresses are off
+	addressStore AddressStore     // nil for purely in-memory wallets
+	addresses    []ReceiveAddress // guarded by mu, oldest first
+	addressIndex map[string]int   // guarded by mu; addressKey -> index in addresses
+
+	allowlistConfig *AllowlistConfig // guarded by mu; nil when no account opted in
+	allowlistStore  AllowlistStore   // nil for purely in-memory wallets
+	allowlist       []AllowedAddress // guarded by mu, oldest first; replaced on removal
+
+	coinSelection *CoinSelection // guarded by mu; nil for oldest first without fees
+
+	dispatchMu   sync.Mutex // guards tickets and dispatched
+	dispatchCond *sync.Cond
+	tickets      uint64 // deliveries handed out so far
+	dispatched   uint64 // deliveries finished so far
 }
 
 // NewWallet creates a new wallet
 func NewWallet() *Wallet {
-	return &Wallet{
-		ledger: models.NewLedger(),
+	return newWallet(models.NewLedger(), time.Now)
+}
+
+func newWallet(ledger *models.Ledger, now func() time.Time) *Wallet {
+	w := &Wallet{state: &state{ledger: ledger, now: now}}
+	w.dispatchCond = sync.NewCond(&w.dispatchMu)
+	return w
+}
+
+// OpenWallet creates a wallet from the entries already in the journal
+// Every entry committed afterwards is appended to the journal before it
+// becomes visible in the ledger
+func OpenWallet(journal Journal) (*Wallet, error) {
+	entries, err := journal.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	w := NewWallet()
+	for _, tx := range entries {
+		w.ledger.AddTransaction(tx)
 	}
+	w.journal = journal
+	return w, nil
+}
+
+// Fork returns a wallet for simulating transactions (dry runs) that starts
+// from a copy of this wallet's ledger, configuration and pending requests
+// and acts for the same user. Nothing it does reaches the original, and
+// configuring either one afterwards does not affect the other
+// It has no journal or stores, cannot generate addresses, and has no
+// subscribers, hooks, thresholds or After interceptors, so a simulation
+// has no side effects
+func (w *Wallet) Fork() *Wallet {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	fork := newWallet(w.ledger.Clone(), w.now)
+	fork.principal = w.principal
+	fork.scope = w.scope
+	fork.access = w.access.clone()
+	fork.policy = w.policy.clone()
+	fork.approval = w.approval.clone()
+	fork.addresses = append([]ReceiveAddress(nil), w.addresses...)
+	fork.addressIndex = maps.Clone(w.addressIndex)
+	fork.allowlistConfig = w.allowlistConfig.clone()
+	fork.allowlist = slices.Clone(w.allowlist)
+	if w.coinSelection != nil {
+		selection := *w.coinSelection
+		fork.coinSelection = &selection
+	}
+	for _, request := range w.requests {
+		copied := copyRequest(request)
+		fork.requests = append(fork.requests, &copied)
+	}
+	fork.validators = append([]Validator(nil), w.validators...)
+	for _, interceptor := range w.interceptors {
+		interceptor.After = nil
+		fork.interceptors = append(fork.interceptors, interceptor)
+	}
+	return fork
 }
 
 // ProcessTransaction processes a transaction attempt in the ledger
-// It validates the transaction based on current balance and records the result
+// It validates the transaction based on current balance and records the
+// result. Callers that need the recorded entry use Apply
 func (w *Wallet) ProcessTransaction(tx models.Transaction) error {
-	// Calculate current balance for the asset (in smallest units)
-	currentBalance := w.ledger.CalculateBalance(tx.Asset)
+	_, err := w.Apply(tx)
+	return err
+}
+
+// Apply processes a transaction like ProcessTransaction and returns the
+// ledger entry that was recorded: its assigned ID and timestamp, policy
+// hits and, for a BTC withdrawal, the coins, fee and change the wallet
+// selected. It is the way to learn what the wallet decided for an entry
+func (w *Wallet) Apply(tx models.Transaction) (models.Transaction, error) {
+	w.mu.Lock()
+	defer w.unlock()
+
+	return w.apply(tx, "")
+}
+
+// apply validates and commits one transaction and publishes the outcome
+// reverses is the ID of the entry it compensates, set only by Undo
+// A transaction that needs approval is held instead and reported with a
+// *PendingApprovalError. The caller holds w.mu
+func (w *Wallet) apply(tx models.Transaction, reverses string) (models.Transaction, error) {
+	w.expireRequests()
+
+	err := checkSubmitted(tx)
+	tx = w.stamp(tx, reverses)
+	if err == nil {
+		err = w.authorizeTx(tx)
+	}
+	if err == nil {
+		// Funds held for pending approvals cannot be withdrawn again
+		err = w.validate(tx, w.available(tx.Asset))
+	}
+	if err == nil {
+		if reason := w.approvalReason(tx); reason != "" {
+			return models.Transaction{}, w.hold(tx, reason)
+		}
+	}
+	var committed []models.Transaction
+	if err == nil {
+		committed, err = w.commit(tx)
+	}
+	var ruleErr *RuleError
+	if w.approval != nil && errors.Is(err, ErrApprovalRequired) && errors.As(err, &ruleErr) {
+		return models.Transaction{}, w.hold(tx, "policy: "+ruleErr.Rule)
+	}
+	if err != nil {
+		w.publishRejected(tx, err)
+		return models.Transaction{}, err
+	}
+
+	w.publishAccepted(committed)
+	return committed[0], nil
+}
+
+// ValidateBatch checks every transaction as if the batch were applied in
+// order, each one seeing the balances projected by the ones before it
+// Nothing is recorded. It returns a *BatchError listing every failure
+func (w *Wallet) ValidateBatch(txs []models.Transaction) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.validateBatch(txs)
+}
+
+// validateBatch implements ValidateBatch; the caller holds w.mu
+func (w *Wallet) validateBatch(txs []models.Transaction) error {
+	projected := w.ledger.CalculateAllBalances()
+	for asset := range projected {
+		projected[asset] -= w.held(asset)
+	}
+	batchIDs := make(map[string]bool)
+	var failures []BatchFailure
+
+	for i, tx := range txs {
+		err := checkSubmitted(tx)
+		if err == nil {
+			err = w.authorizeTx(tx)
+		}
+		if err == nil {
+			err = w.validate(tx, projected[tx.Asset])
+		}
+		if reason := w.approvalReason(tx); err == nil && reason != "" {
+			// A batch is committed at once, so it cannot wait on one entry
+			err = fmt.Errorf("%w: %s; submit it on its own", ErrApprovalRequired, reason)
+		}
+		if err == nil && tx.ID != "" && batchIDs[tx.ID] {
+			err = fmt.Errorf("%w: %s", ErrDuplicateID, tx.ID)
+		}
+		if err != nil {
+			failures = append(failures, BatchFailure{Index: i, Transaction: tx, Err: err})
+			continue
+		}
+
+		if tx.ID != "" {
+			batchIDs[tx.ID] = true
+		}
+		switch tx.Type {
+		case models.Deposit:
+			projected[tx.Asset] += tx.Amount
+		case models.Withdraw:
+			projected[tx.Asset] -= tx.Amount + tx.Fee()
+		}
+	}
+
+	if len(failures) > 0 {
+		return &BatchError{Total: len(txs), Failures: failures}
+	}
+	return nil
+}
+
+// ProcessBatch records all transactions or none of them
+// The batch is validated with ValidateBatch first; on any failure the
+// ledger is left untouched and the *BatchError is returned
+func (w *Wallet) ProcessBatch(txs []models.Transaction) error {
+	_, err := w.ApplyBatch(txs)
+	return err
+}
+
+// ApplyBatch processes a batch like ProcessBatch and returns the ledger
+// entries that were recorded, in order, as Apply does for one transaction
+func (w *Wallet) ApplyBatch(txs []models.Transaction) ([]models.Transaction, error) {
+	w.mu.Lock()
+	defer w.unlock()
+
+	w.expireRequests()
+	if err := w.validateBatch(txs); err != nil {
+		for _, failure := range err.(*BatchError).Failures {
+			w.publishRejected(failure.Transaction, failure.Err)
+		}
+		return nil, err
+	}
+
+	stamped := make([]models.Transaction, len(txs))
+	for i, tx := range txs {
+		stamped[i] = w.stamp(tx, "")
+	}
+	committed, err := w.commit(stamped...)
+	if err != nil {
+		// Nothing was recorded, e.g. because the journal failed
+		for _, tx := range stamped {
+			w.publishRejected(tx, err)
+		}
+		return nil, err
+	}
+	w.publishAccepted(committed)
+	return committed, nil
+}
 
-	var err error
+// checkSubmitted refuses a transaction that sets a field only the wallet
+// records on its entries, whichever way it was submitted
+func checkSubmitted(tx models.Transaction) error {
+	if field := models.RecordedField(tx); field != "" {
+		return fmt.Errorf("%w: %s is recorded by the wallet", ErrInvalidEntry, field)
+	}
+	return nil
+}
+
+// stamp records the acting user as the transaction's principal, empty for
+// the owner, and the entry it compensates, if any. Addresses are recorded
+// in canonical form
+func (w *Wallet) stamp(tx models.Transaction, reverses string) models.Transaction {
+	tx.Principal = w.principal
+	tx.Reverses = reverses
+	tx.Address = w.canonicalAddress(tx)
+	return tx
+}
+
+// validate checks a transaction against the given balance of its asset:
+// first the wallet's own checks, then the registered validators
+func (w *Wallet) validate(tx models.Transaction, balance int64) error {
+	if err := w.checkLedger(tx, balance); err != nil {
+		return err
+	}
+	return w.checkRules(tx, balance)
+}
+
+// checkLedger enforces what the ledger itself requires: unique IDs, a
+// known asset and type, a positive amount, valid addresses and coins, and
+// enough funds for withdrawals
+func (w *Wallet) checkLedger(tx models.Transaction, balance int64) error {
+	// Transactions carrying their own ID (e.g. imported ones) must not collide
+	if tx.ID != "" {
+		if _, exists := w.ledger.GetTransaction(tx.ID); exists {
+			return fmt.Errorf("%w: %s", ErrDuplicateID, tx.ID)
+		}
+	}
+	// Entries built in code skip the parser, so the wallet checks them too
+	if tx.Asset.GetDecimals() == 0 {
+		return fmt.Errorf("%w: %q", models.ErrInvalidAsset, tx.Asset)
+	}
+	if tx.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", models.ErrInvalidAmount)
+	}
+
+	if err := w.checkAddress(tx); err != nil {
+		return err
+	}
+	if err := w.checkCoins(tx); err != nil {
+		return err
+	}
 
 	switch tx.Type {
 	case models.Deposit:
 		// Deposits always succeed
-		err = nil
+		return nil
 	case models.Withdraw:
 		// Withdrawals only succeed if there are sufficient funds
-		if currentBalance < tx.Amount {
-			err = fmt.Errorf("insufficient funds for withdrawal: requested %s, available %s %s",
-				formatAmount(tx.Amount, tx.Asset),
-				formatAmount(currentBalance, tx.Asset),
-				tx.Asset)
+		if balance < tx.Amount+tx.Fee() {
+			return &InsufficientFundsError{
+				Asset:     tx.Asset,
+				Requested: tx.Amount + tx.Fee(),
+				Available: balance,
+			}
 		}
+		return nil
 	default:
-		err = fmt.Errorf("unknown transaction type: %s", tx.Type)
+		return fmt.Errorf("%w: %s", ErrUnknownType, tx.Type)
 	}
+}
 
-	// Record the transaction in the ledger
-	if err == nil {
+// commit records validated transactions, assigning missing IDs,
+// timestamps and BTC coins, and returns the recorded entries. The policy and Before
+// interceptors may still reject them; then they are written to the journal, in a single
+// append, so the ledger never holds entries that were not persisted
+// The caller holds w.mu
+func (w *Wallet) commit(txs ...models.Transaction) ([]models.Transaction, error) {
+	return w.commitWith(nil, txs...)
+}
+
+// commitWith commits like commit; a non-nil approval is recorded on every
+// entry and satisfies the policy rules that require approval
+func (w *Wallet) commitWith(approval *models.Approval, txs ...models.Transaction) ([]models.Transaction, error) {
+	prepared := make([]models.Transaction, len(txs))
+	pending := make(map[string]bool, len(txs))
+	for i, tx := range txs {
+		if tx.ID == "" {
+			tx.ID = w.nextID(pending)
+		}
+		if tx.Timestamp.IsZero() {
+			tx.Timestamp = w.now()
+		}
+		tx.Approval = approval
+		pending[tx.ID] = true
+		prepared[i] = tx
+	}
+	if err := w.assignCoins(prepared); err != nil {
+		return nil, err
+	}
+
+	if err := w.applyPolicy(prepared, approval != nil); err != nil {
+		return nil, err
+	}
+	if err := w.beforeCommit(prepared); err != nil {
+		return nil, err
+	}
+
+	if w.journal != nil {
+		if err := w.journal.Append(prepared...); err != nil {
+			return nil, fmt.Errorf("writing journal: %w", err)
+		}
+	}
+
+	for _, tx := range prepared {
 		w.ledger.AddTransaction(tx)
 	}
+	w.afterCommit(prepared)
+	return prepared, nil
+}
 
-	return err
+// Undo compensates the most recent entry that has not been undone yet by
+// recording the opposite transaction; the ledger itself is never rewritten
+// Compensating entries are not undone themselves. Undoing a deposit that
+// has since been spent fails with ErrInsufficientFunds; undoing a BTC
+// withdrawal returns its fee as well. It requires the admin role
+func (w *Wallet) Undo() (models.Transaction, error) {
+	w.mu.Lock()
+	defer w.unlock()
+
+	if err := w.authorize(PermAdmin, ""); err != nil {
+		return models.Transaction{}, err
+	}
+
+	transactions := w.ledger.GetTransactions()
+
+	reversed := make(map[string]bool)
+	for _, tx := range transactions {
+		if tx.Reverses != "" {
+			reversed[tx.Reverses] = true
+		}
+	}
+
+	for i := len(transactions) - 1; i >= 0; i-- {
+		original := transactions[i]
+		if original.Reverses != "" || reversed[original.ID] {
+			continue
+		}
+
+		compensation := models.Transaction{
+			Type:   models.Deposit,
+			Asset:  original.Asset,
+			Amount: original.Amount + original.Fee(),
+			Memo:   "undo of " + original.ID,
+		}
+		if original.Type == models.Deposit {
+			compensation.Type = models.Withdraw
+		}
+
+		return w.apply(compensation, original.ID)
+	}
+
+	return models.Transaction{}, ErrNothingToUndo
 }
 
 // GetBalance returns the current balance for a specific asset (in smallest units)
+// It is 0 for an account the user may not view
 func (w *Wallet) GetBalance(asset models.Asset) int64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.canView(asset) {
+		return 0
+	}
 	return w.ledger.CalculateBalance(asset)
 }
 
-// GetAllBalances returns balances for all assets (in smallest units)
+// GetAllBalances returns balances for all assets (in smallest units) the
+// user may view
 func (w *Wallet) GetAllBalances() map[models.Asset]int64 {
-	return w.ledger.CalculateAllBalances()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.visibleBalances(w.ledger.CalculateAllBalances())
+}
+
+// BalancesAfter returns the balances the user may view as they were right
+// after the ledger entry with the given ID
+func (w *Wallet) BalancesAfter(id string) (map[models.Asset]int64, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	tx, ok := w.ledger.GetTransaction(id)
+	if !ok || !w.canView(tx.Asset) {
+		return nil, false
+	}
+	balances, _ := w.ledger.BalancesAfter(id)
+	return w.visibleBalances(balances), true
 }
 
 // GetLedger returns the underlying ledger (for testing/debugging)
+// It must not be used while other goroutines use the wallet
 func (w *Wallet) GetLedger() *models.Ledger {
 	return w.ledger
 }
 
-// GetTransactionHistory returns all ledger entries
+// GetTransactionHistory returns all ledger entries the user may view
 func (w *Wallet) GetTransactionHistory() []models.Transaction {
-	return w.ledger.GetTransactions()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	entries := w.ledger.GetTransactions()
+	if w.unrestricted() {
+		return entries
+	}
+	visible := make([]models.Transaction, 0, len(entries))
+	for _, tx := range entries {
+		if w.canView(tx.Asset) {
+			visible = append(visible, tx)
+		}
+	}
+	return visible
+}
+
+// GetTransaction looks up a ledger entry by its ID
+func (w *Wallet) GetTransaction(id string) (models.Transaction, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	tx, ok := w.ledger.GetTransaction(id)
+	if !ok || !w.canView(tx.Asset) {
+		return models.Transaction{}, false
+	}
+	return tx, true
+}
+
+// visibleBalances leaves out the accounts the user may not view
+// The caller holds w.mu
+func (w *Wallet) visibleBalances(balances map[models.Asset]int64) map[models.Asset]int64 {
+	if w.unrestricted() {
+		return balances
+	}
+	for asset := range balances {
+		if !w.canView(asset) {
+			delete(balances, asset)
+		}
+	}
+	return balances
+}
+
+// nextID returns the ledger sequence number of the next entry as its ID,
+// skipping forward past IDs already taken by imported transactions or by
+// entries pending in the same commit
+func (w *Wallet) nextID(pending map[string]bool) string {
+	seq := len(w.ledger.GetTransactions()) + len(pending) + 1
+	for {
+		id := strconv.Itoa(seq)
+		if _, exists := w.ledger.GetTransaction(id); !exists && !pending[id] {
+			return id
+		}
+		seq++
+	}
 }
 
 // String returns a string representation of the wallet balances
@@ -81,20 +561,5 @@ func (w *Wallet) String() string {
 
 // formatAmount converts smallest unit to human-readable format
 func formatAmount(amount int64, asset models.Asset) string {
-	decimals := asset.GetDecimals()
-	divisor := int64(1)
-	for range decimals {
-		divisor *= 10
-	}
-
-	intPart := amount / divisor
-	fracPart := amount % divisor
-
-	if fracPart < 0 {
-		fracPart = -fracPart
-	}
-
-	// Format with appropriate decimal places
-	formatStr := fmt.Sprintf("%%d.%%0%dd", decimals)
-	return fmt.Sprintf(formatStr, intPart, fracPart)
+	return asset.Format(amount)
 }
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/fraidev/hedix-wallet/models"
 )
@@ -232,3 +236,347 @@ func TestWallet_ComplexScenario(t *testing.T) {
 		t.Errorf("Expected final balance %d, got %d", expectedBalance, actualBalance)
 	}
 }
+
+func TestWallet_AssignsIDAndTimestamp(t *testing.T) {
+	wallet := NewWallet()
+	fixed := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	wallet.now = func() time.Time { return fixed }
+
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 200})
+
+	history := wallet.GetTransactionHistory()
+	if history[0].ID != "1" || history[1].ID != "2" {
+		t.Errorf("Expected sequential IDs 1 and 2, got %s and %s", history[0].ID, history[1].ID)
+	}
+	if !history[0].Timestamp.Equal(fixed) {
+		t.Errorf("Expected timestamp %s, got %s", fixed, history[0].Timestamp)
+	}
+}
+
+func TestWallet_DuplicateID(t *testing.T) {
+	wallet := NewWallet()
+
+	err := wallet.ProcessTransaction(models.Transaction{ID: "2", Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// The generated ID for the second entry must skip the imported "2"
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	if id := wallet.GetTransactionHistory()[1].ID; id != "3" {
+		t.Errorf("Expected generated ID 3, got %s", id)
+	}
+
+	err = wallet.ProcessTransaction(models.Transaction{ID: "2", Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	if !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID, got: %v", err)
+	}
+	if len(wallet.GetTransactionHistory()) != 2 {
+		t.Errorf("Expected duplicate not to be recorded")
+	}
+}
+
+func TestWallet_InsufficientFundsError(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 100})
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 500})
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+
+	var fundsErr *InsufficientFundsError
+	if !errors.As(err, &fundsErr) {
+		t.Fatalf("Expected *InsufficientFundsError, got %T", err)
+	}
+	if fundsErr.Asset != models.USD || fundsErr.Requested != 500 || fundsErr.Available != 100 {
+		t.Errorf("Unexpected error fields: %+v", fundsErr)
+	}
+	if models.ErrorCode(err) != "INSUFFICIENT_FUNDS" {
+		t.Errorf("Expected code INSUFFICIENT_FUNDS, got %s", models.ErrorCode(err))
+	}
+
+	expected := "insufficient funds for withdrawal: requested 5.00, available 1.00 USD"
+	if err.Error() != expected {
+		t.Errorf("Expected message %q, got %q", expected, err.Error())
+	}
+}
+
+func TestWallet_UnknownType(t *testing.T) {
+	wallet := NewWallet()
+
+	err := wallet.ProcessTransaction(models.Transaction{Type: "TRANSFER", Asset: models.BTC, Amount: 1})
+	if !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Expected ErrUnknownType, got: %v", err)
+	}
+}
+
+func TestWallet_InvalidAssetAndAmount(t *testing.T) {
+	wallet := NewWallet()
+
+	tests := []struct {
+		tx   models.Transaction
+		want error
+	}{
+		{models.Transaction{Type: models.Deposit, Asset: "XRP", Amount: 1}, models.ErrInvalidAsset},
+		{models.Transaction{Type: models.Deposit, Asset: "", Amount: 1}, models.ErrInvalidAsset},
+		{models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 0}, models.ErrInvalidAmount},
+		{models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: -500}, models.ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		if err := wallet.ProcessTransaction(tt.tx); !errors.Is(err, tt.want) {
+			t.Errorf("%+v: expected %v, got: %v", tt.tx, tt.want, err)
+		}
+	}
+	if err := wallet.ProcessBatch([]models.Transaction{{Type: models.Deposit, Asset: "XRP", Amount: 1}}); !errors.Is(err, models.ErrInvalidAsset) {
+		t.Errorf("Expected the batch to fail with ErrInvalidAsset, got: %v", err)
+	}
+	if history := wallet.GetTransactionHistory(); len(history) != 0 {
+		t.Errorf("Expected nothing recorded, got %v", history)
+	}
+	if balance := wallet.GetBalance(models.USD); balance != 0 {
+		t.Errorf("Expected USD balance 0, got %d", balance)
+	}
+}
+
+func TestWallet_ProcessBatch_CommitsAll(t *testing.T) {
+	wallet := NewWallet()
+
+	// The withdrawal is only covered by the deposit earlier in the same batch
+	err := wallet.ProcessBatch([]models.Transaction{
+		{Type: models.Deposit, Asset: models.BTC, Amount: 300000000},
+		{Type: models.Withdraw, Asset: models.BTC, Amount: 100000000},
+		{Type: models.Deposit, Asset: models.USD, Amount: 500},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if wallet.GetBalance(models.BTC) != 200000000 {
+		t.Errorf("Expected BTC balance 200000000, got %d", wallet.GetBalance(models.BTC))
+	}
+	if len(wallet.GetTransactionHistory()) != 3 {
+		t.Errorf("Expected 3 transactions in history, got %d", len(wallet.GetTransactionHistory()))
+	}
+}
+
+func TestWallet_ProcessBatch_RejectsAll(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{ID: "seed", Type: models.Deposit, Asset: models.USD, Amount: 1000})
+
+	err := wallet.ProcessBatch([]models.Transaction{
+		{Type: models.Deposit, Asset: models.BTC, Amount: 100},
+		{Type: models.Withdraw, Asset: models.USD, Amount: 800},
+		{Type: models.Withdraw, Asset: models.USD, Amount: 800}, // only 200 left after the previous line
+		{ID: "seed", Type: models.Deposit, Asset: models.ETH, Amount: 1},
+		{ID: "x", Type: models.Deposit, Asset: models.ETH, Amount: 1},
+		{ID: "x", Type: models.Deposit, Asset: models.ETH, Amount: 1},
+	})
+
+	if !errors.Is(err, ErrBatchRejected) {
+		t.Fatalf("Expected ErrBatchRejected, got: %v", err)
+	}
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Error("Expected batch error to match ErrInsufficientFunds")
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *BatchError, got %T", err)
+	}
+
+	var indexes []int
+	for _, failure := range batchErr.Failures {
+		indexes = append(indexes, failure.Index)
+	}
+	if len(indexes) != 3 || indexes[0] != 2 || indexes[1] != 3 || indexes[2] != 5 {
+		t.Errorf("Expected failures at indexes [2 3 5], got %v", indexes)
+	}
+
+	// Nothing from the batch may be committed
+	if len(wallet.GetTransactionHistory()) != 1 {
+		t.Errorf("Expected only the seed transaction in history, got %d", len(wallet.GetTransactionHistory()))
+	}
+	if wallet.GetBalance(models.BTC) != 0 {
+		t.Errorf("Expected BTC balance 0, got %d", wallet.GetBalance(models.BTC))
+	}
+}
+
+func TestWallet_Fork(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100})
+
+	fork := wallet.Fork()
+	if err := fork.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 60}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if fork.GetBalance(models.BTC) != 40 {
+		t.Errorf("Expected fork BTC balance 40, got %d", fork.GetBalance(models.BTC))
+	}
+	if wallet.GetBalance(models.BTC) != 100 {
+		t.Errorf("Expected original BTC balance 100, got %d", wallet.GetBalance(models.BTC))
+	}
+	if len(wallet.GetTransactionHistory()) != 1 {
+		t.Errorf("Expected original history to be unchanged, got %d entries", len(wallet.GetTransactionHistory()))
+	}
+}
+
+func TestWallet_ForkCopiesConfiguration(t *testing.T) {
+	policy, err := ParsePolicy([]string{"WITHDRAW ETH is denied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewWallet()
+	wallet.SetPolicy(policy)
+	wallet.EnableAddresses(testDeriver, nil)
+	wallet.NewAddress(models.ETH)
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.ETH, Amount: 100})
+
+	fork := wallet.Fork()
+	policy.Rules = nil
+	if err := fork.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 10}); !errors.Is(err, ErrRuleRejected) {
+		t.Errorf("Expected the fork to keep the policy it started with, got: %v", err)
+	}
+
+	fork.EnableAddresses(testDeriver, nil)
+	fork.NewAddress(models.BTC)
+	if addresses := wallet.Addresses(models.BTC); len(addresses) != 0 {
+		t.Errorf("Expected the original to have no BTC address, got %+v", addresses)
+	}
+	if len(wallet.Addresses(models.ETH)) != 1 {
+		t.Errorf("Expected the original to keep its ETH address, got %+v", wallet.Addresses(models.ETH))
+	}
+}
+
+func TestWallet_RefusesRecordedFields(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100000})
+
+	withdraw := models.Transaction{Type: models.Withdraw, Asset: models.BTC, Amount: 1000}
+	tests := []struct {
+		field string
+		set   func(*models.Transaction)
+	}{
+		{"principal", func(tx *models.Transaction) { tx.Principal = "ops" }},
+		{"policy_hits", func(tx *models.Transaction) { tx.PolicyHits = []string{"rule"} }},
+		{"reverses", func(tx *models.Transaction) { tx.Reverses = "1" }},
+		{"approval", func(tx *models.Transaction) { tx.Approval = &models.Approval{Request: "A1"} }},
+		{"coins", func(tx *models.Transaction) { tx.Coins = &models.Coins{TxID: "ab"} }},
+	}
+	for _, tt := range tests {
+		tx := withdraw
+		tt.set(&tx)
+		if _, err := wallet.Apply(tx); !errors.Is(err, ErrInvalidEntry) {
+			t.Errorf("%s: expected ErrInvalidEntry, got: %v", tt.field, err)
+		}
+		if err := wallet.ProcessBatch([]models.Transaction{withdraw, tx}); !errors.Is(err, ErrInvalidEntry) {
+			t.Errorf("%s: expected the batch to fail with ErrInvalidEntry, got: %v", tt.field, err)
+		}
+	}
+	if len(wallet.GetTransactionHistory()) != 1 {
+		t.Errorf("Expected nothing recorded, got %d entries", len(wallet.GetTransactionHistory()))
+	}
+}
+
+func TestWallet_Undo(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1000})
+	wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 300})
+
+	compensation, err := wallet.Undo()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if compensation.Type != models.Deposit || compensation.Amount != 300 || compensation.Reverses != "2" {
+		t.Errorf("Unexpected compensating entry: %+v", compensation)
+	}
+	if wallet.GetBalance(models.USD) != 1000 {
+		t.Errorf("Expected USD balance 1000 after undo, got %d", wallet.GetBalance(models.USD))
+	}
+
+	// The second undo skips the compensation and the undone withdrawal
+	compensation, err = wallet.Undo()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if compensation.Type != models.Withdraw || compensation.Reverses != "1" {
+		t.Errorf("Unexpected compensating entry: %+v", compensation)
+	}
+
+	if _, err := wallet.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got: %v", err)
+	}
+
+	// History is append-only: two originals and two compensations
+	if len(wallet.GetTransactionHistory()) != 4 {
+		t.Errorf("Expected 4 ledger entries, got %d", len(wallet.GetTransactionHistory()))
+	}
+}
+
+func TestWallet_UndoSpentDeposit(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.BTC, Amount: 100})
+	// Compensating entries are skipped, so the deposit is next in line
+	// Only Undo records them, so this one is put in the ledger directly
+	wallet.GetLedger().AddTransaction(models.Transaction{ID: "2", Type: models.Withdraw, Asset: models.BTC, Amount: 100, Reverses: "imported"})
+
+	if _, err := wallet.Undo(); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+	if len(wallet.GetTransactionHistory()) != 2 {
+		t.Errorf("Expected failed undo not to be recorded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	entries := []models.Transaction{
+		{ID: "1", Type: models.Deposit, Asset: models.BTC, Amount: 100},
+		{ID: "1", Type: models.Deposit, Asset: models.BTC, Amount: 100},
+		{ID: "3", Type: models.Withdraw, Asset: models.BTC, Amount: 500},
+		{ID: "4", Type: models.Deposit, Asset: models.USD, Amount: 5, Reverses: "9"},
+	}
+
+	problems := Verify(entries)
+	if len(problems) != 3 {
+		t.Fatalf("Expected 3 problems, got %d: %v", len(problems), problems)
+	}
+	if !errors.Is(problems[0], ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got: %v", problems[0])
+	}
+	if !errors.Is(problems[1], ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got: %v", problems[1])
+	}
+	var verifyErr *VerifyError
+	if !errors.As(problems[2], &verifyErr) || verifyErr.Seq != 4 || !errors.Is(problems[2], ErrInvalidEntry) {
+		t.Errorf("Expected an invalid entry at seq 4, got: %v", problems[2])
+	}
+
+	if problems := Verify(entries[:1]); len(problems) != 0 {
+		t.Errorf("Expected a valid ledger to verify, got: %v", problems)
+	}
+}
+
+func TestWallet_ConcurrentWithdrawals(t *testing.T) {
+	wallet := NewWallet()
+	wallet.ProcessTransaction(models.Transaction{Type: models.Deposit, Asset: models.USD, Amount: 1000})
+
+	// 50 withdrawals of 100 race for a balance of 1000: exactly 10 may win
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wallet.ProcessTransaction(models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 100}) == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded.Load() != 10 || wallet.GetBalance(models.USD) != 0 {
+		t.Errorf("Expected 10 withdrawals and a zero balance, got %d and %d", succeeded.Load(), wallet.GetBalance(models.USD))
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// AddressFile keeps the receive addresses of a wallet in a file encrypted
+// with the data key, like the seed they derive from
+// It implements services.AddressStore
+type AddressFile struct {
+	path   string
+	cipher *Cipher
+}
+
+// OpenAddressFile returns the address file stored at path, encrypted with
+// c; the file is created on the first save
+func OpenAddressFile(path string, c *Cipher) *AddressFile {
+	return &AddressFile{path: path, cipher: c}
+}
+
+// Load reads every address in the file, or none when it does not exist yet
+func (f *AddressFile) Load() ([]services.ReceiveAddress, error) {
+	var addresses []services.ReceiveAddress
+	return addresses, readJSONFile(f.path, f.cipher, "addresses", &addresses)
+}
+
+// Save replaces the content of the file with addresses
+func (f *AddressFile) Save(addresses []services.ReceiveAddress) error {
+	return writeJSONFile(f.path, f.cipher, "addresses", addresses)
+}
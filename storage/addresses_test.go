@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestAddressFile_SaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	c, err := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "addresses.json")
+	file := OpenAddressFile(path, c)
+
+	if addresses, err := file.Load(); err != nil || len(addresses) != 0 {
+		t.Fatalf("Expected no addresses before the first save, got %v, %v", addresses, err)
+	}
+	saved := []services.ReceiveAddress{{
+		Asset:   models.BTC,
+		Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Index:   3,
+		Path:    "m/44'/0'/0'/0/3",
+		Created: time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC),
+	}}
+	if err := file.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "bc1q") {
+		t.Errorf("Expected the addresses to be encrypted")
+	}
+	addresses, err := OpenAddressFile(path, c).Load()
+	if err != nil || len(addresses) != 1 || addresses[0] != saved[0] {
+		t.Errorf("Expected the address to round-trip, got %+v, %v", addresses, err)
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// AllowlistFile keeps the withdrawal allowlist in a JSON file, rewritten
+// atomically on every save
+// It implements services.AllowlistStore
+type AllowlistFile struct {
+	path   string
+	cipher *Cipher // nil for a plaintext file
+}
+
+// OpenAllowlistFile returns the allowlist file stored at path; the file is
+// created on the first save
+func OpenAllowlistFile(path string) *AllowlistFile {
+	return &AllowlistFile{path: path}
+}
+
+// OpenEncryptedAllowlistFile returns the allowlist file stored at path,
+// encrypted with c
+func OpenEncryptedAllowlistFile(path string, c *Cipher) *AllowlistFile {
+	return &AllowlistFile{path: path, cipher: c}
+}
+
+// Load reads every address in the file, or none when it does not exist yet
+func (f *AllowlistFile) Load() ([]services.AllowedAddress, error) {
+	var allowed []services.AllowedAddress
+	return allowed, readJSONFile(f.path, f.cipher, "allowlist", &allowed)
+}
+
+// Save replaces the content of the file with allowed
+func (f *AllowlistFile) Save(allowed []services.AllowedAddress) error {
+	return writeJSONFile(f.path, f.cipher, "allowlist", allowed)
+}
+
+// EncryptAllowlistFile encrypts in place the plaintext allowlist file at
+// path, if there is one and it is not encrypted yet
+func EncryptAllowlistFile(path string, c *Cipher) error {
+	return encryptJSONFile(path, c, "allowlist")
+}
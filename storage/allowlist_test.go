@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestAllowlistFile_Encrypt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "allowlist.json")
+	added := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	saved := []services.AllowedAddress{{
+		Asset:   models.ETH,
+		Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		Label:   "cold storage",
+		Added:   added,
+	}}
+	if err := OpenAllowlistFile(path).Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte(`"active"`)) {
+		t.Errorf("Expected the end of the cooling-off period not to be stored, got %s", data)
+	}
+
+	c, err := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := OpenEncryptedAllowlistFile(path, c)
+	if _, err := encrypted.Load(); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected a plaintext file to be refused, got %v", err)
+	}
+	for range 2 {
+		if err := EncryptAllowlistFile(path, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	allowed, err := encrypted.Load()
+	if err != nil || len(allowed) != 1 || allowed[0] != saved[0] {
+		t.Errorf("Expected the address to round-trip, got %+v, %v", allowed, err)
+	}
+	if _, err := OpenAllowlistFile(path).Load(); err == nil {
+		t.Errorf("Expected the encrypted file not to read as plaintext")
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+// ApprovalFile keeps approval requests in a JSON file
+// Every save rewrites the whole file through a temporary file and a
+// rename, so a crash leaves either the old or the new content
+// It implements services.ApprovalStore
+type ApprovalFile struct {
+	path   string
+	cipher *Cipher // nil for a plaintext file
+}
+
+// OpenApprovalFile returns the approval file stored at path; the file is
+// created on the first save
+func OpenApprovalFile(path string) *ApprovalFile {
+	return &ApprovalFile{path: path}
+}
+
+// OpenEncryptedApprovalFile returns the approval file stored at path,
+// encrypted with c
+func OpenEncryptedApprovalFile(path string, c *Cipher) *ApprovalFile {
+	return &ApprovalFile{path: path, cipher: c}
+}
+
+// Load reads every request in the file, or none when it does not exist yet
+func (f *ApprovalFile) Load() ([]services.ApprovalRequest, error) {
+	var requests []services.ApprovalRequest
+	return requests, readJSONFile(f.path, f.cipher, "approvals", &requests)
+}
+
+// Save replaces the content of the file with requests
+func (f *ApprovalFile) Save(requests []services.ApprovalRequest) error {
+	return writeJSONFile(f.path, f.cipher, "approvals", requests)
+}
+
+// EncryptApprovalFile encrypts in place the plaintext approval file at
+// path, if there is one and it is not encrypted yet
+func EncryptApprovalFile(path string, c *Cipher) error {
+	return encryptJSONFile(path, c, "approvals")
+}
+
+// readJSONFile decodes the JSON file at path into v, opening it with c
+// first unless c is nil. A missing file leaves v as it is
+// name is the file's part of the associated data, see recordAD
+func readJSONFile(path string, c *Cipher, name string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		if data, err = c.openRecord(bytes.TrimSpace(data), recordAD(name, 0)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile replaces the file at path with v as JSON, sealed with c
+// unless c is nil
+func writeJSONFile(path string, c *Cipher, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		return writeFileAtomic(path, c.sealRecord(data, recordAD(name, 0)))
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// encryptJSONFile seals in place the plaintext JSON file at path, if there
+// is one and it is not encrypted yet
+func encryptJSONFile(path string, c *Cipher, name string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && !isPlaintext(bytes.TrimSpace(data)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("%s: invalid JSON", path)
+	}
+	return writeFileAtomic(path, c.sealRecord(bytes.TrimSpace(data), recordAD(name, 0)))
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file and a rename, so a crash leaves either the old or the new content
+// The file is readable only by its owner
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
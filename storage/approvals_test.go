@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func TestApprovalFile_SaveAndLoad(t *testing.T) {
+	file := OpenApprovalFile(filepath.Join(t.TempDir(), "approvals.json"))
+
+	requests, err := file.Load()
+	if err != nil || len(requests) != 0 {
+		t.Fatalf("Expected no requests before the first save, got %v, %v", requests, err)
+	}
+
+	saved := []services.ApprovalRequest{{
+		ID:          "A1",
+		Transaction: models.Transaction{Type: models.Withdraw, Asset: models.ETH, Amount: 3},
+		Status:      services.ApprovalPending,
+		Required:    2,
+		Created:     time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC),
+		Decisions:   []models.ApprovalDecision{{Approver: "alice", Approved: true}},
+	}}
+	if err := file.Save(saved); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	requests, err = file.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(requests) != 1 || requests[0].Transaction.Amount != 3 || requests[0].Decisions[0].Approver != "alice" || !requests[0].Expires.IsZero() {
+		t.Errorf("Expected the request to round-trip, got %+v", requests)
+	}
+}
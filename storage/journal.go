@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Journal is an append-only file of ledger entries in JSON Lines
+// Each line is one commit: a transaction object, or an array of
+// transactions for a batch, so a batch is never half-recorded
+// In an encrypted journal, each line is instead the base64 of the commit
+// sealed with the data key (see Cipher), bound to its position, and a
+// sealed record count is kept next to it (see headPath), so lines cut off
+// the end are detected like any other tampering. Replacing both files with
+// an older copy of the pair is not detected
+// It implements services.Journal
+type Journal struct {
+	path    string
+	cipher  *Cipher // nil for a plaintext journal
+	records int     // lines in the file, for the position of the next one
+}
+
+// OpenJournal returns the journal stored at path, creating an empty one
+// if the file does not exist yet
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return &Journal{path: path}, nil
+}
+
+// OpenEncryptedJournal returns the journal stored at path, encrypted with
+// c, creating an empty one if the file does not exist yet
+func OpenEncryptedJournal(path string, c *Cipher) (*Journal, error) {
+	j, err := OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	j.cipher = c
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j.records = bytes.Count(data, []byte{'\n'})
+	return j, nil
+}
+
+// EncryptJournal encrypts in place every line of the plaintext journal at
+// path that is not encrypted yet, so an interrupted run can be resumed
+// The file is replaced atomically
+func EncryptJournal(path string, c *Cipher) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	lines := bytes.SplitAfter(data[:bytes.LastIndexByte(data, '\n')+1], []byte{'\n'})
+	for i, line := range lines {
+		if record := bytes.TrimSpace(line); isPlaintext(record) {
+			line = c.sealRecord(record, recordAD("journal", i))
+		}
+		out.Write(line)
+	}
+	if err := writeFileAtomic(path, out.Bytes()); err != nil {
+		return err
+	}
+	return writeHead(path, c, bytes.Count(out.Bytes(), []byte{'\n'}))
+}
+
+// headPath is the file that keeps the sealed record count of the
+// encrypted journal at path
+func headPath(path string) string {
+	return path + ".head"
+}
+
+// writeHead records that the encrypted journal at path has n records
+func writeHead(path string, c *Cipher, n int) error {
+	return writeFileAtomic(headPath(path), c.sealRecord([]byte(strconv.Itoa(n)), recordAD("journal head", 0)))
+}
+
+// readHead returns the record count kept for the encrypted journal at
+// path, or -1 when none was recorded
+func readHead(path string, c *Cipher) (int, error) {
+	data, err := os.ReadFile(headPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	record, err := c.openRecord(bytes.TrimSpace(data), recordAD("journal head", 0))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", headPath(path), err)
+	}
+	n, err := strconv.Atoi(string(record))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w: %w", headPath(path), ErrCorrupted, err)
+	}
+	return n, nil
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Load reads every entry in the journal, oldest first
+// A final line without a trailing newline is the remainder of an append
+// interrupted by a crash; it was never committed, so it is dropped and
+// truncated away before the next append. An encrypted journal with fewer
+// records than its recorded count fails with ErrCorrupted
+func (j *Journal) Load() ([]models.Transaction, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := os.Truncate(j.path, int64(complete)); err != nil {
+			return nil, fmt.Errorf("truncating interrupted journal write: %w", err)
+		}
+		data = data[:complete]
+	}
+
+	entries := make([]models.Transaction, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	line := 1
+	for ; scanner.Scan(); line++ {
+		record := bytes.TrimSpace(scanner.Bytes())
+		if j.cipher != nil {
+			if record, err = j.cipher.openRecord(record, recordAD("journal", line-1)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", j.path, line, err)
+			}
+		}
+		if len(record) > 0 && record[0] == '[' {
+			var batch []models.Transaction
+			if err := json.Unmarshal(record, &batch); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", j.path, line, err)
+			}
+			entries = append(entries, batch...)
+			continue
+		}
+
+		var tx models.Transaction
+		if err := json.Unmarshal(record, &tx); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", j.path, line, err)
+		}
+		entries = append(entries, tx)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	j.records = line - 1
+
+	if j.cipher != nil {
+		if err := j.checkHead(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// checkHead compares the records loaded with the recorded count
+// More records than counted are appends whose count was not updated
+// before a crash, so the count is raised to match
+func (j *Journal) checkHead() error {
+	count, err := readHead(j.path, j.cipher)
+	switch {
+	case err != nil:
+		return err
+	case count < 0 && j.records > 0:
+		return fmt.Errorf("%s: %w: record count missing; run encrypt to record it", j.path, ErrCorrupted)
+	case j.records < count:
+		return fmt.Errorf("%s: %w: %d of %d records", j.path, ErrCorrupted, j.records, count)
+	case j.records > count:
+		return writeHead(j.path, j.cipher, j.records)
+	}
+	return nil
+}
+
+// Append writes entries as a single line and syncs the file, so a crash
+// leaves either the whole commit or a partial last line that Load drops
+func (j *Journal) Append(txs ...models.Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	var record any = txs
+	if len(txs) == 1 {
+		record = txs[0]
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(record); err != nil {
+		return err
+	}
+	line := buf.Bytes()
+	if j.cipher != nil {
+		line = j.cipher.sealRecord(bytes.TrimSpace(line), recordAD("journal", j.records))
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	j.records++
+	if j.cipher != nil {
+		// The commit is durable already; a count left behind is raised by
+		// the next Load
+		writeHead(j.path, j.cipher, j.records)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+func TestJournal_AppendAndLoad(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	single := models.Transaction{ID: "1", Type: models.Deposit, Asset: models.BTC, Amount: 150000000}
+	batch := []models.Transaction{
+		{ID: "2", Type: models.Deposit, Asset: models.USD, Amount: 1000},
+		{ID: "3", Type: models.Withdraw, Asset: models.USD, Amount: 250, Memo: "fee", Principal: "ops", Reverses: "1"},
+	}
+	if err := journal.Append(single); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := journal.Append(batch...); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	entries, err := journal.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Amount != 150000000 || entries[2].Memo != "fee" || entries[2].Type != models.Withdraw ||
+		entries[2].Principal != "ops" || entries[2].Reverses != "1" {
+		t.Errorf("Expected entries to round-trip, got %+v", entries)
+	}
+}
+
+func TestJournal_DropsInterruptedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	journal.Append(models.Transaction{ID: "1", Type: models.Deposit, Asset: models.ETH, Amount: 1})
+
+	// Simulate a crash halfway through writing the next line
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	file.WriteString(`[{"id":"2","type":"DEPOSIT"`)
+	file.Close()
+
+	entries, err := journal.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected the partial line to be dropped, got %d entries", len(entries))
+	}
+
+	// The next append must start on a fresh line
+	journal.Append(models.Transaction{ID: "2", Type: models.Deposit, Asset: models.ETH, Amount: 2})
+	entries, err = journal.Load()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries after appending, got %d (err %v)", len(entries), err)
+	}
+}
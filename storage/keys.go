@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"github.com/fraidev/hedix-wallet/api"
+)
+
+// KeyFile keeps API keys in a JSON file readable only by its owner
+// Saves are atomic, as for ApprovalFile. Only an encrypted file keeps the
+// signing keys of signed requests; a plaintext one would let whoever
+// reads it sign as the keys. It implements api.KeyStore
+type KeyFile struct {
+	path   string
+	cipher *Cipher // nil for a plaintext file
+}
+
+// storedKey is a key as written to the file
+type storedKey struct {
+	api.APIKey
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+// OpenKeyFile returns the key file stored at path; the file is created on
+// the first save
+func OpenKeyFile(path string) *KeyFile {
+	return &KeyFile{path: path}
+}
+
+// OpenEncryptedKeyFile returns the key file stored at path, encrypted
+// with c
+func OpenEncryptedKeyFile(path string, c *Cipher) *KeyFile {
+	return &KeyFile{path: path, cipher: c}
+}
+
+// Load reads every key in the file, or none when it does not exist yet
+func (f *KeyFile) Load() ([]api.APIKey, error) {
+	var stored []storedKey
+	if err := readJSONFile(f.path, f.cipher, "keys", &stored); err != nil {
+		return nil, err
+	}
+	var keys []api.APIKey
+	for _, key := range stored {
+		key.APIKey.SigningKey = key.SigningKey
+		keys = append(keys, key.APIKey)
+	}
+	return keys, nil
+}
+
+// Save replaces the content of the file with keys
+func (f *KeyFile) Save(keys []api.APIKey) error {
+	stored := make([]storedKey, len(keys))
+	for i, key := range keys {
+		stored[i].APIKey = key
+		if f.cipher != nil {
+			stored[i].SigningKey = key.SigningKey
+		}
+	}
+	return writeJSONFile(f.path, f.cipher, "keys", stored)
+}
+
+// EncryptKeyFile encrypts in place the plaintext key file at path, if
+// there is one and it is not encrypted yet. Its keys had no signing keys
+// stored, so they still only accept bearer secrets
+func EncryptKeyFile(path string, c *Cipher) error {
+	return encryptJSONFile(path, c, "keys")
+}
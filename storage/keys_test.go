@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/api"
+)
+
+func TestKeyFile_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	file := OpenKeyFile(path)
+
+	keys, err := file.Load()
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("Expected no keys before the first save, got %v, %v", keys, err)
+	}
+
+	saved := []api.APIKey{{ID: "k1", Hash: "abc", Operations: []api.Operation{api.OpView}}}
+	if err := file.Save(saved); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	keys, err = file.Load()
+	if err != nil || len(keys) != 1 || keys[0].Hash != "abc" || keys[0].Operations[0] != api.OpView {
+		t.Errorf("Expected the key to round-trip, got %+v, %v", keys, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected the key file to be private, got %v", perm)
+	}
+}
+
+func TestKeyFile_SigningKeys(t *testing.T) {
+	dir := t.TempDir()
+	saved := []api.APIKey{{ID: "k1", Hash: "abc", SigningKey: "def", Operations: []api.Operation{api.OpView}}}
+
+	// A plaintext file does not keep the signing key
+	plain := OpenKeyFile(filepath.Join(dir, "plain.json"))
+	plain.Save(saved)
+	if keys, err := plain.Load(); err != nil || len(keys) != 1 || keys[0].SigningKey != "" {
+		t.Errorf("Expected no signing key in a plaintext file, got %+v, %v", keys, err)
+	}
+
+	cipher, _ := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	path := filepath.Join(dir, "keys.json")
+	encrypted := OpenEncryptedKeyFile(path, cipher)
+	if err := encrypted.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte(`"def"`)) || bytes.Contains(data, []byte(`"k1"`)) {
+		t.Errorf("Expected no plaintext in the file, got %s", data)
+	}
+	if keys, err := encrypted.Load(); err != nil || len(keys) != 1 || keys[0].SigningKey != "def" || keys[0].Hash != "abc" {
+		t.Errorf("Expected the signing key to round-trip, got %+v, %v", keys, err)
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Errors reported for the seed file
+var (
+	ErrSeedExists = &models.Error{Code: "SEED_EXISTS", Message: "the wallet already has a seed"}
+	ErrNoSeed     = &models.Error{Code: "NO_SEED", Message: "the wallet has no seed"}
+)
+
+// SaveSeed writes a wallet's seed to path, encrypted with c
+// It refuses to replace an existing seed, whose keys may hold funds
+func SaveSeed(path string, c *Cipher, seed []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrSeedExists, path)
+	}
+	return writeFileAtomic(path, c.sealRecord(seed, recordAD("seed", 0)))
+}
+
+// LoadSeed reads the seed saved at path with SaveSeed
+func LoadSeed(path string, c *Cipher) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSeed
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := c.openRecord(bytes.TrimSpace(data), recordAD("seed", 0))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return seed, nil
+}
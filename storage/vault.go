@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/fraidev/hedix-wallet/models"
+)
+
+// Errors reported for encrypted storage
+var (
+	ErrWrongPassphrase = &models.Error{Code: "WRONG_PASSPHRASE", Message: "wrong passphrase"}
+	ErrCorrupted       = &models.Error{Code: "CORRUPTED", Message: "encrypted data failed authentication"}
+	ErrInvalidVault    = &models.Error{Code: "INVALID_VAULT", Message: "invalid key file"}
+	ErrNotEncrypted    = &models.Error{Code: "NOT_ENCRYPTED", Message: "file is not encrypted"}
+)
+
+// kdfIterations is the PBKDF2-SHA256 cost of new key files; each key file
+// records its own, so raising it only affects files written afterwards
+var kdfIterations = 600_000
+
+// vaultFile is the content of a key file. The data key that encrypts the
+// journal and the other files is random; the key file keeps it wrapped
+// under a key derived from the passphrase, so changing the passphrase
+// rewraps the data key and never touches the encrypted history
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	WrappedKey []byte `json:"wrapped_key"` // nonce followed by the AES-GCM sealed data key
+}
+
+// wrapAD binds a wrapped data key to its purpose
+var wrapAD = []byte("hedix data key")
+
+// Cipher seals and opens records with AES-256-GCM under a data key
+// Every sealed record is a random nonce followed by the ciphertext
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func newCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts plaintext; ad is authenticated but not encrypted, and must
+// be given again to Open
+func (c *Cipher) Seal(plaintext, ad []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	rand.Read(nonce)
+	return c.aead.Seal(nonce, nonce, plaintext, ad)
+}
+
+// Open decrypts a record made by Seal with the same ad
+func (c *Cipher) Open(sealed, ad []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrCorrupted
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:size], sealed[size:], ad)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plaintext, nil
+}
+
+// CreateVault writes a key file at path holding a new data key wrapped
+// under passphrase, and returns the cipher of that data key
+// It fails if the file exists, so a data key is never replaced by mistake
+func CreateVault(path, passphrase string) (*Cipher, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: empty passphrase", ErrInvalidVault)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%w: %s already exists", ErrInvalidVault, path)
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	if err := writeVault(path, key, passphrase); err != nil {
+		return nil, err
+	}
+	return newCipher(key)
+}
+
+// UnlockVault reads the key file at path and unwraps its data key with
+// passphrase
+func UnlockVault(path, passphrase string) (*Cipher, error) {
+	key, err := readVault(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newCipher(key)
+}
+
+// ChangePassphrase rewraps the data key of the key file at path under
+// newPassphrase, with a fresh salt. The files encrypted with the data key
+// are unchanged; the key file is replaced atomically
+func ChangePassphrase(path, oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return fmt.Errorf("%w: empty passphrase", ErrInvalidVault)
+	}
+	key, err := readVault(path, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	return writeVault(path, key, newPassphrase)
+}
+
+// IsVault reports whether a key file exists at path
+func IsVault(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func writeVault(path string, key []byte, passphrase string) error {
+	v := vaultFile{Version: 1, KDF: "pbkdf2-sha256", Iterations: kdfIterations, Salt: make([]byte, 16)}
+	rand.Read(v.Salt)
+	wrapping, err := v.wrappingCipher(passphrase)
+	if err != nil {
+		return err
+	}
+	v.WrappedKey = wrapping.Seal(key, wrapAD)
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+func readVault(path, passphrase string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v vaultFile
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidVault, path, err)
+	}
+	if v.Version != 1 || v.KDF != "pbkdf2-sha256" || v.Iterations < 1 || len(v.Salt) == 0 {
+		return nil, fmt.Errorf("%w: %s: unsupported version or key derivation", ErrInvalidVault, path)
+	}
+
+	wrapping, err := v.wrappingCipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := wrapping.Open(v.WrappedKey, wrapAD)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+// wrappingCipher derives the key that wraps the data key from passphrase
+func (v vaultFile) wrappingCipher(passphrase string) (*Cipher, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, v.Salt, v.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newCipher(key)
+}
+
+// recordAD is the associated data of the record at index of a file, so a
+// record cannot be moved within the file or to another one
+func recordAD(file string, index int) []byte {
+	return binary.BigEndian.AppendUint64([]byte(file), uint64(index))
+}
+
+// sealRecord encrypts one record as a line of base64
+func (c *Cipher) sealRecord(record []byte, ad []byte) []byte {
+	sealed := c.Seal(record, ad)
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)), base64.StdEncoding.EncodedLen(len(sealed))+1)
+	base64.StdEncoding.Encode(line, sealed)
+	return append(line, '\n')
+}
+
+// openRecord decrypts a line made by sealRecord
+func (c *Cipher) openRecord(line []byte, ad []byte) ([]byte, error) {
+	if isPlaintext(line) {
+		return nil, ErrNotEncrypted
+	}
+	sealed, err := base64.StdEncoding.AppendDecode(nil, line)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return c.Open(sealed, ad)
+}
+
+// isPlaintext reports whether a record is JSON rather than base64, which
+// never starts with a bracket and is never as short as null
+func isPlaintext(record []byte) bool {
+	return len(record) > 0 && (record[0] == '{' || record[0] == '[') || string(record) == "null"
+}
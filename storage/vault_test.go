@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fraidev/hedix-wallet/models"
+	"github.com/fraidev/hedix-wallet/services"
+)
+
+func init() {
+	// Keep key derivation fast in tests
+	kdfIterations = 1000
+}
+
+func TestVault_UnlockAndChangePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.key")
+	created, err := CreateVault(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := created.Seal([]byte("secret"), []byte("ad"))
+
+	if _, err := CreateVault(path, "other"); !errors.Is(err, ErrInvalidVault) {
+		t.Errorf("Expected an existing key file not to be replaced, got %v", err)
+	}
+	if _, err := UnlockVault(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a wrong passphrase to be refused, got %v", err)
+	}
+
+	if err := ChangePassphrase(path, "correct horse", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnlockVault(path, "correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected the old passphrase to stop working, got %v", err)
+	}
+	unlocked, err := UnlockVault(path, "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := unlocked.Open(sealed, []byte("ad")); err != nil || string(plaintext) != "secret" {
+		t.Errorf("Expected data sealed before the change to open, got %q, %v", plaintext, err)
+	}
+	if _, err := unlocked.Open(sealed, []byte("other")); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected other associated data to fail, got %v", err)
+	}
+}
+
+func TestJournal_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.jsonl")
+	cipher, err := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal, _ := OpenEncryptedJournal(path, cipher)
+	journal.Append(models.Transaction{ID: "1", Type: models.Deposit, Asset: models.USD, Amount: 1000, Memo: "salary"})
+	journal.Append(models.Transaction{ID: "2", Type: models.Withdraw, Asset: models.USD, Amount: 300})
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("salary")) || bytes.Contains(data, []byte("USD")) {
+		t.Errorf("Expected no plaintext in the journal, got %s", data)
+	}
+
+	reopened, _ := OpenEncryptedJournal(path, cipher)
+	reopened.Append(models.Transaction{ID: "3", Type: models.Deposit, Asset: models.BTC, Amount: 5})
+	entries, err := reopened.Load()
+	if err != nil || len(entries) != 3 || entries[0].Memo != "salary" || entries[2].Asset != models.BTC {
+		t.Fatalf("Expected the entries to round-trip, got %+v, %v", entries, err)
+	}
+
+	// Swapping two lines breaks their authentication
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	os.WriteFile(path, append(append([]byte{}, lines[1]...), lines[0]...), 0o600)
+	if _, err := reopened.Load(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected reordered entries to be detected, got %v", err)
+	}
+}
+
+func TestJournal_EncryptedTruncation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.jsonl")
+	cipher, _ := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+
+	journal, _ := OpenEncryptedJournal(path, cipher)
+	journal.Append(models.Transaction{ID: "1", Type: models.Deposit, Asset: models.USD, Amount: 1000})
+	journal.Append(models.Transaction{ID: "2", Type: models.Withdraw, Asset: models.USD, Amount: 300})
+	data, _ := os.ReadFile(path)
+	head, _ := os.ReadFile(headPath(path))
+
+	// Cutting whole records off the end leaves every remaining one valid
+	first := data[:bytes.IndexByte(data, '\n')+1]
+	os.WriteFile(path, first, 0o600)
+	if _, err := journal.Load(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected a truncated journal to be detected, got %v", err)
+	}
+	os.WriteFile(path, data, 0o600)
+	os.Remove(headPath(path))
+	if _, err := journal.Load(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected a missing record count to be detected, got %v", err)
+	}
+
+	os.WriteFile(headPath(path), nil, 0o600)
+	if _, err := journal.Load(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected an unreadable count to be detected, got %v", err)
+	}
+	os.WriteFile(headPath(path), head, 0o600)
+
+	// A crash between an append and its count leaves one record uncounted
+	writeHead(path, cipher, 1)
+	entries, err := journal.Load()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected the uncounted record to be kept, got %+v, %v", entries, err)
+	}
+	os.WriteFile(path, first, 0o600)
+	if _, err := journal.Load(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected the count to be raised by Load, got %v", err)
+	}
+}
+
+func TestEncryptJournal_Plaintext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.jsonl")
+	plain, _ := OpenJournal(path)
+	plain.Append(models.Transaction{ID: "1", Type: models.Deposit, Asset: models.ETH, Amount: 7})
+	plain.Append(models.Transaction{ID: "2", Type: models.Deposit, Asset: models.ETH, Amount: 8}, models.Transaction{ID: "3", Type: models.Withdraw, Asset: models.ETH, Amount: 1})
+
+	cipher, _ := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	encrypted, _ := OpenEncryptedJournal(path, cipher)
+	if _, err := encrypted.Load(); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected a plaintext journal to be refused, got %v", err)
+	}
+
+	if err := EncryptJournal(path, cipher); err != nil {
+		t.Fatal(err)
+	}
+	// Running it again leaves the encrypted lines alone
+	if err := EncryptJournal(path, cipher); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := encrypted.Load()
+	if err != nil || len(entries) != 3 || entries[2].Amount != 1 {
+		t.Errorf("Expected the entries to survive encryption, got %+v, %v", entries, err)
+	}
+}
+
+func TestApprovalFile_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "approvals.json")
+	OpenApprovalFile(path).Save([]services.ApprovalRequest{{ID: "A1", Status: services.ApprovalPending, Transaction: models.Transaction{Type: models.Withdraw, Asset: models.USD, Amount: 1}}})
+
+	cipher, _ := CreateVault(filepath.Join(dir, "wallet.key"), "pass")
+	file := OpenEncryptedApprovalFile(path, cipher)
+	if _, err := file.Load(); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected a plaintext file to be refused, got %v", err)
+	}
+	if err := EncryptApprovalFile(path, cipher); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte(`"A1"`)) {
+		t.Errorf("Expected no plaintext in the file, got %s", data)
+	}
+	requests, err := file.Load()
+	if err != nil || len(requests) != 1 || requests[0].ID != "A1" {
+		t.Errorf("Expected the request to round-trip, got %+v, %v", requests, err)
+	}
+}